@@ -0,0 +1,126 @@
+package commitcron
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anacanm/commitCron/auth"
+	"github.com/anacanm/commitCron/redact"
+)
+
+// Account is a github user and the repository that contributions are made to for them
+// several accounts can be configured in ACCOUNTS_FILE (eg. separate work and personal identities), and the full pipeline is run for each of them
+// with its own credentials and rate limit, sharing nothing with the others
+type Account struct {
+	Username string `json:"username"`
+	Repo     string `json:"repo"`
+	// Repos, if it is not empty, are the repositories that the day's contributions are split between, in place of Repo
+	Repos []string `json:"repos"`
+	// Token and TokenFile are alternative ways of supplying the account's credentials
+	// if both are empty, the credentials are configured by the environment, the same way as when there is a single account
+	Token     string `json:"token"`
+	TokenFile string `json:"token_file"`
+	// RequestsPerSecond limits how quickly requests are sent to github for the account, 0 means no limit
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	// PRDraft, if it is set, overrides PR_DRAFT for the account
+	PRDraft *bool `json:"pr_draft"`
+}
+
+// loadAccounts returns the accounts listed in the json file at ACCOUNTS_FILE,
+// or if ACCOUNTS_FILE is not set, the single account configured by GITHUB_USERNAME and REPO_NAME (or REPO_NAMES)
+func loadAccounts(env Settings) ([]Account, error) {
+	var rate float64
+	if r, present := env.lookup("RATE_LIMIT"); present {
+		var err error
+		rate, err = strconv.ParseFloat(r, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing RATE_LIMIT: %w", err)
+		}
+	}
+
+	path, present := env.lookup("ACCOUNTS_FILE")
+	if !present {
+		account := Account{Username: env.get("GITHUB_USERNAME"), Repo: env.get("REPO_NAME"), RequestsPerSecond: rate}
+		if r, present := env.lookup("REPO_NAMES"); present {
+			for _, repo := range strings.Split(r, ",") {
+				if repo = strings.TrimSpace(repo); repo != "" {
+					account.Repos = append(account.Repos, repo)
+				}
+			}
+		}
+		return []Account{account}, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading ACCOUNTS_FILE: %w", err)
+	}
+	var accounts []Account
+	if err := json.Unmarshal(data, &accounts); err != nil {
+		return nil, fmt.Errorf("Error decoding json from %v: %w", path, err)
+	}
+	for i, account := range accounts {
+		if account.Username == "" || (account.Repo == "" && len(account.Repos) == 0) {
+			return nil, fmt.Errorf("account %v in %v is missing its username or repo", i, path)
+		}
+		redact.Secret(account.Token)
+		if account.RequestsPerSecond == 0 {
+			accounts[i].RequestsPerSecond = rate
+		}
+	}
+	return accounts, nil
+}
+
+// tokenSource returns the source of the tokens that the account's requests are authorized with
+// tokenClient is only used to obtain tokens (eg. refreshing an oauth token), it is kept separate so that obtaining a token never tries to authorize itself
+func (a Account) tokenSource(env Settings, tokenClient *http.Client) (auth.TokenSource, error) {
+	switch {
+	case a.Token != "":
+		return auth.StaticToken(a.Token), nil
+	case a.TokenFile != "":
+		return auth.NewFileTokenSource(a.TokenFile)
+	default:
+		return auth.FromSettings(env.lookup, tokenClient)
+	}
+}
+
+// newClient creates the http.Client used for every request made on behalf of the account, authorized with the account's credentials (see tokenSource),
+// and sent with runner's options: its http client's transport and timeout, its base url, and its rate limit, unless the account has a rate of its own
+func (a Account) newClient(runner *Runner, env Settings, tokenClient *http.Client) (*http.Client, error) {
+	source, err := a.tokenSource(env, tokenClient)
+	if err != nil {
+		return nil, err
+	}
+
+	var transport http.RoundTripper = &auth.Transport{Source: source, Base: runner.transport()}
+	rate := a.RequestsPerSecond
+	if rate == 0 {
+		rate = runner.requestsPerSecond
+	}
+	if rate > 0 {
+		transport = &rateLimitedTransport{
+			interval: time.Duration(float64(time.Second) / rate),
+			base:     transport,
+		}
+	}
+
+	// From https://golang.org/src/net/http/client.go:
+	// "Clients should be reused instead of created as needed. Clients are safe for concurrent use by multiple goroutines."
+	return &http.Client{
+		Timeout:   runner.timeout(),
+		Transport: transport,
+	}, nil
+}
+
+// repos returns the repositories that the account's contributions are made to
+func (a Account) repos() []string {
+	if len(a.Repos) > 0 {
+		return a.Repos
+	}
+	return []string{a.Repo}
+}
@@ -0,0 +1,92 @@
+package commitcron_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	commitcron "github.com/anacanm/commitCron"
+	"github.com/anacanm/commitCron/contributions"
+)
+
+// the v1 api is what is asserted below: Run and its Config, the Report it returns, the Runner and its options, the Planner, and APIError
+// until a v2 module, none of it is removed, renamed, or changed in a way that breaks a program using it: functions and methods keep their signatures,
+// structs keep their fields (new fields may be added, so use them with keyed literals), and errors keep their types
+// a change that would break it fails to compile here, and has to be made compatibly instead
+
+// Run and its Config
+var (
+	_ func(context.Context, commitcron.Config) (*commitcron.Report, error) = commitcron.Run
+	_ func() (commitcron.Config, error)                                    = commitcron.ConfigFromEnv
+	_ func(commitcron.Settings) (commitcron.Config, error)                 = commitcron.ConfigFromSettings
+	_ func() commitcron.Settings                                           = commitcron.SettingsFromEnv
+
+	_ = commitcron.Config{Accounts: []commitcron.Account{}, NumberOfContributions: 0, MinContributions: 0, TokenClient: (*http.Client)(nil), Settings: commitcron.Settings{}, Logger: (*slog.Logger)(nil)}
+	_ = commitcron.Account{Username: "", Repo: "", Repos: []string{}, Token: "", TokenFile: "", RequestsPerSecond: 0, PRDraft: (*bool)(nil)}
+)
+
+// the Report
+var (
+	_ = commitcron.Report{Started: time.Time{}, Duration: 0, Accounts: []commitcron.AccountReport{}}
+	_ = commitcron.AccountReport{Username: "", ContributionsBefore: 0, ContributionsAfter: 0, Repos: []commitcron.RepoReport{}, Duration: 0, Err: error(nil)}
+	_ = commitcron.RepoReport{Repo: "", Planned: 0, Made: 0, Created: []string{}, Updated: []string{}, Deleted: []string{}, Commits: []string{}, Steps: []commitcron.StepReport{}, Warnings: []string{}, Err: error(nil)}
+	_ = commitcron.StepReport{Name: "", Duration: 0}
+
+	_ fmt.Stringer   = (*commitcron.Report)(nil)
+	_ json.Marshaler = commitcron.AccountReport{}
+	_ json.Marshaler = commitcron.RepoReport{}
+)
+
+// the Runner and its options
+var (
+	_ func(...commitcron.Option) (*commitcron.Runner, error)                                   = commitcron.New
+	_ func(*http.Client) commitcron.Option                                                     = commitcron.WithHTTPClient
+	_ func(string) commitcron.Option                                                           = commitcron.WithBaseURL
+	_ func(*slog.Logger) commitcron.Option                                                     = commitcron.WithLogger
+	_ func(func() time.Time) commitcron.Option                                                 = commitcron.WithClock
+	_ func(float64) commitcron.Option                                                          = commitcron.WithRateLimit
+	_ func(*contributions.Cache) commitcron.Option                                             = commitcron.WithContributionsCache
+	_ func(commitcron.Hooks) commitcron.Option                                                 = commitcron.WithHooks
+	_ func(*commitcron.Runner, context.Context, commitcron.Config) (*commitcron.Report, error) = (*commitcron.Runner).Run
+	_ func(*commitcron.Runner, commitcron.Config) *commitcron.Planner                          = (*commitcron.Runner).Planner
+
+	_ = commitcron.Hooks{
+		OnRunStarted:    func(context.Context) error { return nil },
+		OnPlanReady:     func(context.Context, *commitcron.Plan) error { return nil },
+		OnCommitCreated: func(context.Context, commitcron.Commit) {},
+		OnRunFinished:   func(context.Context, *commitcron.Report) {},
+	}
+	_ = commitcron.Commit{Username: "", Repo: "", SHA: ""}
+)
+
+// the Planner
+var (
+	_ func(commitcron.Config) *commitcron.Planner                                                = commitcron.NewPlanner
+	_ func(*commitcron.Planner, context.Context) ([]*commitcron.Plan, error)                     = (*commitcron.Planner).Plan
+	_ func(*commitcron.Planner, context.Context, []*commitcron.Plan) (*commitcron.Report, error) = (*commitcron.Planner).Execute
+
+	_ = commitcron.Plan{Username: "", Repo: "", Branch: "", ContributionsToday: 0, Changes: []commitcron.PlannedChange{}, FilesPerCommit: 0, CommitDates: []time.Time{}}
+	_ = commitcron.PlannedChange{Action: "", Path: "", SHA: "", Mode: "", Message: "", Content: ""}
+
+	_ fmt.Stringer = (*commitcron.Plan)(nil)
+)
+
+// APIError
+var (
+	_       = commitcron.APIError{Method: "", URL: "", Status: "", StatusCode: 0, Message: ""}
+	_ error = (*commitcron.APIError)(nil)
+)
+
+// TestAPIErrorAs checks that an APIError, wrapped as the errors that the api returns are, is still found by errors.As
+func TestAPIErrorAs(t *testing.T) {
+	err := fmt.Errorf("Error getting contributions: %w", &commitcron.APIError{Method: "GET", URL: "https://api.github.com/user", Status: "401 Unauthorized", StatusCode: http.StatusUnauthorized})
+	var apiErr *commitcron.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("errors.As(%v) didn't find the APIError", err)
+	}
+}
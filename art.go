@@ -0,0 +1,155 @@
+package commitcron
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// graphWeeks is how many weeks (columns) github's contribution graph shows, and graphDays how many days (rows) each of them has, from sunday to saturday
+const (
+	graphWeeks = 53
+	graphDays  = 7
+)
+
+// maxIntensity is the darkest shade of the contribution graph, a pattern's intensities go from 0 (no commits) to maxIntensity
+const maxIntensity = 4
+
+// Pattern is a design for the contribution graph, as the intensity of each day, from 0 (no commits) to 4 (the darkest shade), in rows from sunday to saturday, and columns from the first week to the last
+// it only computes, so it can be previewed anywhere, including in a browser (see cmd/commitcron-wasm), before it is drawn (see PlanArt)
+type Pattern [graphDays][]int
+
+// ParsePattern parses a pattern from text, which has a line for each day of the week, from sunday to saturday, and a character for each week,
+// either an intensity from 0 to 4, or one of ". " for 0 and "#" for 4, eg. for a plus sign:
+//
+//	.....
+//	..4..
+//	..4..
+//	44444
+//	..4..
+//	..4..
+//	.....
+//
+// lines that are shorter than the longest one are padded with 0s
+func ParsePattern(text string) (Pattern, error) {
+	var p Pattern
+	lines := strings.Split(strings.TrimRight(strings.Replace(text, "\r\n", "\n", -1), "\n"), "\n")
+	if len(lines) != graphDays {
+		return p, fmt.Errorf("a pattern must have %v lines, one for each day of the week, got %v", graphDays, len(lines))
+	}
+	weeks := 0
+	for _, line := range lines {
+		if len(line) > weeks {
+			weeks = len(line)
+		}
+	}
+	if weeks > graphWeeks {
+		return p, fmt.Errorf("a pattern can be at most %v weeks wide, got %v", graphWeeks, weeks)
+	}
+	for day, line := range lines {
+		p[day] = make([]int, weeks)
+		for week, c := range line {
+			switch {
+			case c == '.' || c == ' ':
+			case c == '#':
+				p[day][week] = maxIntensity
+			case c >= '0' && c <= '0'+maxIntensity:
+				p[day][week] = int(c - '0')
+			default:
+				return p, fmt.Errorf("line %v, column %v: %q is not an intensity, use 0 to %v, \".\" or \"#\"", day+1, week+1, c, maxIntensity)
+			}
+		}
+	}
+	return p, nil
+}
+
+// Weeks returns how many weeks wide the pattern is
+func (p Pattern) Weeks() int {
+	return len(p[0])
+}
+
+// Days returns the day of each of the pattern's cells that has a non-zero intensity, and its intensity, with the pattern's first column on the week of start,
+// which is moved back to the sunday before it if it is not one, since each column of the graph starts on a sunday
+func (p Pattern) Days(start time.Time) map[time.Time]int {
+	start = start.AddDate(0, 0, -int(start.Weekday()))
+	days := map[time.Time]int{}
+	for day := range p {
+		for week, intensity := range p[day] {
+			if intensity > 0 {
+				days[start.AddDate(0, 0, 7*week+day)] = intensity
+			}
+		}
+	}
+	return days
+}
+
+// lastGraphSunday returns the sunday that starts the first column of the contribution graph shown on the day of now
+func lastGraphSunday(now time.Time) time.Time {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	return today.AddDate(0, 0, -int(today.Weekday())-7*(graphWeeks-1))
+}
+
+// ArtOptions are the pattern that PlanArt draws, where, and how darkly
+type ArtOptions struct {
+	// Pattern is the pattern to draw, eg. from ParsePattern, TextPattern or DecodeImagePattern
+	Pattern Pattern
+	// Start is a day in the week that the pattern's first column is drawn on, or if it is zero, the first week the graph currently shows
+	Start time.Time
+	// PerLevel is the number of commits for each level of intensity of each day
+	PerLevel int
+}
+
+// PlanArt plans the backdated commits that draw opts.Pattern on the contribution graph, with opts.PerLevel commits for each level of intensity of each day,
+// with the same machinery as backfill, and the same checks
+// a day that has commits of its own already is darker than the pattern says, so patterns are best drawn where there is no other activity
+func PlanArt(ctx context.Context, env Settings, opts ArtOptions, tokenClient *http.Client) (*Backdating, error) {
+	return (&Runner{}).PlanArt(ctx, env, opts, tokenClient)
+}
+
+// PlanArt plans drawing a pattern as the package's PlanArt does, with the runner's options
+func (r *Runner) PlanArt(ctx context.Context, env Settings, opts ArtOptions, tokenClient *http.Client) (*Backdating, error) {
+	ctx = withRunner(ctx, r)
+	if opts.PerLevel < 1 {
+		return nil, fmt.Errorf("the number of commits per level must be positive, got %v", opts.PerLevel)
+	}
+	first := opts.Start
+	if first.IsZero() {
+		first = lastGraphSunday(currentTime(ctx))
+	}
+	days := opts.Pattern.Days(first)
+	if len(days) == 0 {
+		return &Backdating{}, nil
+	}
+
+	account, client, created, err := backfillAccount(ctx, r, env, tokenClient)
+	if err != nil {
+		return nil, err
+	}
+	commitOpts, err := loadCommitOptions(env)
+	if err != nil {
+		return nil, err
+	}
+	sel, err := loadSelection(env)
+	if err != nil {
+		return nil, err
+	}
+	// the days are planned in order, so that every commit is dated after the one before it
+	first = first.AddDate(0, 0, -int(first.Weekday()))
+	last := first.AddDate(0, 0, 7*opts.Pattern.Weeks()-1)
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		intensity, ok := days[day]
+		if !ok {
+			continue
+		}
+		if day.Before(created) {
+			return nil, fmt.Errorf("the pattern starts before the account was created (%v)", created.Format(dateLayout))
+		}
+		if day.After(currentTime(ctx)) {
+			return nil, fmt.Errorf("the pattern ends in the future (%v), commits can only be backdated up to today", day.Format(dateLayout))
+		}
+		commitOpts.Dates = append(commitOpts.Dates, dayDates(day, intensity*opts.PerLevel, commitOpts.Times.WorkingHours, currentTime(ctx))...)
+	}
+	return backdated(r, account, client, sel, commitOpts), nil
+}
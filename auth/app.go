@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// appJWTLifetime is how long the JWT used to authenticate as the app is valid for, github rejects JWTs that are valid for longer than 10 minutes
+const appJWTLifetime = 9 * time.Minute
+
+// installationTokenResponse holds the response from creating an installation access token
+type installationTokenResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Message   string    `json:"message"`
+}
+
+// installationResponse holds the necessary part of the response from looking up the installation of an app on a repository
+type installationResponse struct {
+	ID      int64  `json:"id"`
+	Message string `json:"message"`
+}
+
+// AppTokenSource is a TokenSource that authenticates as a github app installation
+// it signs a short lived JWT with the app's private key, and exchanges it for an installation access token, which github expires after an hour
+// a new installation token is generated whenever the current one is about to expire
+type AppTokenSource struct {
+	appID          string
+	installationID string
+	key            *rsa.PrivateKey
+	client         *http.Client
+	// owner and repo are used to look up the installation when installationID is not known
+	owner string
+	repo  string
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// NewAppTokenSource creates an AppTokenSource for the app identified by appID, using the PEM encoded privateKey that was generated for it
+// if installationID is empty, the installation is looked up from the repository owner/repo the first time a token is needed
+func NewAppTokenSource(appID string, privateKey []byte, installationID, owner, repo string, client *http.Client) (*AppTokenSource, error) {
+	key, err := parseRSAPrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing github app private key: %w", err)
+	}
+	return &AppTokenSource{
+		appID:          appID,
+		installationID: installationID,
+		key:            key,
+		client:         client,
+		owner:          owner,
+		repo:           repo,
+	}, nil
+}
+
+// Token returns the current installation token, generating a new one if it is about to expire (or has never been generated)
+func (s *AppTokenSource) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && time.Now().Before(s.expiry.Add(-expiryLeeway)) {
+		return s.token, nil
+	}
+
+	jwt, err := s.signJWT()
+	if err != nil {
+		return "", fmt.Errorf("Error signing github app JWT: %w", err)
+	}
+
+	if s.installationID == "" {
+		id, err := s.lookupInstallation(jwt)
+		if err != nil {
+			return "", err
+		}
+		s.installationID = id
+	}
+
+	url := fmt.Sprintf("https://api.github.com/app/installations/%v/access_tokens", s.installationID)
+	req, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		return "", fmt.Errorf("Error creating http POST request for %v: %w", url, err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", jwt))
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("Error sending http POST request to %v: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	var itr installationTokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxTokenResponseBytes)).Decode(&itr); err != nil {
+		return "", fmt.Errorf("Error decoding json response from %v: %w", url, err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("Error creating installation token at %v: %v: %v", url, resp.Status, itr.Message)
+	}
+
+	s.token = itr.Token
+	s.expiry = itr.ExpiresAt
+	return s.token, nil
+}
+
+// lookupInstallation finds the id of the app's installation that has access to the configured repository
+func (s *AppTokenSource) lookupInstallation(jwt string) (string, error) {
+	url := fmt.Sprintf("https://api.github.com/repos/%v/%v/installation", s.owner, s.repo)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", fmt.Errorf("Error creating http GET request for %v: %w", url, err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %v", jwt))
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("Error sending http GET request to %v: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	var ir installationResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxTokenResponseBytes)).Decode(&ir); err != nil {
+		return "", fmt.Errorf("Error decoding json response from %v: %w", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Error finding github app installation for %v/%v (is the app installed on the repository?): %v: %v", s.owner, s.repo, resp.Status, ir.Message)
+	}
+	return strconv.FormatInt(ir.ID, 10), nil
+}
+
+// signJWT creates the RS256 signed JWT that authenticates requests as the app itself
+// see: https://docs.github.com/en/apps/creating-github-apps/authenticating-with-a-github-app/generating-a-json-web-token-jwt-for-a-github-app
+func (s *AppTokenSource) signJWT() (string, error) {
+	now := time.Now()
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		// iat is backdated to allow for clock drift between this machine and github
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(appJWTLifetime).Unix(),
+		"iss": s.appID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// parseRSAPrivateKey parses a PEM encoded RSA private key
+// github generates PKCS #1 keys, but PKCS #8 is also accepted in case the key has been converted
+func parseRSAPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is not an RSA key")
+	}
+	return key, nil
+}
@@ -0,0 +1,161 @@
+// Package auth provides the credentials that authenticate requests to the github api
+// a TokenSource supplies a token, and Transport attaches whatever token its TokenSource currently supplies to every outgoing request,
+// so an http.Client using Transport never needs to know where the token came from or whether it has been refreshed
+package auth
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/anacanm/commitCron/redact"
+)
+
+// TokenSource supplies the token sent in the Authorization header of requests to the github api
+// implementations must be safe for concurrent use, since a single http.Client is shared by all goroutines
+type TokenSource interface {
+	Token() (string, error)
+}
+
+// StaticToken is a TokenSource that always supplies the same token, eg. a personal access token
+type StaticToken string
+
+// Token returns the static token
+func (t StaticToken) Token() (string, error) {
+	return string(t), nil
+}
+
+// Transport is an http.RoundTripper that authorizes each request with the token supplied by Source
+type Transport struct {
+	Source TokenSource
+	// Base is the RoundTripper used to actually send the request, if nil, http.DefaultTransport is used
+	Base http.RoundTripper
+}
+
+// RoundTrip authorizes and sends a single request
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.Source.Token()
+	if err != nil {
+		return nil, fmt.Errorf("Error obtaining token for %v: %w", req.URL, err)
+	}
+	// whichever source the token came from (and however many times it has been refreshed), it must never appear in output
+	redact.Secret(token)
+
+	// a RoundTripper must not modify the request it is given, so the header is set on a copy
+	authorized := req.Clone(req.Context())
+	authorized.Header.Set("Authorization", fmt.Sprintf("token %v", token))
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(authorized)
+}
+
+// Settings looks up the value of a setting by its name (the name of the environment variable that configures it), and whether it is set at all, as os.LookupEnv does
+type Settings func(name string) (string, bool)
+
+// get returns the value of the setting name, or "" if it is not set, as os.Getenv does
+func (s Settings) get(name string) string {
+	value, _ := s(name)
+	return value
+}
+
+// FromEnvironment determines which TokenSource to use from the environment variables that have been set, see FromSettings
+func FromEnvironment(client *http.Client) (TokenSource, error) {
+	return FromSettings(os.LookupEnv, client)
+}
+
+// FromSettings determines which TokenSource to use from the settings that have been set, which are named after the environment variables that would set them
+// client is only used to obtain tokens (eg. refreshing an oauth token), so it must NOT itself use a Transport, or every refresh would try to authorize itself
+func FromSettings(settings Settings, client *http.Client) (TokenSource, error) {
+	// every secret that is configured in the environment is registered up front, including the ones that are only used to obtain the actual token
+	for _, name := range []string{"GITHUB_API_TOKEN", "GITHUB_TOKEN", "GITHUB_CLIENT_SECRET", "GITHUB_REFRESH_TOKEN", "GITHUB_APP_PRIVATE_KEY", "VAULT_TOKEN", "VAULT_SECRET_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN"} {
+		redact.Secret(settings.get(name))
+	}
+
+	if appID, present := settings("GITHUB_APP_ID"); present {
+		privateKey := []byte(settings.get("GITHUB_APP_PRIVATE_KEY"))
+		if path, present := settings("GITHUB_APP_PRIVATE_KEY_PATH"); present {
+			var err error
+			privateKey, err = ioutil.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("Error reading github app private key from %v: %w", path, err)
+			}
+			// the key read from the file is as secret as one set directly, and it is registered trimmed too, since a file usually ends with a newline that a message quoting it wouldn't
+			redact.Secret(string(privateKey))
+			redact.Secret(strings.TrimSpace(string(privateKey)))
+		}
+		if len(privateKey) == 0 {
+			return nil, fmt.Errorf("GITHUB_APP_ID is set, but neither GITHUB_APP_PRIVATE_KEY nor GITHUB_APP_PRIVATE_KEY_PATH is")
+		}
+		return NewAppTokenSource(appID, privateKey, settings.get("GITHUB_APP_INSTALLATION_ID"), settings.get("GITHUB_USERNAME"), settings.get("REPO_NAME"), client)
+	}
+
+	if refreshToken, present := settings("GITHUB_REFRESH_TOKEN"); present {
+		clientID, clientSecret := settings.get("GITHUB_CLIENT_ID"), settings.get("GITHUB_CLIENT_SECRET")
+		if clientID == "" || clientSecret == "" {
+			return nil, fmt.Errorf("GITHUB_REFRESH_TOKEN is set, but GITHUB_CLIENT_ID and GITHUB_CLIENT_SECRET are also required to refresh it")
+		}
+		return NewRefreshTokenSource(clientID, clientSecret, refreshToken, client), nil
+	}
+
+	if path, present := settings("GITHUB_TOKEN_VAULT_PATH"); present {
+		token, err := vaultToken(settings, client, path)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading github token from vault: %w", err)
+		}
+		return StaticToken(token), nil
+	}
+
+	if id, present := settings("GITHUB_TOKEN_AWS_SECRET"); present {
+		token, err := awsSecretToken(settings, client, "secretsmanager", id)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading github token from aws secrets manager: %w", err)
+		}
+		return StaticToken(token), nil
+	}
+
+	if name, present := settings("GITHUB_TOKEN_SSM_PARAMETER"); present {
+		token, err := awsSecretToken(settings, client, "ssm", name)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading github token from aws ssm parameter store: %w", err)
+		}
+		return StaticToken(token), nil
+	}
+
+	if path, present := settings("GITHUB_API_TOKEN_FILE"); present {
+		return NewFileTokenSource(path)
+	}
+
+	if token, present := settings("GITHUB_API_TOKEN"); present {
+		return StaticToken(token), nil
+	}
+	// GITHUB_TOKEN is the conventional name used by github actions and most other tools
+	if token, present := settings("GITHUB_TOKEN"); present {
+		return StaticToken(token), nil
+	}
+
+	// fall back to a token stored by `commitcron login`
+	token, err := LoadStoredToken()
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		return StaticToken(token), nil
+	}
+
+	// many ci images already carry github credentials in ~/.netrc for git and curl
+	if token := netrcToken(settings); token != "" {
+		return StaticToken(token), nil
+	}
+
+	// finally, reuse the credentials of the gh cli if it is installed and logged in
+	if token := ghCLIToken(); token != "" {
+		return StaticToken(token), nil
+	}
+
+	return nil, fmt.Errorf("no github credentials configured: set GITHUB_API_TOKEN (or GITHUB_TOKEN), GITHUB_CLIENT_ID, GITHUB_CLIENT_SECRET and GITHUB_REFRESH_TOKEN, or GITHUB_APP_ID and GITHUB_APP_PRIVATE_KEY, or run \"commitcron login\" or \"gh auth login\"")
+}
@@ -0,0 +1,278 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/anacanm/commitCron/redact"
+)
+
+// awsCredentials are the credentials requests to aws are signed with
+type awsCredentials struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	Token           string `json:"Token"`
+}
+
+// awsSecretToken reads the github token from the secrets manager secret (GITHUB_TOKEN_AWS_SECRET) or ssm parameter (GITHUB_TOKEN_SSM_PARAMETER) with the given id,
+// using the ambient credentials of the environment it runs in (lambda, ecs, ec2, or AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY)
+func awsSecretToken(settings Settings, client *http.Client, service, id string) (string, error) {
+	region := settings.get("AWS_REGION")
+	if region == "" {
+		region = settings.get("AWS_DEFAULT_REGION")
+	}
+	// an arn includes its region, eg. arn:aws:secretsmanager:us-east-1:123456789012:secret:commitcron
+	if parts := strings.Split(id, ":"); len(parts) > 3 && parts[0] == "arn" {
+		region = parts[3]
+	}
+	if region == "" {
+		return "", fmt.Errorf("Error determining aws region: set AWS_REGION, or reference the token by its full arn")
+	}
+
+	creds, err := ambientAWSCredentials(settings, client)
+	if err != nil {
+		return "", err
+	}
+
+	if service == "ssm" {
+		var out struct {
+			Parameter struct {
+				Value string `json:"Value"`
+			} `json:"Parameter"`
+		}
+		err := awsJSONRequest(client, creds, region, "ssm", "AmazonSSM.GetParameter", map[string]interface{}{"Name": id, "WithDecryption": true}, &out)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(out.Parameter.Value), nil
+	}
+
+	var out struct {
+		SecretString string `json:"SecretString"`
+	}
+	err = awsJSONRequest(client, creds, region, "secretsmanager", "secretsmanager.GetSecretValue", map[string]interface{}{"SecretId": id}, &out)
+	if err != nil {
+		return "", err
+	}
+
+	key := settings.get("GITHUB_TOKEN_AWS_SECRET_KEY")
+	if key == "" {
+		key = "token"
+	}
+	token, err := secretStringToken(out.SecretString, key)
+	if err != nil {
+		return "", fmt.Errorf("Error reading the token from aws secret %v: %w", id, err)
+	}
+	return token, nil
+}
+
+// secretStringToken returns the token in a secrets manager secret's SecretString, which is either the token itself, or a json object with the token in its field key,
+// as secrets are often stored as json key/value pairs
+// a json object without the field is an error, rather than a token, since sending the whole object as one would leak every other field in it
+func secretStringToken(secret, key string) (string, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(secret), &fields); err != nil || fields == nil {
+		return strings.TrimSpace(secret), nil
+	}
+	value, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("it is json, but has no %q field", key)
+	}
+	token, ok := value.(string)
+	if !ok || token == "" {
+		return "", fmt.Errorf("its %q field is not a non-empty string", key)
+	}
+	return token, nil
+}
+
+// ambientAWSCredentials finds credentials in the same places the aws sdks do: the environment (which is also how lambda supplies them),
+// the ecs container credentials endpoint, and finally the ec2 instance metadata service
+func ambientAWSCredentials(settings Settings, client *http.Client) (awsCredentials, error) {
+	creds := awsCredentials{
+		AccessKeyID:     settings.get("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: settings.get("AWS_SECRET_ACCESS_KEY"),
+		Token:           settings.get("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyID != "" && creds.SecretAccessKey != "" {
+		return creds, nil
+	}
+
+	if relative := settings.get("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); relative != "" {
+		return fetchAWSCredentials(client, "http://169.254.170.2"+relative, nil)
+	}
+	if full := settings.get("AWS_CONTAINER_CREDENTIALS_FULL_URI"); full != "" {
+		header := http.Header{}
+		if token := settings.get("AWS_CONTAINER_AUTHORIZATION_TOKEN"); token != "" {
+			header.Set("Authorization", token)
+		}
+		return fetchAWSCredentials(client, full, header)
+	}
+
+	// the instance metadata service only answers on ec2, so it is given a short timeout to fail quickly everywhere else
+	imdsClient := &http.Client{Timeout: 2 * time.Second}
+	req, err := http.NewRequest("PUT", "http://169.254.169.254/latest/api/token", nil)
+	if err != nil {
+		return creds, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "300")
+	resp, err := imdsClient.Do(req)
+	if err != nil {
+		return creds, fmt.Errorf("Error finding aws credentials: none in the environment, and the instance metadata service is unreachable: %w", err)
+	}
+	imdsToken, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxTokenResponseBytes))
+	resp.Body.Close()
+	if err != nil {
+		return creds, fmt.Errorf("Error reading instance metadata token: %w", err)
+	}
+	header := http.Header{}
+	header.Set("X-aws-ec2-metadata-token", string(imdsToken))
+
+	role, err := awsGet(imdsClient, "http://169.254.169.254/latest/meta-data/iam/security-credentials/", header)
+	if err != nil {
+		return creds, fmt.Errorf("Error finding instance role (does the instance have an iam role?): %w", err)
+	}
+	return fetchAWSCredentials(imdsClient, "http://169.254.169.254/latest/meta-data/iam/security-credentials/"+strings.TrimSpace(string(role)), header)
+}
+
+// fetchAWSCredentials reads credentials from a container or instance credentials endpoint
+func fetchAWSCredentials(client *http.Client, url string, header http.Header) (awsCredentials, error) {
+	var creds awsCredentials
+	body, err := awsGet(client, url, header)
+	if err != nil {
+		return creds, fmt.Errorf("Error fetching aws credentials: %w", err)
+	}
+	if err := json.Unmarshal(body, &creds); err != nil {
+		return creds, fmt.Errorf("Error decoding aws credentials from %v: %w", url, err)
+	}
+	redact.Secret(creds.SecretAccessKey)
+	redact.Secret(creds.Token)
+	return creds, nil
+}
+
+// awsGet sends a GET request to a credentials endpoint
+func awsGet(client *http.Client, url string, header http.Header) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%v: %v", url, resp.Status)
+	}
+	return ioutil.ReadAll(io.LimitReader(resp.Body, maxTokenResponseBytes))
+}
+
+// awsJSONRequest sends a signed request to one of aws' json rpc apis (which both secrets manager and ssm are), and decodes the response into out
+func awsJSONRequest(client *http.Client, creds awsCredentials, region, service, target string, input interface{}, out interface{}) error {
+	body, err := json.Marshal(input)
+	if err != nil {
+		return fmt.Errorf("Error marshalling %v request: %w", target, err)
+	}
+
+	url := fmt.Sprintf("https://%v.%v.amazonaws.com/", service, region)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("Error creating http POST request for %v: %w", url, err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+	signAWSRequest(req, body, creds, region, service, time.Now().UTC())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Error sending http POST request to %v: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxTokenResponseBytes))
+	if err != nil {
+		return fmt.Errorf("Error reading response from %v: %w", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Error from aws calling %v: %v: %v", target, resp.Status, string(respBody))
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("Error decoding json response from %v: %w", url, err)
+	}
+	return nil
+}
+
+// signAWSRequest signs req with aws signature version 4
+// see: https://docs.aws.amazon.com/IAM/latest/UserGuide/create-signed-request.html
+func signAWSRequest(req *http.Request, body []byte, creds awsCredentials, region, service string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.Token != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.Token)
+	}
+
+	// the signed headers must be lowercase and sorted, these already are, and content-type and x-amz-target are only signed if they are set, as signing a header that isn't sent is an error
+	var signed []string
+	if req.Header.Get("Content-Type") != "" {
+		signed = append(signed, "content-type")
+	}
+	signed = append(signed, "host", "x-amz-date")
+	if creds.Token != "" {
+		signed = append(signed, "x-amz-security-token")
+	}
+	if req.Header.Get("X-Amz-Target") != "" {
+		signed = append(signed, "x-amz-target")
+	}
+
+	var canonicalHeaders strings.Builder
+	for _, h := range signed {
+		value := req.Header.Get(h)
+		if h == "host" {
+			value = req.URL.Host
+		}
+		canonicalHeaders.WriteString(h + ":" + strings.TrimSpace(value) + "\n")
+	}
+	signedHeaders := strings.Join(signed, ";")
+
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		"/",
+		"",
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := fmt.Sprintf("%v/%v/%v/aws4_request", date, region, service)
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(requestHash[:])}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%v/%v, SignedHeaders=%v, Signature=%v", creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data with key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
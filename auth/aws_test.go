@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the credentials, time, region and service of aws's signature version 4 test suite
+// see: https://docs.aws.amazon.com/general/latest/gr/signature-v4-test-suite.html
+var (
+	suiteCredentials = awsCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	suiteTime        = time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+)
+
+const suiteSessionToken = "AQoDYXdzEPT//////////wEXAMPLEtc764bNrC9SAPBSM22wDOk4x4HIZ8j4FZTwdQWLWsKWHGBuFqwAeMicRXmxfpSPfIeoIYRqTflfKD8YUuwthAx7mSEI/qkPpKPi/kMcGdQrmGdeehM4IC1NtBmUpp2wUE8phUZampKsburEDy0KPkyQDYwT7WZ0wq5VSXDvp75YU9HFvlRd8Tx6q6fE8YQcHNVXAkiY9q6d+xo0rKwT38xVqr7ZD0u0iPPkUL64lIZbqBAz+scqKmlzm8FDrypNC9Yjc8fPOLn9FX9KSYvKTr4rvx3iSIlTJabIQwj2ICCR/oLxBA=="
+
+func TestSignAWSRequest(t *testing.T) {
+	cases := []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		token       string
+		want        string
+	}{
+		{"get-vanilla", "GET", "", "", "",
+			"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+		{"post-vanilla", "POST", "", "", "",
+			"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b"},
+		{"post-x-www-form-urlencoded", "POST", "application/x-www-form-urlencoded", "Param1=value1", "",
+			"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature=ff11897932ad3f4e8b18135d722051e5ac45fc38421b1da7b9d196a0fe09473a"},
+		{"post-sts-header-before", "POST", "", "", suiteSessionToken,
+			"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date;x-amz-security-token, Signature=85d96828115b5dc0cfc3bd16ad9e210dd772bbebba041836c64533a82be05ead"},
+	}
+	for _, c := range cases {
+		req, err := http.NewRequest(c.method, "https://example.amazonaws.com/", strings.NewReader(c.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.contentType != "" {
+			req.Header.Set("Content-Type", c.contentType)
+		}
+		creds := suiteCredentials
+		creds.Token = c.token
+		signAWSRequest(req, []byte(c.body), creds, "us-east-1", "service", suiteTime)
+		if got := req.Header.Get("Authorization"); got != c.want {
+			t.Errorf("%v: Authorization is\n%v\nwant\n%v", c.name, got, c.want)
+		}
+		if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+			t.Errorf("%v: X-Amz-Date is %v, want 20150830T123600Z", c.name, got)
+		}
+		if got := req.Header.Get("X-Amz-Security-Token"); got != c.token {
+			t.Errorf("%v: X-Amz-Security-Token is %q, want %q", c.name, got, c.token)
+		}
+	}
+}
+
+func TestSignAWSRequestSignsTarget(t *testing.T) {
+	// the json rpc apis that are called (see awsJSONRequest) route the request by X-Amz-Target, so it must be signed along with the content type
+	req, err := http.NewRequest("POST", "https://secretsmanager.us-east-1.amazonaws.com/", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	signAWSRequest(req, []byte("{}"), suiteCredentials, "us-east-1", "secretsmanager", suiteTime)
+	if got := req.Header.Get("Authorization"); !strings.Contains(got, "SignedHeaders=content-type;host;x-amz-date;x-amz-target,") {
+		t.Errorf("Authorization is %v, want the content type and target signed", got)
+	}
+}
+
+func TestAWSSigningKey(t *testing.T) {
+	// the example of deriving a signing key from aws's documentation
+	// see: https://docs.aws.amazon.com/general/latest/gr/signature-v4-examples.html
+	key := hmacSHA256([]byte("AWS4wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"), "20120215")
+	key = hmacSHA256(key, "us-east-1")
+	key = hmacSHA256(key, "iam")
+	key = hmacSHA256(key, "aws4_request")
+	if got, want := hex.EncodeToString(key), "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d"; got != want {
+		t.Errorf("the signing key is %v, want %v", got, want)
+	}
+}
+
+// a secret that is json is only ever read for its field, never sent whole as the token
+func TestSecretStringToken(t *testing.T) {
+	cases := []struct {
+		name    string
+		secret  string
+		key     string
+		want    string
+		wantErr bool
+	}{
+		{name: "plain token", secret: " ghp_plain\n", key: "token", want: "ghp_plain"},
+		{name: "json field", secret: `{"token": "ghp_json", "other": "secret"}`, key: "token", want: "ghp_json"},
+		{name: "named field", secret: `{"github": "ghp_named"}`, key: "github", want: "ghp_named"},
+		{name: "other fields are not strings", secret: `{"token": "ghp_json", "rotated": 3, "enabled": true}`, key: "token", want: "ghp_json"},
+		{name: "missing field", secret: `{"other": "secret"}`, key: "token", wantErr: true},
+		{name: "field is not a string", secret: `{"token": {"value": "ghp_nested"}}`, key: "token", wantErr: true},
+		{name: "empty field", secret: `{"token": ""}`, key: "token", wantErr: true},
+	}
+	for _, c := range cases {
+		got, err := secretStringToken(c.secret, c.key)
+		if (err != nil) != c.wantErr {
+			t.Errorf("%v: secretStringToken(%q, %q) returned error %v, want an error: %v", c.name, c.secret, c.key, err, c.wantErr)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%v: secretStringToken(%q, %q) = %q, want %q", c.name, c.secret, c.key, got, c.want)
+		}
+	}
+}
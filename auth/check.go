@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Access describes what CheckAccess learned about the token
+type Access struct {
+	// Scopes are the oauth scopes of classic tokens, nil for fine-grained and installation tokens
+	Scopes []string
+	// Expiration is when the token expires, or the zero Time if github did not report one
+	Expiration time.Time
+}
+
+// repositoryResponse holds the necessary part of the response from the github repos api when checking access
+type repositoryResponse struct {
+	Private     bool `json:"private"`
+	Permissions struct {
+		Push bool `json:"push"`
+	} `json:"permissions"`
+	Message string `json:"message"`
+}
+
+// CheckAccess verifies that the token client authorizes its requests with is able to modify owner/repo, so that a misconfigured token
+// fails immediately with a clear message instead of deep inside uploadFile with a mysterious 404 or 403
+// classic personal access tokens and oauth tokens report their scopes in the X-OAuth-Scopes header, which must include repo.
+// fine-grained tokens and installation tokens do not send that header, so for them, each permission that is needed is probed instead,
+// which for the Contents: Write permission means creating an unreferenced blob in the repository (see CheckReadOnly for a check that writes nothing)
+func CheckAccess(client *http.Client, owner, repo string) (Access, error) {
+	return checkAccess(client, owner, repo, true)
+}
+
+// CheckReadOnly is CheckAccess without the probe of a fine-grained or installation token's Contents: Write permission, so it sends nothing that writes to the repository,
+// and can be used where nothing may be changed (eg. when only planning), at the cost of a token that can read the repository but not write to it passing the check
+func CheckReadOnly(client *http.Client, owner, repo string) (Access, error) {
+	return checkAccess(client, owner, repo, false)
+}
+
+// checkAccess is CheckAccess, which only probes the Contents: Write permission if write is set
+func checkAccess(client *http.Client, owner, repo string, write bool) (Access, error) {
+	var access Access
+
+	url := fmt.Sprintf("https://api.github.com/repos/%v/%v", owner, repo)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return access, fmt.Errorf("Error creating http GET request for %v: %w", url, err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return access, fmt.Errorf("Error sending http GET request to %v: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	var rr repositoryResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxTokenResponseBytes)).Decode(&rr); err != nil {
+		return access, fmt.Errorf("Error decoding json response from %v: %w", url, err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		if expiration, known := LoadExpiration(); known && time.Now().After(expiration) {
+			return access, fmt.Errorf("github rejected the token (%v), it expired on %v", rr.Message, expiration.Local().Format("2006-01-02"))
+		}
+		return access, fmt.Errorf("github rejected the token (%v), it may have been revoked or have expired", rr.Message)
+	case http.StatusNotFound:
+		// github responds with 404 rather than 403 for private repositories that the token can't see
+		return access, fmt.Errorf("repository %v/%v was not found, either it does not exist or the token has not been granted access to it", owner, repo)
+	default:
+		return access, fmt.Errorf("Error checking access to %v/%v: %v: %v", owner, repo, resp.Status, rr.Message)
+	}
+
+	access.Expiration, _ = TokenExpiration(resp)
+
+	if header, present := resp.Header["X-Oauth-Scopes"]; present {
+		access.Scopes = splitScopes(strings.Join(header, ","))
+		if !access.HasScope("repo") {
+			return access, fmt.Errorf("the token is missing the repo scope (it has: %q), which is required both to modify the repository and to count contributions to private repositories. Create a token with full access to the repo scope at https://github.com/settings/tokens", strings.Join(header, ","))
+		}
+		return access, nil
+	}
+
+	// the permissions github reports on the repository are the user's, not the token's, so a fine-grained token that was not granted
+	// Contents: Read and write would still pass this check. It only catches users who do not have write access to the repository at all
+	if !rr.Permissions.Push {
+		return access, fmt.Errorf("you do not have write access to %v/%v", owner, repo)
+	}
+	if err := probeContentsPermissions(client, owner, repo, write); err != nil {
+		return access, err
+	}
+	return access, nil
+}
+
+// probeContentsPermissions checks that a fine-grained (or installation) token has Contents: Read and, if write is set, Contents: Write permission on owner/repo
+// scopes headers are not sent for such tokens, so instead, each permission is probed with a request that requires it:
+// listing the root directory requires Contents: Read, and creating a blob requires Contents: Write.
+// a blob that is not referenced by any tree is never visible in the repository and is eventually garbage collected by github, so probing with one is harmless
+func probeContentsPermissions(client *http.Client, owner, repo string, write bool) error {
+	readURL := fmt.Sprintf("https://api.github.com/repos/%v/%v/contents/", owner, repo)
+	status, message, err := probe(client, "GET", readURL, nil)
+	if err != nil {
+		return err
+	}
+	// an empty repository responds with 404 "This repository is empty." which still proves that the contents could be read
+	if status == http.StatusForbidden || (status == http.StatusNotFound && message != "This repository is empty.") {
+		return fmt.Errorf("the token is missing the Contents: Read permission on %v/%v (github said: %v). Edit the token at https://github.com/settings/tokens and grant Contents: Read and write on the repository", owner, repo, message)
+	}
+	if !write {
+		return nil
+	}
+
+	writeURL := fmt.Sprintf("https://api.github.com/repos/%v/%v/git/blobs", owner, repo)
+	status, message, err = probe(client, "POST", writeURL, strings.NewReader(`{"content":"","encoding":"utf-8"}`))
+	if err != nil {
+		return err
+	}
+	switch status {
+	case http.StatusCreated:
+		return nil
+	case http.StatusConflict:
+		// an empty repository has no git database to create the blob in yet, so write access can't be probed until it has a first commit
+		return nil
+	case http.StatusForbidden, http.StatusNotFound:
+		return fmt.Errorf("the token is missing the Contents: Write permission on %v/%v (github said: %v). Edit the token at https://github.com/settings/tokens and grant Contents: Read and write on the repository", owner, repo, message)
+	default:
+		return fmt.Errorf("Error probing write access to %v/%v: %v: %v", owner, repo, status, message)
+	}
+}
+
+// probe sends a single request and returns the status code and the message github sent with it (if any)
+func probe(client *http.Client, method, url string, body io.Reader) (int, string, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return 0, "", fmt.Errorf("Error creating http %v request for %v: %w", method, url, err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", fmt.Errorf("Error sending http %v request to %v: %w", method, url, err)
+	}
+	defer resp.Body.Close()
+
+	// successful responses (eg. directory listings) are not objects, so a failure to decode the message is ignored
+	var m struct {
+		Message string `json:"message"`
+	}
+	json.NewDecoder(io.LimitReader(resp.Body, maxTokenResponseBytes)).Decode(&m)
+	return resp.StatusCode, m.Message, nil
+}
+
+// HasScope reports whether the token was granted scope
+func (a Access) HasScope(scope string) bool {
+	for _, s := range a.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// splitScopes splits the comma separated list of scopes sent in the X-OAuth-Scopes header
+func splitScopes(header string) []string {
+	scopes := []string{}
+	for _, s := range strings.Split(header, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
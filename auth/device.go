@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// deviceCodeURL is where github starts the oauth device flow
+const deviceCodeURL = "https://github.com/login/device/code"
+
+// DeviceCode holds github's response to starting the device flow
+// the user enters UserCode at VerificationURI, while the device polls for the token with DeviceCode every Interval seconds
+type DeviceCode struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        int    `json:"interval"`
+}
+
+// RequestDeviceCode starts the device flow for the oauth app identified by clientID, requesting the given space separated scopes
+// see: https://docs.github.com/en/apps/oauth-apps/building-oauth-apps/authorizing-oauth-apps#device-flow
+func RequestDeviceCode(client *http.Client, clientID, scope string) (DeviceCode, error) {
+	var code DeviceCode
+	form := url.Values{"client_id": {clientID}, "scope": {scope}}
+
+	req, err := http.NewRequest("POST", deviceCodeURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return code, fmt.Errorf("Error creating http POST request for %v: %w", deviceCodeURL, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return code, fmt.Errorf("Error sending http POST request to %v: %w", deviceCodeURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return code, fmt.Errorf("Error from %v (is device flow enabled for the oauth app?): %v", deviceCodeURL, resp.Status)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxTokenResponseBytes)).Decode(&code); err != nil {
+		return code, fmt.Errorf("Error decoding json response from %v: %w", deviceCodeURL, err)
+	}
+	if code.DeviceCode == "" {
+		return code, fmt.Errorf("Error from %v: no device code in response", deviceCodeURL)
+	}
+	return code, nil
+}
+
+// PollDeviceToken polls github until the user has entered code.UserCode, then returns the access token that was granted
+// it gives up when the user denies the request or the code expires
+func PollDeviceToken(client *http.Client, clientID string, code DeviceCode) (string, error) {
+	interval := time.Duration(code.Interval) * time.Second
+	deadline := time.Now().Add(time.Duration(code.ExpiresIn) * time.Second)
+
+	for time.Now().Before(deadline) {
+		time.Sleep(interval)
+
+		tr, err := requestToken(client, url.Values{
+			"client_id":   {clientID},
+			"device_code": {code.DeviceCode},
+			"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		})
+		if err != nil {
+			return "", err
+		}
+
+		switch tr.Error {
+		case "":
+			return tr.AccessToken, nil
+		case "authorization_pending":
+			// the user has not entered the code yet, keep polling
+		case "slow_down":
+			// github adds 5 seconds to the interval every time it has to tell us to slow down, and sends the new interval
+			if tr.Interval > 0 {
+				interval = time.Duration(tr.Interval) * time.Second
+			} else {
+				interval += 5 * time.Second
+			}
+		default:
+			// expired_token, access_denied, and friends are not recoverable
+			return "", fmt.Errorf("Error obtaining token with the device flow: %v: %v", tr.Error, tr.ErrorDescription)
+		}
+	}
+	return "", fmt.Errorf("Error obtaining token with the device flow: the code %v expired before it was entered", code.UserCode)
+}
@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// expirationLayouts are the formats github has been seen to use in the GitHub-Authentication-Token-Expiration header
+var expirationLayouts = []string{"2006-01-02 15:04:05 MST", "2006-01-02 15:04:05 -0700"}
+
+// TokenExpiration returns when the token that authorized the request for resp expires, as reported in the GitHub-Authentication-Token-Expiration header
+// returns false if the header is absent, eg. for classic tokens that were created without an expiration
+func TokenExpiration(resp *http.Response) (time.Time, bool) {
+	value := resp.Header.Get("GitHub-Authentication-Token-Expiration")
+	if value == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range expirationLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// expirationPath returns the path of the file that the last known token expiration is persisted in
+func expirationPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("Error finding user config directory: %w", err)
+	}
+	return filepath.Join(dir, "commitcron", "token-expiration"), nil
+}
+
+// SaveExpiration persists the expiration of the token in use, so that if a later run is rejected by github, it can explain that the token expired
+func SaveExpiration(expiration time.Time) error {
+	path, err := expirationPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("Error creating %v: %w", filepath.Dir(path), err)
+	}
+	if err := ioutil.WriteFile(path, []byte(expiration.Format(time.RFC3339)+"\n"), 0600); err != nil {
+		return fmt.Errorf("Error writing token expiration to %v: %w", path, err)
+	}
+	return nil
+}
+
+// LoadExpiration returns the expiration persisted by SaveExpiration, or false if none has been persisted
+func LoadExpiration() (time.Time, bool) {
+	path, err := expirationPath()
+	if err != nil {
+		return time.Time{}, false
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
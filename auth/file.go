@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileTokenSource is a TokenSource that reads the token from a file, eg. a docker or kubernetes secret mounted into the container
+// the file is re-read whenever it changes, so a rotated secret is picked up without restarting
+type FileTokenSource struct {
+	path string
+
+	mu      sync.Mutex
+	token   string
+	modTime time.Time
+}
+
+// NewFileTokenSource creates a FileTokenSource for the file at path, and reads the token from it so that a missing or empty file is reported immediately
+func NewFileTokenSource(path string) (*FileTokenSource, error) {
+	s := &FileTokenSource{path: path}
+	if _, err := s.Token(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Token returns the token in the file, re-reading the file first if it has been modified since it was last read
+func (s *FileTokenSource) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return "", fmt.Errorf("Error reading token file: %w", err)
+	}
+	if s.token != "" && info.ModTime().Equal(s.modTime) {
+		return s.token, nil
+	}
+
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return "", fmt.Errorf("Error reading token file: %w", err)
+	}
+	// secrets are frequently written with a trailing newline
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("token file %v is empty", s.path)
+	}
+
+	s.token = token
+	s.modTime = info.ModTime()
+	return s.token, nil
+}
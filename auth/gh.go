@@ -0,0 +1,20 @@
+package auth
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// ghCLIToken returns the token that the gh cli is logged in with, or "" if gh is not installed or not logged in
+// this lets users who already use gh avoid creating and storing a second token
+func ghCLIToken() string {
+	path, err := exec.LookPath("gh")
+	if err != nil {
+		return ""
+	}
+	out, err := exec.Command(path, "auth", "token", "--hostname", "github.com").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
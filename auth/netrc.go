@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// netrcToken returns the password of the first ~/.netrc machine entry for api.github.com (or failing that, github.com), or "" if there is none
+// the file is located the same way curl and git locate it: $NETRC, otherwise .netrc (_netrc on windows) in the home directory
+func netrcToken(settings Settings) string {
+	path := settings.get("NETRC")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		name := ".netrc"
+		if runtime.GOOS == "windows" {
+			name = "_netrc"
+		}
+		path = filepath.Join(home, name)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	passwords := parseNetrc(string(data))
+	if password := passwords["api.github.com"]; password != "" {
+		return password
+	}
+	return passwords["github.com"]
+}
+
+// parseNetrc returns the password of each machine in a netrc file, the first entry for a machine wins
+// macdef bodies are skipped, and the default entry is ignored since it is not specific to github
+// tokens may be split across lines, and double quoted (as curl allows), eg. so that a password can contain spaces, and a # starts a comment that runs to the end of its line
+func parseNetrc(data string) map[string]string {
+	passwords := make(map[string]string)
+
+	s := &netrcScanner{data: data}
+	var machine string
+	for {
+		token, ok := s.next()
+		if !ok {
+			return passwords
+		}
+		switch token {
+		case "machine":
+			machine, _ = s.next()
+		case "default":
+			machine = ""
+		case "password":
+			password, ok := s.next()
+			if _, seen := passwords[machine]; ok && machine != "" && !seen {
+				passwords[machine] = password
+			}
+		case "login", "account":
+			s.next()
+		case "macdef":
+			s.skipMacro()
+		}
+	}
+}
+
+// netrcScanner splits a netrc file into its tokens
+type netrcScanner struct {
+	data string
+	pos  int
+}
+
+// next returns the next token, with its quotes and escapes removed if it is quoted, or false at the end of the file
+func (s *netrcScanner) next() (string, bool) {
+	for {
+		for s.pos < len(s.data) && strings.ContainsRune(" \t\r\n", rune(s.data[s.pos])) {
+			s.pos++
+		}
+		if s.pos >= len(s.data) {
+			return "", false
+		}
+		if s.data[s.pos] != '#' {
+			break
+		}
+		s.skipLine()
+	}
+
+	if s.data[s.pos] != '"' {
+		start := s.pos
+		for s.pos < len(s.data) && !strings.ContainsRune(" \t\r\n", rune(s.data[s.pos])) {
+			s.pos++
+		}
+		return s.data[start:s.pos], true
+	}
+
+	// a quoted token runs until the next unescaped quote, or the end of the file
+	var b strings.Builder
+	for s.pos++; s.pos < len(s.data); s.pos++ {
+		c := s.data[s.pos]
+		if c == '"' {
+			s.pos++
+			break
+		}
+		if c == '\\' && s.pos+1 < len(s.data) {
+			s.pos++
+			switch c = s.data[s.pos]; c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			}
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), true
+}
+
+// skipLine moves past the end of the current line
+func (s *netrcScanner) skipLine() {
+	if i := strings.IndexByte(s.data[s.pos:], '\n'); i >= 0 {
+		s.pos += i + 1
+	} else {
+		s.pos = len(s.data)
+	}
+}
+
+// skipMacro moves past the body of a macro definition, which starts on the line after macdef and its name, and runs until the next blank line
+func (s *netrcScanner) skipMacro() {
+	s.skipLine()
+	for s.pos < len(s.data) {
+		end := strings.IndexByte(s.data[s.pos:], '\n')
+		if end < 0 {
+			end = len(s.data) - s.pos
+		}
+		blank := strings.TrimSpace(s.data[s.pos:s.pos+end]) == ""
+		s.skipLine()
+		if blank {
+			return
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseNetrc(t *testing.T) {
+	cases := []struct {
+		name string
+		data string
+		want map[string]string
+	}{
+		{"empty", "", map[string]string{}},
+		{"single line", "machine github.com login me password secret", map[string]string{"github.com": "secret"}},
+		{"one token per line", "machine\ngithub.com\nlogin\nme\npassword\nsecret\n", map[string]string{"github.com": "secret"}},
+		{"several machines", "machine api.github.com login me password one\nmachine example.com login me password two\n",
+			map[string]string{"api.github.com": "one", "example.com": "two"}},
+		{"first entry wins", "machine github.com password first\nmachine github.com password second\n", map[string]string{"github.com": "first"}},
+		{"account is skipped", "machine github.com account password password secret", map[string]string{"github.com": "secret"}},
+		{"crlf line endings", "machine github.com\r\nlogin me\r\npassword secret\r\n", map[string]string{"github.com": "secret"}},
+
+		// the default entry isn't specific to github, so a password in it isn't used, nor attributed to the machine before it
+		{"default is ignored", "default login anonymous password guest", map[string]string{}},
+		{"default after a machine", "machine github.com login me\ndefault login anonymous password guest\n", map[string]string{}},
+		{"machine after default", "default password guest\nmachine github.com password secret\n", map[string]string{"github.com": "secret"}},
+
+		// a macro's body runs until a blank line, and the words in it aren't tokens
+		{"macdef is skipped", "macdef init\nmachine github.com password wrong\n\nmachine github.com password secret\n",
+			map[string]string{"github.com": "secret"}},
+		{"macdef after a machine", "machine github.com login me\nmacdef init\ncd /pub\npassword wrong\n\npassword secret\n",
+			map[string]string{"github.com": "secret"}},
+		{"macdef runs to the end of the file", "machine github.com password secret\nmacdef init\nmachine example.com password wrong",
+			map[string]string{"github.com": "secret"}},
+		{"blank line with spaces ends a macdef", "macdef init\ncd /pub\n   \nmachine github.com password secret",
+			map[string]string{"github.com": "secret"}},
+
+		// quoted tokens may contain spaces, quotes and escapes, as curl allows
+		{"quoted password", `machine github.com password "a secret"`, map[string]string{"github.com": "a secret"}},
+		{"quoted machine", `machine "github.com" password secret`, map[string]string{"github.com": "secret"}},
+		{"escaped quote", `machine github.com password "say \"hi\""`, map[string]string{"github.com": `say "hi"`}},
+		{"escaped backslash", `machine github.com password "back\\slash"`, map[string]string{"github.com": `back\slash`}},
+		{"escaped whitespace", `machine github.com password "tab\there"`, map[string]string{"github.com": "tab\there"}},
+		{"empty quoted password", `machine github.com password ""`, map[string]string{"github.com": ""}},
+		{"unterminated quote", `machine github.com password "secret`, map[string]string{"github.com": "secret"}},
+
+		// comments
+		{"comment line", "# machine github.com password wrong\nmachine github.com password secret\n", map[string]string{"github.com": "secret"}},
+		{"comment after tokens", "machine github.com # the api\npassword secret\n", map[string]string{"github.com": "secret"}},
+
+		{"password without a value", "machine github.com password", map[string]string{}},
+		{"password without a machine", "password secret", map[string]string{}},
+	}
+	for _, c := range cases {
+		if got := parseNetrc(c.data); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%v: parseNetrc(%q) = %v, want %v", c.name, c.data, got, c.want)
+		}
+	}
+}
+
+func TestNetrcToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "netrc")
+	for data, want := range map[string]string{
+		"machine github.com password web\nmachine api.github.com password api\n": "api",
+		"machine github.com password web\n":                                      "web",
+		"machine example.com password other\n":                                   "",
+	} {
+		if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if got := netrcToken(Settings(func(name string) (string, bool) {
+			if name == "NETRC" {
+				return path, true
+			}
+			return "", false
+		})); got != want {
+			t.Errorf("netrcToken of %q = %q, want %q", data, got, want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacanm/commitCron/redact"
+)
+
+// oauthTokenURL is where github exchanges codes and refresh tokens for access tokens
+const oauthTokenURL = "https://github.com/login/oauth/access_token"
+
+// expiryLeeway is how long before its stated expiry a token is treated as expired, so that a token is never sent moments before it stops working
+const expiryLeeway = time.Minute
+
+// maxTokenResponseBytes is the ceiling on how much of a token response will be read, token responses are tiny
+const maxTokenResponseBytes = 1 << 20
+
+// tokenResponse holds the response from github's oauth access_token endpoint
+// github responds with 200 OK even when the exchange fails, in which case Error and ErrorDescription are set instead of the token fields
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	RefreshToken     string `json:"refresh_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+	// Interval is only sent when polling in the device flow, when github asks us to slow down
+	Interval int `json:"interval"`
+}
+
+// RefreshTokenSource is a TokenSource for oauth (and github app user-to-server) tokens that expire
+// it exchanges its refresh token for a new access token whenever the current one has expired, and keeps the new refresh token that github rotates in
+type RefreshTokenSource struct {
+	clientID     string
+	clientSecret string
+	client       *http.Client
+
+	mu           sync.Mutex
+	refreshToken string
+	accessToken  string
+	expiry       time.Time
+}
+
+// NewRefreshTokenSource creates a RefreshTokenSource for the oauth app identified by clientID and clientSecret
+// no request is made until the first call to Token
+func NewRefreshTokenSource(clientID, clientSecret, refreshToken string, client *http.Client) *RefreshTokenSource {
+	return &RefreshTokenSource{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		client:       client,
+		refreshToken: refreshToken,
+	}
+}
+
+// Token returns the current access token, refreshing it first if it has expired (or has never been obtained)
+func (s *RefreshTokenSource) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// an expiry of zero means that github did not say when the token expires, so it is used until it is rejected
+	if s.accessToken != "" && (s.expiry.IsZero() || time.Now().Before(s.expiry.Add(-expiryLeeway))) {
+		return s.accessToken, nil
+	}
+
+	tr, err := requestToken(s.client, url.Values{
+		"client_id":     {s.clientID},
+		"client_secret": {s.clientSecret},
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {s.refreshToken},
+	})
+	if err != nil {
+		return "", fmt.Errorf("Error refreshing oauth token: %w", err)
+	}
+	if tr.Error != "" {
+		return "", fmt.Errorf("Error refreshing oauth token: %v: %v", tr.Error, tr.ErrorDescription)
+	}
+
+	s.accessToken = tr.AccessToken
+	if tr.ExpiresIn > 0 {
+		s.expiry = time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second)
+	} else {
+		s.expiry = time.Time{}
+	}
+	// github rotates refresh tokens, the old one is no longer valid once it has been used
+	if tr.RefreshToken != "" {
+		redact.Secret(tr.RefreshToken)
+		s.refreshToken = tr.RefreshToken
+	}
+	return s.accessToken, nil
+}
+
+// requestToken POSTs form to github's access_token endpoint and decodes the response
+// the returned error is only for transport and decoding failures, github's own errors are reported in tokenResponse.Error
+func requestToken(client *http.Client, form url.Values) (tokenResponse, error) {
+	var tr tokenResponse
+
+	req, err := http.NewRequest("POST", oauthTokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return tr, fmt.Errorf("Error creating http POST request for %v: %w", oauthTokenURL, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// without this header github responds with a urlencoded body instead of json
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return tr, fmt.Errorf("Error sending http POST request to %v: %w", oauthTokenURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return tr, fmt.Errorf("Error from %v: %v", oauthTokenURL, resp.Status)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxTokenResponseBytes)).Decode(&tr); err != nil {
+		return tr, fmt.Errorf("Error decoding json response from %v: %w", oauthTokenURL, err)
+	}
+	return tr, nil
+}
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// StoredTokenPath returns the path of the file that `commitcron login` stores the token it obtains in
+func StoredTokenPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("Error finding user config directory: %w", err)
+	}
+	return filepath.Join(dir, "commitcron", "token"), nil
+}
+
+// SaveToken stores token so that it is used on later runs when no other credentials are configured
+// the file is only readable by the current user, since the token grants write access to repositories
+func SaveToken(token string) error {
+	path, err := StoredTokenPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("Error creating %v: %w", filepath.Dir(path), err)
+	}
+	if err := ioutil.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		return fmt.Errorf("Error writing token to %v: %w", path, err)
+	}
+	return nil
+}
+
+// LoadStoredToken returns the token stored by SaveToken, or "" if no token has been stored
+func LoadStoredToken() (string, error) {
+	path, err := StoredTokenPath()
+	if err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("Error reading stored token from %v: %w", path, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/anacanm/commitCron/redact"
+)
+
+// vaultResponse holds the necessary parts of responses from vault
+// reading a kv v1 secret puts its fields directly in Data, kv v2 nests them in Data["data"]
+type vaultResponse struct {
+	Data map[string]interface{} `json:"data"`
+	Auth struct {
+		ClientToken string `json:"client_token"`
+	} `json:"auth"`
+	Errors []string `json:"errors"`
+}
+
+// vaultToken reads the github token from the vault secret at GITHUB_TOKEN_VAULT_PATH on the server at VAULT_ADDR
+// vault itself (in the enterprise namespace VAULT_NAMESPACE, if it is set) is authenticated with VAULT_TOKEN, or by logging in with VAULT_ROLE_ID and VAULT_SECRET_ID using approle auth
+func vaultToken(settings Settings, client *http.Client, path string) (string, error) {
+	addr := strings.TrimSuffix(settings.get("VAULT_ADDR"), "/")
+	if addr == "" {
+		return "", fmt.Errorf("GITHUB_TOKEN_VAULT_PATH is set, but VAULT_ADDR is not")
+	}
+
+	vaultToken, namespace := settings.get("VAULT_TOKEN"), settings.get("VAULT_NAMESPACE")
+	if roleID, present := settings("VAULT_ROLE_ID"); present {
+		mount := settings.get("VAULT_APPROLE_MOUNT")
+		if mount == "" {
+			mount = "approle"
+		}
+		body, err := json.Marshal(map[string]string{"role_id": roleID, "secret_id": settings.get("VAULT_SECRET_ID")})
+		if err != nil {
+			return "", fmt.Errorf("Error marshalling vault approle login: %w", err)
+		}
+		login, err := vaultRequest(client, "POST", fmt.Sprintf("%v/v1/auth/%v/login", addr, mount), "", namespace, body)
+		if err != nil {
+			return "", err
+		}
+		vaultToken = login.Auth.ClientToken
+		redact.Secret(vaultToken)
+	}
+	if vaultToken == "" {
+		return "", fmt.Errorf("GITHUB_TOKEN_VAULT_PATH is set, but neither VAULT_TOKEN nor VAULT_ROLE_ID and VAULT_SECRET_ID are")
+	}
+
+	secret, err := vaultRequest(client, "GET", fmt.Sprintf("%v/v1/%v", addr, strings.TrimPrefix(path, "/")), vaultToken, namespace, nil)
+	if err != nil {
+		return "", err
+	}
+
+	key := settings.get("GITHUB_TOKEN_VAULT_KEY")
+	if key == "" {
+		key = "token"
+	}
+	fields := secret.Data
+	if nested, ok := fields["data"].(map[string]interface{}); ok {
+		// kv v2
+		fields = nested
+	}
+	token, ok := fields[key].(string)
+	if !ok || token == "" {
+		return "", fmt.Errorf("vault secret at %v has no %q field", path, key)
+	}
+	return token, nil
+}
+
+// vaultRequest sends a single request to vault (in the enterprise namespace, if it is not "") and decodes the response
+func vaultRequest(client *http.Client, method, url, token, namespace string, body []byte) (vaultResponse, error) {
+	var vr vaultResponse
+
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return vr, fmt.Errorf("Error creating http %v request for %v: %w", method, url, err)
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return vr, fmt.Errorf("Error sending http %v request to %v: %w", method, url, err)
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxTokenResponseBytes)).Decode(&vr); err != nil {
+		return vr, fmt.Errorf("Error decoding json response from %v: %w", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return vr, fmt.Errorf("Error from vault at %v: %v: %v", url, resp.Status, strings.Join(vr.Errors, ", "))
+	}
+	return vr, nil
+}
@@ -0,0 +1,156 @@
+package commitcron
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// dateLayout is the layout that days are written in, eg. in errors about the days to backfill
+const dateLayout = "2006-01-02"
+
+// Backdating is a set of backdated commits to the single account's repository, planned by PlanBackfill, PlanArt or PlanMirror, which Commit makes once they have been reviewed
+// since rewriting the past is not something to do by accident, nothing is committed until then
+type Backdating struct {
+	// Username and Repo are the account and repository that the commits are made to
+	Username string
+	Repo     string
+	// Dates is when each of the commits is dated, in order, and is empty if there is nothing to commit
+	Dates []time.Time
+	// runner is the Runner that planned the commits, whose options they are made with
+	runner *Runner
+	// commit makes the commits, the way the kind of backdating that planned them does
+	commit func(ctx context.Context) error
+}
+
+// Commit makes the planned commits, or nothing if none were planned
+func (b *Backdating) Commit(ctx context.Context) error {
+	if len(b.Dates) == 0 {
+		return nil
+	}
+	return b.commit(withRunner(ctx, b.runner))
+}
+
+// BackfillOptions are the days that PlanBackfill backfills, and how many commits it makes on each
+type BackfillOptions struct {
+	// From and To are the first and last days to backfill (inclusive)
+	From time.Time
+	To   time.Time
+	// PerDay is the range of commits to make each day, the number for each day is chosen at random from it
+	PerDay [2]int
+}
+
+// PlanBackfill plans backdated commits for each day from opts.From to opts.To, opts.PerDay of them on each day, eg. for someone migrating their history from a private
+// or enterprise instance. The commits are made with the git data api, each creating a new file, and dated at random during the working hours of their day (see WORKING_HOURS)
+// dates before the account was created or after today are refused
+func PlanBackfill(ctx context.Context, env Settings, opts BackfillOptions, tokenClient *http.Client) (*Backdating, error) {
+	return (&Runner{}).PlanBackfill(ctx, env, opts, tokenClient)
+}
+
+// PlanBackfill plans backdated commits as the package's PlanBackfill does, with the runner's options
+func (r *Runner) PlanBackfill(ctx context.Context, env Settings, opts BackfillOptions, tokenClient *http.Client) (*Backdating, error) {
+	ctx = withRunner(ctx, r)
+	if opts.To.Before(opts.From) {
+		return nil, fmt.Errorf("the last day (%v) is before the first (%v)", opts.To.Format(dateLayout), opts.From.Format(dateLayout))
+	}
+	if opts.To.After(currentTime(ctx)) {
+		return nil, fmt.Errorf("the last day (%v) is in the future, commits can only be backfilled up to today", opts.To.Format(dateLayout))
+	}
+	if opts.PerDay[0] < 0 || opts.PerDay[0] > opts.PerDay[1] {
+		return nil, fmt.Errorf("the range of commits per day must be non-negative, and its start must not be after its end, got %v-%v", opts.PerDay[0], opts.PerDay[1])
+	}
+
+	account, client, created, err := backfillAccount(ctx, r, env, tokenClient)
+	if err != nil {
+		return nil, err
+	}
+	if opts.From.Before(created) {
+		return nil, fmt.Errorf("the first day (%v) is before the account was created (%v)", opts.From.Format(dateLayout), created.Format(dateLayout))
+	}
+
+	commitOpts, err := loadCommitOptions(env)
+	if err != nil {
+		return nil, err
+	}
+	sel, err := loadSelection(env)
+	if err != nil {
+		return nil, err
+	}
+	commitOpts.Dates = BackfillDates(opts.From, opts.To, opts.PerDay, commitOpts.Times.WorkingHours, currentTime(ctx))
+	return backdated(r, account, client, sel, commitOpts), nil
+}
+
+// BackfillDates returns the dates of the commits to backfill on each day from from to to (inclusive), a number chosen at random from the range perDay on each day,
+// dated at random during hours (see WORKING_HOURS), and never after now, in order
+func BackfillDates(from, to time.Time, perDay [2]int, hours [2]int, now time.Time) []time.Time {
+	var dates []time.Time
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		n := perDay[0]
+		if perDay[1] > perDay[0] {
+			n += rand.Intn(perDay[1] - perDay[0] + 1)
+		}
+		dates = append(dates, dayDates(day, n, hours, now)...)
+	}
+	return dates
+}
+
+// backfillAccount returns the single account that backdated commits may be made for, its client, and the day it was created on, before which nothing may be backdated
+// its client is sent with runner's options (see Account.newClient)
+func backfillAccount(ctx context.Context, runner *Runner, env Settings, tokenClient *http.Client) (Account, *http.Client, time.Time, error) {
+	accounts, err := loadAccounts(env)
+	if err != nil {
+		return Account{}, nil, time.Time{}, err
+	}
+	if len(accounts) != 1 || len(accounts[0].repos()) != 1 {
+		return Account{}, nil, time.Time{}, fmt.Errorf("backdated commits can only be made for a single account and repository, set GITHUB_USERNAME and REPO_NAME")
+	}
+	account := accounts[0]
+	account.Repo = account.repos()[0]
+	client, err := account.newClient(runner, env, tokenClient)
+	if err != nil {
+		return account, nil, time.Time{}, fmt.Errorf("Error configuring github credentials: %w", err)
+	}
+
+	var user struct {
+		CreatedAt time.Time `json:"created_at"`
+	}
+	if err := jsonRequest(ctx, client, "GET", "https://api.github.com/user", nil, &user); err != nil {
+		return account, nil, time.Time{}, fmt.Errorf("Error finding when the account was created: %w", err)
+	}
+	created := user.CreatedAt.In(time.Local)
+	return account, client, time.Date(created.Year(), created.Month(), created.Day(), 0, 0, 0, 0, time.Local), nil
+}
+
+// dayDates returns the dates of n commits made on day, at random during hours, and never after the end of the day, or now
+// each day is planned in full, so every commit is dated before the end of its day
+func dayDates(day time.Time, n int, hours [2]int, now time.Time) []time.Time {
+	endOfDay := day.AddDate(0, 0, 1).Add(-time.Second)
+	if endOfDay.After(now) {
+		endOfDay = now
+	}
+	return commitTimes{Spread: true, WorkingHours: hours}.dates(n, endOfDay)
+}
+
+// backdated returns the Backdating, planned by runner, that commits each of opts.Dates to the account's repository with the git data api, each creating a new file
+func backdated(runner *Runner, account Account, client *http.Client, sel Selection, opts commitOptions) *Backdating {
+	opts.FilesPerCommit = 1
+	return &Backdating{Username: account.Username, Repo: account.Repo, Dates: opts.Dates, runner: runner, commit: func(ctx context.Context) error {
+		repoURL := fmt.Sprintf("https://api.github.com/repos/%v/%v", account.Username, account.Repo)
+		if sel.Branch != "" {
+			if err := ensureBranch(ctx, repoURL, sel.Branch, "", client); err != nil {
+				return err
+			}
+		}
+		contents, err := addNewFiles(make([]RepoContent, 0, len(opts.Dates)), sel, contentsFileReader(ctx, repoURL+"/contents", sel.Branch, client), contentsDirLister(ctx, repoURL+"/contents", sel.Branch, client), currentTime(ctx))
+		if err != nil {
+			return err
+		}
+		updates, err := prepareUpdates(ctx, contents, sel, opts)
+		if err != nil {
+			return err
+		}
+		return uploadGitData(ctx, repoURL, sel.Branch, updates, opts, client)
+	}}
+}
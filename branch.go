@@ -0,0 +1,50 @@
+package commitcron
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// ensureBranch creates branch in the repository with the api url repoURL from the head of the branch from (or the default branch, if from is ""), if it does not exist yet
+// an empty repository has no commit to create a branch from, so it can't be given any branch until it has one
+func ensureBranch(ctx context.Context, repoURL string, branch string, from string, client *http.Client) error {
+	exists, err := branchExists(ctx, repoURL, branch, client)
+	if err != nil || exists {
+		return err
+	}
+
+	if from == "" {
+		var repo gitDataObject
+		if err := jsonRequest(ctx, client, "GET", repoURL, nil, &repo); err != nil {
+			return err
+		}
+		from = repo.DefaultBranch
+	}
+	var head gitDataObject
+	if err := jsonRequest(ctx, client, "GET", fmt.Sprintf("%v/git/ref/heads/%v", repoURL, from), nil, &head); err != nil {
+		return fmt.Errorf("Error creating branch %v from %v (a branch can't be created in an empty repository): %w", branch, from, err)
+	}
+	return jsonRequest(ctx, client, "POST", repoURL+"/git/refs", map[string]string{"ref": "refs/heads/" + branch, "sha": head.Object.SHA}, nil)
+}
+
+// branchExists reports whether branch exists in the repository with the api url repoURL
+func branchExists(ctx context.Context, repoURL string, branch string, client *http.Client) (bool, error) {
+	var ref gitDataObject
+	err := jsonRequest(ctx, client, "GET", fmt.Sprintf("%v/git/ref/heads/%v", repoURL, branch), nil, &ref)
+	if isStatus(err, http.StatusNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("Error finding branch %v: %w", branch, err)
+	}
+	return true, nil
+}
+
+// deleteBranch deletes branch from the repository with the api url repoURL
+func deleteBranch(ctx context.Context, repoURL string, branch string, client *http.Client) error {
+	if err := jsonRequest(ctx, client, "DELETE", fmt.Sprintf("%v/git/refs/heads/%v", repoURL, branch), nil, nil); err != nil {
+		return fmt.Errorf("Error deleting branch %v: %w", branch, err)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+//go:build js && wasm
+
+// commitcron-wasm is the part of commitcron that runs in a browser: it previews contribution graph designs, and plans runs, without making any commits,
+// for a web page to load with wasm_exec.js, which then calls the functions that it sets on the global object:
+//
+//	commitcronPattern(source, input, invert) returns {pattern, days, preview} for the design, or {error}, source is pattern (input is its text, see commitcron.ParsePattern),
+//	text (input is the text to spell) or image (input is a Uint8Array of a png or gif)
+//	commitcronPlan(settings) returns a promise of the plans (see commitcron.Plan) for the settings, an object of the environment variables that the README documents
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"syscall/js"
+
+	commitcron "github.com/anacanm/commitCron"
+)
+
+func main() {
+	js.Global().Set("commitcronPattern", js.FuncOf(pattern))
+	js.Global().Set("commitcronPlan", js.FuncOf(plan))
+	// the functions are called for as long as the page is open, so the program must not exit
+	select {}
+}
+
+// pattern returns the design that args (source, input, invert) describe, see commitcronPattern
+func pattern(this js.Value, args []js.Value) interface{} {
+	if len(args) < 2 {
+		return result(nil, fmt.Errorf("commitcronPattern needs a source and an input"))
+	}
+	var p commitcron.Pattern
+	var err error
+	switch source := args[0].String(); source {
+	case "pattern":
+		p, err = commitcron.ParsePattern(args[1].String())
+	case "text":
+		p, err = commitcron.TextPattern(args[1].String())
+	case "image":
+		data := make([]byte, args[1].Get("length").Int())
+		js.CopyBytesToGo(data, args[1])
+		p, err = commitcron.DecodeImagePattern(bytes.NewReader(data), len(args) > 2 && args[2].Truthy())
+	default:
+		err = fmt.Errorf("%q is not a source, must be pattern, text or image", source)
+	}
+	if err != nil {
+		return result(nil, err)
+	}
+	return result(map[string]interface{}{"pattern": p.String(), "days": p, "preview": p.Preview()}, nil)
+}
+
+// plan returns a promise of the plans for the settings in args[0], see commitcronPlan
+// the requests that planning makes are sent with the browser's fetch, and only read, so planning changes nothing in the repository
+func plan(this js.Value, args []js.Value) interface{} {
+	env := commitcron.Settings{}
+	if len(args) > 0 && args[0].Type() == js.TypeObject {
+		keys := js.Global().Get("Object").Call("keys", args[0])
+		for i := 0; i < keys.Length(); i++ {
+			key := keys.Index(i).String()
+			env[key] = args[0].Get(key).String()
+		}
+	}
+	return js.Global().Get("Promise").New(js.FuncOf(func(this js.Value, promise []js.Value) interface{} {
+		resolve, reject := promise[0], promise[1]
+		// a promise's executor must not block, and the requests can only complete once it has returned to the browser's event loop
+		go func() {
+			cfg, err := commitcron.ConfigFromSettings(env)
+			if err != nil {
+				reject.Invoke(err.Error())
+				return
+			}
+			plans, err := commitcron.NewPlanner(cfg).Plan(context.Background())
+			if err != nil {
+				reject.Invoke(err.Error())
+				return
+			}
+			resolve.Invoke(result(plans, nil))
+		}()
+		return nil
+	}))
+}
+
+// result converts v to a javascript value by way of its json encoding, or if err is not nil, to an object with only its error
+func result(v interface{}, err error) js.Value {
+	if err == nil {
+		var data []byte
+		if data, err = json.Marshal(v); err == nil {
+			return js.Global().Get("JSON").Call("parse", string(data))
+		}
+	}
+	return js.ValueOf(map[string]interface{}{"error": err.Error()})
+}
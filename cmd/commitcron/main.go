@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/anacanm/commitCron/internal/cli"
+)
+
+func main() {
+	cli.Main(os.Args[1:])
+}
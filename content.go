@@ -0,0 +1,400 @@
+package commitcron
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"math/rand"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+)
+
+// contentOptions configures the content that changed files are given
+type contentOptions struct {
+	// Mode is files (the default), which changes files chosen from the repository and creates new ones, journal, in which each change adds an entry to a journal instead,
+	// changelog, in which each change adds an entry to the day's section of a changelog,
+	// or recreate, in which the changes alternate between deleting a single file and creating it again, so that the repository never grows
+	Mode string
+	// JournalLayout is single (the default) for a single JOURNAL.md, or daily for a file for each day, see journalFile
+	JournalLayout string
+	// JournalEntry generates the entries that are added to the journal or changelog
+	JournalEntry *template.Template
+	// Insert is where the change to an existing file is inserted into it:
+	// append (the default) adds it to the end of the file, prepend adds it to the start (after any shebang or license header),
+	// random-line adds it at a random line that it can safely be added at, and replace replaces the whole file with it, as used to be the only option
+	Insert string
+	// Formatters are the commands that the content of files with each extension (eg. ".py") is formatted with, as the program followed by its arguments
+	// the content is written to the command's standard input, and replaced with its standard output
+	Formatters map[string][]string
+	// Template, if it is not nil, generates the content that new files are created with, in place of stub
+	Template *template.Template
+	// ExtensionTemplates generate the content of new files with their extension (eg. ".md"), in place of Template
+	ExtensionTemplates map[string]*template.Template
+}
+
+// contentTemplateEnv is the environment variable that the path of the template for the content of new files is read from, the paths of templates for the files
+// of a single extension are read from the same variable, suffixed with the extension, as with commit message templates (eg. CONTENT_TEMPLATE_MD for .md files)
+const contentTemplateEnv = "CONTENT_TEMPLATE"
+
+// contentData is what content templates can reference, eg. "# TIL {{.Date.Format "2006-01-02"}}\n\n{{quote}}\n"
+type contentData struct {
+	FileName string
+	Path     string
+	Date     time.Time
+	// Counter counts the changes made in the run, starting from 1
+	Counter int
+	// Comment is the comment that the file would otherwise be created with, in the syntax of its extension
+	Comment string
+}
+
+// quotes are what {{quote}} picks from in content templates
+var quotes = []string{
+	"Simplicity is prerequisite for reliability. - Edsger W. Dijkstra",
+	"Programs must be written for people to read, and only incidentally for machines to execute. - Harold Abelson",
+	"Premature optimization is the root of all evil. - Donald Knuth",
+	"Make it work, make it right, make it fast. - Kent Beck",
+	"The best way to get a project done faster is to start sooner. - Jim Highsmith",
+	"Clear is better than clever. - Rob Pike",
+	"Talk is cheap. Show me the code. - Linus Torvalds",
+	"Any fool can write code that a computer can understand. Good programmers write code that humans can understand. - Martin Fowler",
+	"First, solve the problem. Then, write the code. - John Johnson",
+	"Deleted code is debugged code. - Jeff Sickel",
+	"Walking on water and developing software from a specification are easy if both are frozen. - Edward V. Berard",
+	"A little copying is better than a little dependency. - Rob Pike",
+}
+
+// formatCommandEnv is the prefix of the environment variables that the formatter for the files of each extension is read from, suffixed with the extension,
+// as with commit message templates (eg. FORMAT_COMMAND_PY for .py files)
+const formatCommandEnv = "FORMAT_COMMAND_"
+
+// loadContentOptions reads the contentOptions from the environment
+func loadContentOptions(env Settings) (contentOptions, error) {
+	opts := contentOptions{Mode: "files", JournalLayout: "single", Insert: "append", Formatters: map[string][]string{}, ExtensionTemplates: map[string]*template.Template{}}
+	if m, present := env.lookup("CONTENT_MODE"); present {
+		switch m {
+		case "files", "journal", "changelog", "recreate":
+			opts.Mode = m
+		default:
+			return opts, fmt.Errorf("Error parsing CONTENT_MODE: must be files, journal, changelog or recreate, got %q", m)
+		}
+	}
+	if l, present := env.lookup("JOURNAL_LAYOUT"); present {
+		switch l {
+		case "single", "daily":
+			opts.JournalLayout = l
+		default:
+			return opts, fmt.Errorf("Error parsing JOURNAL_LAYOUT: must be single or daily, got %q", l)
+		}
+	}
+	if s, present := env.lookup("INSERT_STRATEGY"); present {
+		switch s {
+		case "append", "prepend", "random-line", "replace":
+			opts.Insert = s
+		default:
+			return opts, fmt.Errorf("Error parsing INSERT_STRATEGY: must be append, prepend, random-line or replace, got %q", s)
+		}
+	}
+	for name, value := range env {
+		if !strings.HasPrefix(name, formatCommandEnv) {
+			continue
+		}
+		command := strings.Fields(value)
+		if len(command) == 0 {
+			continue
+		}
+		opts.Formatters["."+strings.ToLower(strings.Replace(strings.TrimPrefix(name, formatCommandEnv), "_", ".", -1))] = command
+	}
+	// content is usually several lines long, so unlike commit message templates, content templates are read from files, and the variables hold their paths
+	funcs := template.FuncMap{
+		"words": randomWords,
+		"quote": func() string { return quotes[rand.Intn(len(quotes))] },
+	}
+	entry, present := env.lookup("JOURNAL_ENTRY")
+	switch {
+	case present:
+	case opts.Mode == "changelog":
+		entry = defaultChangelogEntry
+	case opts.JournalLayout == "daily":
+		entry = defaultDailyJournalEntry
+	default:
+		entry = defaultJournalEntry
+	}
+	var err error
+	opts.JournalEntry, err = template.New("JOURNAL_ENTRY").Funcs(funcs).Parse(entry)
+	if err != nil {
+		return opts, fmt.Errorf("Error parsing JOURNAL_ENTRY: %w", err)
+	}
+	for name, value := range env {
+		if !strings.HasPrefix(name, contentTemplateEnv) {
+			continue
+		}
+		text, err := ioutil.ReadFile(value)
+		if err != nil {
+			return opts, fmt.Errorf("Error reading %v: %w", name, err)
+		}
+		t, err := template.New(name).Funcs(funcs).Parse(string(text))
+		if err != nil {
+			return opts, fmt.Errorf("Error parsing %v: %w", name, err)
+		}
+		if name == contentTemplateEnv {
+			opts.Template = t
+		} else if suffix := strings.TrimPrefix(name, contentTemplateEnv+"_"); suffix != name {
+			opts.ExtensionTemplates["."+strings.ToLower(strings.Replace(suffix, "_", ".", -1))] = t
+		}
+	}
+	return opts, nil
+}
+
+// created returns the content that the new file (the counter-th change of the run) is created with: generated by the template for its extension,
+// or failing that, the template for all files, or failing that, stub (see stub for change and siblings)
+func (o contentOptions) created(file RepoContent, rule ExtensionRule, change string, counter int, siblings []RepoContent, now time.Time) ([]byte, error) {
+	t, ok := o.ExtensionTemplates[rule.Extension]
+	if !ok {
+		t = o.Template
+	}
+	if t == nil {
+		return []byte(stub(file, change, siblings)), nil
+	}
+	var b bytes.Buffer
+	err := t.Execute(&b, contentData{FileName: file.Name, Path: file.Path, Date: now, Counter: counter, Comment: change})
+	if err != nil {
+		return nil, fmt.Errorf("Error generating content for %v: %w", file.Path, err)
+	}
+	return b.Bytes(), nil
+}
+
+// format returns content formatted as the file's language is conventionally formatted, so that changing it doesn't trip the repository's formatting linters:
+// go files are formatted with gofmt's rules, and files with an extension in o.Formatters with its command
+// original is the file's content before it was changed, a go file that wasn't formatted before is left as it was, so that the rest of it isn't reformatted along with the change
+// content that can't be formatted (eg. it doesn't parse) is uploaded as it is, with a warning
+func (o contentOptions) format(ctx context.Context, file RepoContent, rule ExtensionRule, original, content []byte) []byte {
+	if command, ok := o.Formatters[rule.Extension]; ok {
+		cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+		cmd.Stdin = bytes.NewReader(content)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			logger(ctx).Warn("Can't format a file, uploading it unformatted", "path", file.Path, "command", command[0], "err", err, "stderr", strings.TrimSpace(stderr.String()))
+			return content
+		}
+		return out
+	}
+	if !strings.HasSuffix(file.Name, ".go") {
+		return content
+	}
+	if original != nil {
+		if formatted, err := format.Source(original); err != nil || !bytes.Equal(formatted, original) {
+			return content
+		}
+	}
+	formatted, err := format.Source(content)
+	if err != nil {
+		logger(ctx).Warn("Can't format a file, uploading it unformatted", "path", file.Path, "err", err)
+		return content
+	}
+	return formatted
+}
+
+// insert returns content with change (one or more lines, without a trailing newline) inserted into it as strategy says, in the syntax of rule
+// the existing content is otherwise left exactly as it was, including its line endings
+func insert(content []byte, change string, strategy string, rule ExtensionRule) []byte {
+	if strategy == "replace" || len(content) == 0 {
+		return []byte(change)
+	}
+	newline := "\n"
+	if bytes.Contains(content, []byte("\r\n")) {
+		newline = "\r\n"
+	}
+	change = strings.Replace(change, "\n", newline, -1)
+
+	text := string(content)
+	trailing := strings.HasSuffix(text, newline)
+	lines := strings.Split(strings.TrimSuffix(text, newline), newline)
+	at := len(lines)
+	switch strategy {
+	case "prepend":
+		at = headerLength(lines, rule)
+	case "random-line":
+		at = randomSafeLine(lines, rule)
+	}
+
+	result := make([]string, 0, len(lines)+1)
+	result = append(result, lines[:at]...)
+	result = append(result, change)
+	// a change inserted before other lines is separated from them by a blank line, so that it doesn't become part of eg. the doc comment of whatever follows it
+	if at < len(lines) {
+		result = append(result, "")
+	}
+	result = append(result, lines[at:]...)
+	joined := strings.Join(result, newline)
+	// a file that ended in a newline still does, and one that didn't is given one when the change is appended to it, since the change is a line of its own
+	if trailing || at == len(lines) {
+		joined += newline
+	}
+	return []byte(joined)
+}
+
+// headerLength returns the number of lines at the start of lines that nothing should be inserted before:
+// a shebang (which must be the first line to work), followed by a license header, ie. a block of comments in the syntax of rule, along with the blank lines after it
+func headerLength(lines []string, rule ExtensionRule) int {
+	i := 0
+	if len(lines) > 0 && strings.HasPrefix(lines[0], "#!") {
+		i++
+	}
+	// a header may be a /* */ block comment in languages with // comments, as well as a run of line comments
+	if rule.CommentPrefix == "//" && i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), "/*") {
+		for i < len(lines) && !strings.Contains(lines[i], "*/") {
+			i++
+		}
+		if i < len(lines) {
+			i++
+		}
+	}
+	for i < len(lines) && isComment(lines[i], rule) {
+		i++
+	}
+	for i < len(lines) && strings.TrimSpace(lines[i]) == "" {
+		i++
+	}
+	return i
+}
+
+// randomSafeLine returns the index of a line, after the header, that a whole line comment can be inserted before without changing what the file means, chosen at random
+// I can't parse every language, so a line is only considered safe if it follows a blank line and isn't indented, ie. it starts a new top level block,
+// which is very unlikely to be inside a multi line string or comment, if there are no such lines, the comment is appended at the end of the file
+func randomSafeLine(lines []string, rule ExtensionRule) int {
+	var safe []int
+	for i := headerLength(lines, rule) + 1; i < len(lines); i++ {
+		line := lines[i]
+		if strings.TrimSpace(lines[i-1]) == "" && strings.TrimSpace(line) != "" && strings.TrimLeft(line, " \t") == line {
+			safe = append(safe, i)
+		}
+	}
+	if len(safe) == 0 {
+		return len(lines)
+	}
+	return safe[rand.Intn(len(safe))]
+}
+
+// isComment reports whether line is a comment in the syntax of rule, on its own
+func isComment(line string, rule ExtensionRule) bool {
+	line = strings.TrimSpace(line)
+	if rule.CommentSuffix != "" {
+		return strings.HasPrefix(line, rule.CommentPrefix) && strings.HasSuffix(line, rule.CommentSuffix)
+	}
+	return strings.HasPrefix(line, rule.CommentPrefix)
+}
+
+// stub returns the content that the new file is created with: change, as part of a minimal, valid file for the file's language where a comment alone isn't one,
+// so that creating it doesn't break the build (or CI) of the repository it is created in
+// siblings are the other files being changed, which go files take their package name from if there are no go files in their directory already (see goPackage)
+func stub(file RepoContent, change string, siblings []RepoContent) string {
+	name := strings.TrimSuffix(file.Name, path.Ext(file.Name))
+	switch path.Ext(file.Name) {
+	case ".go":
+		pkg, existing := goPackage(file, siblings)
+		// a main package must declare main, or it doesn't build, so the first file of a new main package declares it, and the others are only in the package
+		if pkg == "main" && !existing && firstNewGoFile(file, siblings) {
+			return fmt.Sprintf("%v\n\npackage main\n\nfunc main() {}\n", change)
+		}
+		return fmt.Sprintf("%v\n\npackage %v\n", change, pkg)
+	case ".py":
+		// a module docstring is what a python module with nothing in it is expected to have, and the change is a comment after it
+		return fmt.Sprintf("\"\"\"%v\"\"\"\n\n%v\n", name, change)
+	case ".sh", ".bash":
+		return fmt.Sprintf("#!/bin/sh\n%v\n", change)
+	case ".md", ".markdown":
+		return fmt.Sprintf("# %v\n\n%v\n", name, change)
+	case ".html", ".htm":
+		return fmt.Sprintf("<!DOCTYPE html>\n<title>%v</title>\n%v\n", name, change)
+	case ".json":
+		// json has no comments at all, so the file is an object that holds the change as a string instead
+		data, _ := json.Marshal(map[string]string{"note": change})
+		return string(data) + "\n"
+	}
+	return change + "\n"
+}
+
+// goPackage returns the name of the package that the new go file must be declared in, and whether the package already exists:
+// that of the go files already in its directory (see addNewFiles), or of those among files, which are being changed along with it,
+// otherwise the name of its directory (as an identifier), or main in the root directory of the repository
+func goPackage(file RepoContent, files []RepoContent) (string, bool) {
+	if file.pkg != "" {
+		return file.pkg, true
+	}
+	dir := path.Dir(file.Path)
+	for _, f := range files {
+		if f.SHA == "" || path.Dir(f.Path) != dir || !strings.HasSuffix(f.Name, ".go") || strings.HasSuffix(f.Name, "_test.go") {
+			continue
+		}
+		if pkg := goPackageClause(f.Content); pkg != "" {
+			return pkg, true
+		}
+	}
+	if dir == "." || dir == "/" || dir == "" {
+		return "main", false
+	}
+	var name strings.Builder
+	for _, r := range strings.ToLower(path.Base(dir)) {
+		if r == '_' || unicode.IsLetter(r) || (unicode.IsDigit(r) && name.Len() > 0) {
+			name.WriteRune(r)
+		}
+	}
+	if name.Len() == 0 {
+		return "main", false
+	}
+	return name.String(), false
+}
+
+// firstNewGoFile reports whether file is the first of the go files being created in its directory, among files
+func firstNewGoFile(file RepoContent, files []RepoContent) bool {
+	for _, f := range files {
+		if f.SHA == "" && path.Dir(f.Path) == path.Dir(file.Path) && path.Ext(f.Name) == ".go" {
+			return f.Path == file.Path
+		}
+	}
+	return true
+}
+
+// existingGoPackage returns the name of the package that the go files directly in the repository's directory dir are declared in, which list lists and read reads,
+// or "" if there are none, test files are skipped, since they may be declared in the package's external test package
+func existingGoPackage(read repoFileReader, list repoDirLister, dir string) (string, error) {
+	paths, err := list(dir, ".go")
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		if strings.HasSuffix(p, "_test.go") {
+			continue
+		}
+		data, found, err := read(p)
+		if err != nil {
+			return "", fmt.Errorf("Error reading the package of %v: %w", p, err)
+		}
+		if pkg := goPackageClause(data); found && pkg != "" {
+			return pkg, nil
+		}
+	}
+	return "", nil
+}
+
+// goPackageClause returns the name of the package that the go source src is declared in, or "" if it has no package clause
+func goPackageClause(src []byte) string {
+	f, err := parser.ParseFile(token.NewFileSet(), "", src, parser.PackageClauseOnly)
+	if err != nil {
+		return ""
+	}
+	return f.Name.Name
+}
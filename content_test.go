@@ -0,0 +1,61 @@
+package commitcron
+
+import (
+	"context"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func TestNewGoFilePackage(t *testing.T) {
+	cases := []struct {
+		name  string
+		env   Settings
+		files map[string][]byte
+		// want is the package that every new go file must be declared in, and main whether one of them must declare func main
+		want string
+		main bool
+	}{
+		{"root with a main package", Settings{}, map[string][]byte{"main.go": []byte("package main\n\nfunc main() {}\n")}, "main", false},
+		{"root with a library package", Settings{}, map[string][]byte{"lib.go": []byte("// Package lib\npackage lib\n"), "lib_test.go": []byte("package lib_test\n")}, "lib", false},
+		{"root without go files", Settings{}, map[string][]byte{"README.txt": []byte("readme\n")}, "main", true},
+		{"directory with a package", Settings{"GENERATED_DIR": "internal/gen"}, map[string][]byte{"internal/gen/a.go": []byte("package generated\n"), "go.mod": []byte("module x\n")}, "generated", false},
+		{"new directory", Settings{"GENERATED_DIR": "internal/new-stuff"}, map[string][]byte{"go.mod": []byte("module x\n")}, "newstuff", false},
+	}
+	for _, c := range cases {
+		env := Settings{"FILE_EXTENSIONS": ".go"}
+		for name, value := range c.env {
+			env[name] = value
+		}
+		sel, opts := testPlanOptions(t, env)
+		repo := &fakeRepo{files: c.files}
+		plan, err := planChanges(context.Background(), Account{Username: "user", Repo: "repo"}, fakeCounter{}, repo, sel, opts, 3, 1)
+		if err != nil {
+			t.Fatalf("%v: planChanges = %v, want nil", c.name, err)
+		}
+		created, mains := 0, 0
+		for _, change := range plan.Changes {
+			if change.Action != "create" {
+				continue
+			}
+			created++
+			f, err := parser.ParseFile(token.NewFileSet(), change.Path, change.Content, 0)
+			if err != nil {
+				t.Fatalf("%v: %v doesn't parse: %v", c.name, change.Path, err)
+			}
+			if f.Name.Name != c.want {
+				t.Errorf("%v: %v is declared in package %v, want %v", c.name, change.Path, f.Name.Name, c.want)
+			}
+			if strings.Contains(change.Content, "func main()") {
+				mains++
+			}
+		}
+		if created == 0 {
+			t.Fatalf("%v: no files were planned to be created", c.name)
+		}
+		if want := map[bool]int{true: 1, false: 0}[c.main]; mains != want {
+			t.Errorf("%v: %v new files declare func main, want %v", c.name, mains, want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package contributions
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Cache caches the counts of Services for a while, by backend, user and day, so that a program that counts the same user's contributions repeatedly
+// (eg. for each of the user's repositories, or every few minutes) doesn't spend its rate limit on them
+// it is safe for concurrent use, and may be shared between Services (eg. one for each account's client), and while a count is being queried, any other Count of it waits for it,
+// rather than querying it as well
+type Cache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[cacheKey]*cacheEntry
+}
+
+// NewCache returns a Cache that keeps each count for ttl, by the clock of the Service that counted it
+// errors are never cached, the next Count queries the backend again
+func NewCache(ttl time.Duration) *Cache {
+	return &Cache{ttl: ttl, entries: map[cacheKey]*cacheEntry{}}
+}
+
+// cacheKey identifies a count, the day is formatted as 2006-01-02, in local time
+type cacheKey struct {
+	backend  Backend
+	username string
+	day      string
+}
+
+// cacheEntry is a count, or one that is still being queried until done is closed
+type cacheEntry struct {
+	done    chan struct{}
+	count   int
+	err     error
+	fetched time.Time
+}
+
+// get returns the count for key, if it was fetched less than the cache's ttl before now, or waits for it if it is being fetched already,
+// and otherwise fetches it with fetch
+// if the fetch that it waited for fails, it fetches the count itself, since the failure may well have been the other fetch's own (eg. its context was cancelled)
+func (c *Cache) get(ctx context.Context, key cacheKey, now time.Time, fetch func() (int, error)) (int, error) {
+	c.mu.Lock()
+	for {
+		e, ok := c.entries[key]
+		if !ok {
+			break
+		}
+		select {
+		case <-e.done:
+			if now.Sub(e.fetched) < c.ttl {
+				c.mu.Unlock()
+				return e.count, nil
+			}
+		default:
+			c.mu.Unlock()
+			select {
+			case <-e.done:
+				if e.err == nil {
+					return e.count, nil
+				}
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			}
+			c.mu.Lock()
+			continue
+		}
+		break
+	}
+	// counts that have expired are dropped whenever another is fetched, so that a long running program doesn't keep every day it has ever counted
+	for k, e := range c.entries {
+		select {
+		case <-e.done:
+			if now.Sub(e.fetched) >= c.ttl {
+				delete(c.entries, k)
+			}
+		default:
+		}
+	}
+	e := &cacheEntry{done: make(chan struct{}), fetched: now}
+	c.entries[key] = e
+	c.mu.Unlock()
+
+	e.count, e.err = fetch()
+	c.mu.Lock()
+	if e.err != nil && c.entries[key] == e {
+		delete(c.entries, key)
+	}
+	c.mu.Unlock()
+	close(e.done)
+	return e.count, e.err
+}
@@ -0,0 +1,94 @@
+package contributions
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Levels of the contribution graph, in the order of the shades github draws them in, from no contributions to the darkest shade
+var Levels = []string{"NONE", "FIRST_QUARTILE", "SECOND_QUARTILE", "THIRD_QUARTILE", "FOURTH_QUARTILE"}
+
+// CalendarDay is a single day of the contribution graph
+type CalendarDay struct {
+	// Date is formatted as 2006-01-02
+	Date  string `json:"date"`
+	Count int    `json:"contributionCount"`
+	// Level is one of Levels, which github buckets the day's count into relative to the user's other days
+	Level string `json:"contributionLevel"`
+}
+
+// LevelIndex returns the index of the day's level in Levels, 0 for none to 4 for the darkest shade, or -1 if github reports a level that is not known
+func (d CalendarDay) LevelIndex() int {
+	for i, level := range Levels {
+		if d.Level == level {
+			return i
+		}
+	}
+	return -1
+}
+
+// calendarQuery queries the days of the contribution graph that github currently shows for a user, the last year's
+const calendarQuery = `query($login: String!) {
+	user(login: $login) {
+		contributionsCollection {
+			contributionCalendar {
+				weeks { contributionDays { date contributionCount contributionLevel } }
+			}
+		}
+	}
+}`
+
+// GetCalendar returns the days of the contribution graph that github currently shows for username, in order, the last of which is today
+// requires client to authorize its requests with a token, the graphql api can't be used without one
+func GetCalendar(ctx context.Context, client *http.Client, username string) ([]CalendarDay, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"query":     calendarQuery,
+		"variables": map[string]string{"login": username},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling data into request body: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.github.com/graphql", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("Error creating request for the contribution calendar: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Error querying the contribution calendar: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Contribution calendar query failed: %v", resp.Status)
+	}
+
+	var result struct {
+		Data struct {
+			User struct {
+				ContributionsCollection struct {
+					ContributionCalendar struct {
+						Weeks []struct {
+							ContributionDays []CalendarDay `json:"contributionDays"`
+						} `json:"weeks"`
+					} `json:"contributionCalendar"`
+				} `json:"contributionsCollection"`
+			} `json:"user"`
+		} `json:"data"`
+		Errors []message `json:"errors"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(&result); err != nil {
+		return nil, fmt.Errorf("Error in decoding json from response body: %w", err)
+	}
+	// the graphql api reports errors in a successful response
+	if len(result.Errors) > 0 {
+		return nil, fmt.Errorf("Contribution calendar query failed: %v", result.Errors[0].Message)
+	}
+	var days []CalendarDay
+	for _, week := range result.Data.User.ContributionsCollection.ContributionCalendar.Weeks {
+		days = append(days, week.ContributionDays...)
+	}
+	return days, nil
+}
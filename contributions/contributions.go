@@ -1,22 +1,44 @@
-// Package contributions provides convenient access to the number of contributions the authenticated user has made today
-// requires 2 environment variables to work: GITHUB_USERNAME=your github username, and GITHUB_API_TOKEN=a github personal access api token that you create
-// create the token here: https://github.com/settings/tokens and make sure to give it full access to the "repo" scope. This is needed so that contributions to
+// Package contributions provides convenient access to the number of contributions the authenticated user has made today, see Service, and Cache to cache them
+// requires the http.Client that the Service is given to authorize its requests (eg. with auth.Transport) using a github personal access api token that you create here: https://github.com/settings/tokens. Make sure to give it full access to the "repo" scope. This is needed so that contributions to
 // private repositories are counted
 package contributions
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"os"
-
+	"io"
 	"net/http"
 	"time"
 )
 
-// ContributionItem is a simple struct to hold the number of contributions and an error that are sent in the channel of GetNumberOfContributionsToday
-type ContributionItem struct {
-	NumberContributions int
-	Err                 error
+// Service counts contributions with the github api
+type Service struct {
+	// Client sends every request, and must authorize them with a token, so that contributions to private repositories are counted
+	// tokens can be created here: https://github.com/settings/tokens, the token needs full access to the repo scope
+	Client *http.Client
+	// Now returns the current time, which decides which day today is, if it is nil, time.Now is used
+	Now func() time.Time
+	// Backend is the api that contributions are counted with, if it is "", Events is used
+	Backend Backend
+	// Cache caches the counts, if it is nil, every Count queries the api
+	Cache *Cache
+}
+
+// Backend is an api that a Service can count contributions with
+type Backend string
+
+const (
+	// Events counts the contributions in the user's most recent events, which works without a token (for public contributions only),
+	// but is only an estimate of what github counts, from the events that usually make up contributions
+	Events Backend = "events"
+	// GraphQL reads the count from the contribution calendar (see GetCalendar), which is exactly what the contribution graph shows, but requires a token
+	GraphQL Backend = "graphql"
+)
+
+// NewService returns a Service that sends its requests with client
+func NewService(client *http.Client) *Service {
+	return &Service{Client: client}
 }
 
 // Event is used to hold the relevant unmarshalled data returned from the github events api
@@ -36,15 +58,28 @@ type Event struct {
 	} `json:"repo"`
 }
 
+// maxResponseBytes is the ceiling on how much of a github api response body will be read before it is decoded
+// the events api returns at most 30 events per page and the repos api returns a single repository, so neither should ever come close to this size.
+// anything larger indicates that something (eg. a misbehaving proxy) has gone wrong, and decoding will fail instead of ballooning memory
+const maxResponseBytes = 5 << 20
+
 // message is a struct to Unmarshal the json response into when accessing the github repos api
 type message struct {
 	Message string `json:"message"`
 }
 
-// sameDay returns true if the other Time (in this case, the git push time), occured on the same day as it currently is
-func sameDay(other time.Time) bool {
+// now returns the current time by the service's clock
+func (s *Service) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+// sameDay returns true if the other Time (in this case, the git push time), occured on the same day as now
+func sameDay(other time.Time, now time.Time) bool {
 	// convert both times to local, since the github profile page reflects commits according to your local time
-	thisYear, thisMonth, thisDay := time.Now().Date()
+	thisYear, thisMonth, thisDay := now.Local().Date()
 	otherYear, otherMonth, otherDay := other.Local().Date()
 	if thisYear != otherYear {
 		return false
@@ -60,7 +95,7 @@ func sameDay(other time.Time) bool {
 	return true
 }
 
-func repoExists(repoName string, repoMap map[string]bool, client *http.Client) (bool, error) {
+func repoExists(ctx context.Context, repoName string, repoMap map[string]bool, client *http.Client) (bool, error) {
 	value, present := repoMap[repoName]
 	// first, I check to see if I've already queried the github api for this repo
 	if present {
@@ -69,22 +104,21 @@ func repoExists(repoName string, repoMap map[string]bool, client *http.Client) (
 	}
 	// otherwise, I need to query the github api
 	url := fmt.Sprintf("https://api.github.com/repos/%v", repoName)
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return false, fmt.Errorf("Error creating request to accesses %v: %v", url, err)
+		return false, fmt.Errorf("Error creating request to accesses %v: %w", url, err)
 	}
-	req.Header.Add("Authorization", fmt.Sprintf("token %s", os.Getenv("GITHUB_API_TOKEN")))
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return false, fmt.Errorf("Error in querying %v: %v", url, err)
+		return false, fmt.Errorf("Error in querying %v: %w", url, err)
 	}
 	defer resp.Body.Close()
 
 	var mess message
-	err = json.NewDecoder(resp.Body).Decode(&mess)
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(&mess)
 	if err != nil {
-		return false, fmt.Errorf("Error in decoding the json response from querying %v: %v", url, err)
+		return false, fmt.Errorf("Error in decoding the json response from querying %v: %w", url, err)
 	}
 	if mess.Message == "" {
 		// no message field indicates that the repo exists
@@ -101,46 +135,72 @@ func repoExists(repoName string, repoMap map[string]bool, client *http.Client) (
 	return true, nil
 }
 
-// GetNumberOfContributionsToday returns the number of contributions made for the authorized user
-// takes an http.Client as a parameter, encouraging the user to create and specify their own client
-// for information how to do so: https://golang.org/pkg/net/http/
-// requires GITHUB_USERNAME and GITHUB_API_TOKEN to be set environment variables
-// GITHUB_API_TOKENs can be created here: https://github.com/settings/tokens, this api token needs full access to the repo scope
-func GetNumberOfContributionsToday(client *http.Client, out chan<- ContributionItem) {
-	// if an error is discovered, send the error message (in a ContributionItem) to the channel and return so that the main process is not blocked
-	// make sure that if the function exits, whether successfuly or due to an error, the channel is closed so that the main process is not blocked
-	defer close(out)
-	
+// Count returns the number of contributions made today by username, who should be the user that the service's client is authorized as,
+// from the service's cache, if it has a count for username that is fresh enough, or otherwise from its backend
+// if ctx is cancelled, any request in flight is aborted and its error is returned
+func (s *Service) Count(ctx context.Context, username string) (int, error) {
+	now := s.now()
+	if s.Cache == nil {
+		return s.count(ctx, username, now)
+	}
+	key := cacheKey{backend: s.Backend, username: username, day: now.Local().Format("2006-01-02")}
+	return s.Cache.get(ctx, key, now, func() (int, error) {
+		return s.count(ctx, username, now)
+	})
+}
+
+// count counts the contributions made by username on now's day with the service's backend
+func (s *Service) count(ctx context.Context, username string, now time.Time) (int, error) {
+	switch s.Backend {
+	case "", Events:
+		return s.countEvents(ctx, username, now)
+	case GraphQL:
+		return s.countCalendar(ctx, username, now)
+	}
+	return 0, fmt.Errorf("%q is not a backend, must be events or graphql", s.Backend)
+}
+
+// countCalendar returns the count of now's day in username's contribution calendar, or 0 if the calendar has not reached it yet
+// (github dates the calendar in the user's time zone, which may not have reached today when the local time zone has)
+func (s *Service) countCalendar(ctx context.Context, username string, now time.Time) (int, error) {
+	days, err := GetCalendar(ctx, s.Client, username)
+	if err != nil {
+		return 0, err
+	}
+	today := now.Local().Format("2006-01-02")
+	for i := len(days) - 1; i >= 0; i-- {
+		if days[i].Date == today {
+			return days[i].Count, nil
+		}
+	}
+	return 0, nil
+}
+
+// countEvents counts the contributions in username's events that were made on now's day
+func (s *Service) countEvents(ctx context.Context, username string, now time.Time) (int, error) {
 	// construct url from username
-	url := fmt.Sprintf("https://api.github.com/users/%s/events", os.Getenv("GITHUB_USERNAME"))
+	url := fmt.Sprintf("https://api.github.com/users/%s/events", username)
 	// create a new http request with the method and url, no body
-	req, err := http.NewRequest("GET", url, nil)
-	// add the authorization header so that we can access commits to private repos
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		out <- ContributionItem{-1, err}
-		return
+		return 0, fmt.Errorf("Error creating request to access %v: %w", url, err)
 	}
-	req.Header.Add("Authorization", fmt.Sprintf("token %s", os.Getenv("GITHUB_API_TOKEN")))
-	// send the request
-	resp, err := client.Do(req)
-
+	// send the request, the client authorizes it so that we can access commits to private repos
+	resp, err := s.Client.Do(req)
 	if err != nil {
-		out <- ContributionItem{-1, err}
-		return
+		return 0, fmt.Errorf("Error in querying %v: %w", url, err)
 	}
-	
-	// when this function returns (when an error occurs) or exits naturally (success), quietly close the resp.Body and the channel so that the main goroutine can proceed as it wants 
 	defer resp.Body.Close()
 
 	// checks the status code
 	if resp.StatusCode != http.StatusOK {
-		out <- ContributionItem{-1, fmt.Errorf("Search query failed: %v", resp.Status)}
+		return 0, fmt.Errorf("Search query of %v failed: %v", url, resp.Status)
 	}
 	var events []Event
 
 	// Unmarshals the data into the an array of Events
-	if err := json.NewDecoder(resp.Body).Decode(&events); err != nil {
-		out <- ContributionItem{-1, fmt.Errorf("Error in decoding json from response body: %s", err)}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(&events); err != nil {
+		return 0, fmt.Errorf("Error in decoding json from the response of %v: %w", url, err)
 	}
 
 	// repoMap is a map of string repo names to bool values
@@ -155,34 +215,33 @@ func GetNumberOfContributionsToday(client *http.Client, out chan<- ContributionI
 
 	numberOfContributionsToday := 0
 	for _, event := range events {
-		if sameDay(event.CreatedAt) {
-			repositoryExists, err := repoExists(event.Repo.Name, repoMap, client)
-			if err != nil {
-				out <- ContributionItem{-1, err}
+		if !sameDay(event.CreatedAt, now) {
+			break
+		}
+		repositoryExists, err := repoExists(ctx, event.Repo.Name, repoMap, s.Client)
+		if err != nil {
+			return 0, err
+		}
+		if !repositoryExists {
+			continue
+		}
+		// if the event was created today, and the repository exists, then check if there were any contributions made today
+		switch event.Type {
+		case "CreateEvent":
+			// if a repository was created and still exists, it counts as a contribution
+			// also, creating a master branch counts as a contribution, creating other branches do not
+			if event.Payload.RefType == "repository" || event.Payload.Ref == "master" {
+				numberOfContributionsToday++
 			}
-			if repositoryExists {
-				// if the event was created today, and the repository exists, then check if there were any contributions made today
-				if event.Type == "CreateEvent" {
-					// if a repository was created and still exists, it counts as a contribution
-					// also, creating a master branch counts as a contribution, creating other branches do not
-					if event.Payload.RefType == "repository" || event.Payload.Ref == "master" {
-						numberOfContributionsToday++
-					}
-				} else if event.Type == "PullRequestEvent" {
+		case "PullRequestEvent":
+			numberOfContributionsToday++
+		case "PushEvent":
+			for _, commit := range event.Payload.Commits {
+				if commit.Message != "Update README.md" {
 					numberOfContributionsToday++
-				} else if event.Type == "PushEvent" {
-					for _, commit := range event.Payload.Commits {
-						if commit.Message != "Update README.md" {
-							numberOfContributionsToday++
-						}
-					}
 				}
-
 			}
-		} else {
-			break
 		}
 	}
-
-	out <- ContributionItem{numberOfContributionsToday, nil}
+	return numberOfContributionsToday, nil
 }
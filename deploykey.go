@@ -0,0 +1,196 @@
+//go:build !wasm
+
+package commitcron
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// deployKeyPush makes numberOfContributionsToMake contributions to the account's repository by pushing with git over ssh,
+// authenticated with the repository scoped deploy key at DEPLOY_KEY_PATH instead of an api token, so the contents api is bypassed entirely
+// the repository is shallow cloned into a temporary directory, the same files that would be updated through the contents api are updated (and any remaining created),
+// each change is committed separately so that each counts as a contribution, and all of them are pushed at once
+// commits are authored by whoever git is configured to author them as (eg. GIT_AUTHOR_NAME and GIT_AUTHOR_EMAIL), which must be an email on the account for them to count
+func deployKeyPush(ctx context.Context, env Settings, account Account, numberOfContributionsToMake int, sel Selection) error {
+	keyPath := env.get("DEPLOY_KEY_PATH")
+	if keyPath == "" {
+		return fmt.Errorf("PUSH_MODE is ssh, but DEPLOY_KEY_PATH is not set")
+	}
+	keyPath, err := filepath.Abs(keyPath)
+	if err != nil {
+		return fmt.Errorf("Error resolving DEPLOY_KEY_PATH: %w", err)
+	}
+
+	dir, err := ioutil.TempDir("", "commitcron")
+	if err != nil {
+		return fmt.Errorf("Error creating directory to clone into: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	environ, err := deployKeyEnv(env, keyPath)
+	if err != nil {
+		return err
+	}
+	git := func(args ...string) (string, error) {
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = dir
+		cmd.Env = environ
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("Error running git %v: %w: %v", args[0], err, strings.TrimSpace(stderr.String()))
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+
+	remote := fmt.Sprintf("git@github.com:%v/%v.git", account.Username, account.Repo)
+	if _, err := git("clone", "--depth", "1", remote, "."); err != nil {
+		return err
+	}
+	// the branch is checked out if it exists, or created from the default branch if it doesn't
+	if sel.Branch != "" {
+		if _, err := git("fetch", "--depth", "1", "origin", sel.Branch); err == nil {
+			_, err = git("checkout", "-B", sel.Branch, "FETCH_HEAD")
+			if err != nil {
+				return err
+			}
+		} else if _, err := git("checkout", "-b", sel.Branch); err != nil {
+			return err
+		}
+	}
+
+	// the repository's .commitcronignore and .gitattributes files are read from the clone, instead of through the contents api
+	read := func(p string) ([]byte, bool, error) {
+		data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(p)))
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return data, err == nil, err
+	}
+	if err := sel.loadRepoFiles(read, account.Username); err != nil {
+		return err
+	}
+
+	// commits are signed by git itself, if COMMIT_SIGNING is set, and authored by COMMIT_AUTHOR_NAME and COMMIT_AUTHOR_EMAIL, if they are set
+	opts, err := loadCommitOptions(env)
+	if err != nil {
+		return err
+	}
+
+	// the tracked files are listed with their blob shas, which play the same role as the shas the contents api reports
+	// unless in journal, changelog or recreate mode, where there are no files to choose
+	files := ""
+	if opts.Content.Mode == "files" {
+		files, err = git("ls-files", "--stage")
+		if err != nil {
+			return err
+		}
+	}
+	var candidates []RepoContent
+	for _, line := range strings.Split(files, "\n") {
+		// each line is: <mode> <sha> <stage>\t<path>
+		parts := strings.SplitN(line, "\t", 2)
+		fields := strings.Fields(parts[0])
+		if len(parts) != 2 || len(fields) != 3 {
+			continue
+		}
+		path := parts[1]
+		if sel.allows(path) {
+			candidates = append(candidates, RepoContent{Name: filepath.Base(path), Path: path, SHA: fields[1], Type: "file"})
+		}
+	}
+	contents, err := chooseLocalFiles(dir, candidates, numberOfContributionsToMake, sel, opts, read, localDirLister(dir), currentTime(ctx))
+	if err != nil {
+		return err
+	}
+
+	var commitConfig []string
+	if opts.Signer != nil {
+		commitConfig = opts.Signer.gitConfig()
+	}
+	if opts.Author != nil {
+		commitConfig = append(commitConfig, "-c", "user.name="+opts.Author.Name, "-c", "user.email="+opts.Author.Email)
+	}
+
+	updates, err := prepareUpdates(ctx, contents, sel, opts)
+	if err != nil {
+		return err
+	}
+	committed := 0
+	for _, u := range updates {
+		v := u.File
+		if sel.protects(v.Path) {
+			return fmt.Errorf("refusing to modify %v, it is protected by PROTECTED_PATHS", v.Path)
+		}
+		local := filepath.Join(dir, filepath.FromSlash(v.Path))
+		if u.Delete {
+			if _, err := git("rm", "--quiet", "--", v.Path); err != nil {
+				return err
+			}
+		} else {
+			// new files may be created in a TARGET_PATH that does not exist yet
+			if err := os.MkdirAll(filepath.Dir(local), 0755); err != nil {
+				return fmt.Errorf("Error creating the directory for %v: %w", v.Path, err)
+			}
+			if err := ioutil.WriteFile(local, u.Content, 0644); err != nil {
+				return fmt.Errorf("Error writing %v: %w", v.Path, err)
+			}
+			if _, err := git("add", "--", v.Path); err != nil {
+				return err
+			}
+		}
+		if _, err := git(append(commitConfig, "commit", "-m", opts.Messages.finish(u.Message))...); err != nil {
+			return err
+		}
+		committed++
+	}
+
+	if sel.Branch != "" {
+		_, err = git("push", "origin", "HEAD:refs/heads/"+sel.Branch)
+	} else {
+		_, err = git("push", "origin", "HEAD")
+	}
+	if err != nil {
+		return err
+	}
+	// the commits that were pushed are the last ones on the branch, and they are only reported, so failing to list them doesn't fail the push that has already been made
+	recordFiles(ctx, updates...)
+	shas, err := git("rev-list", fmt.Sprintf("--max-count=%v", committed), "--reverse", "HEAD")
+	if err != nil {
+		logger(ctx).Warn("Error listing the commits that were pushed", "err", err)
+		return nil
+	}
+	recordCommits(ctx, strings.Fields(shas)...)
+	return nil
+}
+
+// deployKeyEnv returns the environment git is run with so that ssh authenticates with the deploy key, and only the deploy key
+// if the key has a passphrase (DEPLOY_KEY_PASSPHRASE), ssh is made to ask this binary for it, since ssh will not read a passphrase from anywhere but a terminal or SSH_ASKPASS
+// the passphrase is passed on to ssh (and so to this binary) in its environment, wherever the passphrase itself came from
+func deployKeyEnv(env Settings, keyPath string) ([]string, error) {
+	environ := append(os.Environ(),
+		fmt.Sprintf("GIT_SSH_COMMAND=ssh -i %q -o IdentitiesOnly=yes -o StrictHostKeyChecking=accept-new", keyPath),
+		// never fall back to prompting on a terminal, a scheduled task has none
+		"GIT_TERMINAL_PROMPT=0",
+	)
+	if passphrase, present := env.lookup("DEPLOY_KEY_PASSPHRASE"); present {
+		self, err := os.Executable()
+		if err != nil {
+			return nil, fmt.Errorf("Error finding executable to answer the deploy key passphrase prompt: %w", err)
+		}
+		environ = append(environ, "SSH_ASKPASS="+self, "SSH_ASKPASS_REQUIRE=force", AskpassEnv+"=1", "DEPLOY_KEY_PASSPHRASE="+passphrase)
+		// older versions of ssh only use SSH_ASKPASS when DISPLAY is set, which is whatever ssh inherits from this process
+		if os.Getenv("DISPLAY") == "" {
+			environ = append(environ, "DISPLAY=:0")
+		}
+	}
+	return environ, nil
+}
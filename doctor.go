@@ -0,0 +1,70 @@
+package commitcron
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/anacanm/commitCron/auth"
+)
+
+// Check is the result of one of the checks that Doctor makes
+type Check struct {
+	// Name is what was checked, eg. "octocat/notes: write access"
+	Name string
+	// Err is why the check failed, or nil if it passed
+	Err error
+	// Skipped, if it is not "", is why the check could not be made, in which case it neither passed nor failed
+	Skipped string
+}
+
+// Doctor checks the configuration of every account and repository without making any contributions, and returns the result of each check
+// it only returns an error if the configuration can't be read at all, a check that fails is reported in its Check
+func Doctor(ctx context.Context, env Settings, tokenClient *http.Client) ([]Check, error) {
+	return (&Runner{}).Doctor(ctx, env, tokenClient)
+}
+
+// Doctor checks the configuration as the package's Doctor does, with the runner's options
+func (r *Runner) Doctor(ctx context.Context, env Settings, tokenClient *http.Client) ([]Check, error) {
+	ctx = withRunner(ctx, r)
+	accounts, err := loadAccounts(env)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := loadCommitOptions(env)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := loadSelection(env); err != nil {
+		return nil, err
+	}
+
+	var checks []Check
+	for _, account := range accounts {
+		client, err := account.newClient(r, env, tokenClient)
+		checks = append(checks, Check{Name: fmt.Sprintf("%v: credentials", account.Username), Err: err})
+		if err != nil {
+			continue
+		}
+		for _, repo := range account.repos() {
+			_, err := auth.CheckAccess(client, account.Username, repo)
+			checks = append(checks, Check{Name: fmt.Sprintf("%v/%v: write access", account.Username, repo), Err: err})
+		}
+		if opts.Author == nil {
+			continue
+		}
+		check := Check{Name: fmt.Sprintf("%v: commits authored by %v count as contributions", account.Username, opts.Author.Email)}
+		checked, err := checkAuthorEmail(ctx, client, opts.Author.Email)
+		if checked {
+			check.Err = err
+		} else {
+			check.Skipped = "the token can't list the account's email addresses (grant it the user:email scope)"
+		}
+		checks = append(checks, check)
+	}
+
+	if env.get("PUSH_MODE") == "ssh" {
+		checks = append(checks, Check{Name: "write access with the deploy key", Skipped: "PUSH_MODE is ssh, write access is checked against the token, not the deploy key"})
+	}
+	return checks, nil
+}
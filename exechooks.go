@@ -0,0 +1,101 @@
+package commitcron
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// maxReportEnvBytes is the largest report that is passed to HOOK_AFTER_RUN in its environment as well as on its standard input,
+// since the whole environment of a command is limited in size (to as little as 128KiB for a single variable on linux), and exceeding it would keep the command from running at all
+const maxReportEnvBytes = 32 << 10
+
+// ExecHooks returns the Hooks that run the commands that HOOK_BEFORE_RUN, HOOK_AFTER_COMMIT and HOOK_AFTER_RUN in env are set to, see WithHooks
+// each command is split on whitespace, as PRE_COMMIT_COMMAND is, and run with the process's environment, along with what it is told about:
+// HOOK_BEFORE_RUN vetoes the run if it fails, HOOK_AFTER_COMMIT is given each commit as json on its standard input, and in COMMITCRON_USERNAME, COMMITCRON_REPO and COMMITCRON_SHA,
+// and HOOK_AFTER_RUN the report as json on its standard input, and in COMMITCRON_REPORT if it is small enough (see maxReportEnvBytes)
+// the commit and run have already been made by the time the later two are run, so their failures are only logged
+func ExecHooks(env Settings) (Hooks, error) {
+	var hooks Hooks
+	before, err := loadHookCommand(env, "HOOK_BEFORE_RUN")
+	if err != nil {
+		return hooks, err
+	}
+	afterCommit, err := loadHookCommand(env, "HOOK_AFTER_COMMIT")
+	if err != nil {
+		return hooks, err
+	}
+	afterRun, err := loadHookCommand(env, "HOOK_AFTER_RUN")
+	if err != nil {
+		return hooks, err
+	}
+
+	if before != nil {
+		hooks.OnRunStarted = func(ctx context.Context) error {
+			return runHookCommand(ctx, "HOOK_BEFORE_RUN", before, nil, nil)
+		}
+	}
+	if afterCommit != nil {
+		hooks.OnCommitCreated = func(ctx context.Context, commit Commit) {
+			data, err := json.Marshal(commit)
+			if err != nil {
+				logger(ctx).Warn("Error encoding the commit for HOOK_AFTER_COMMIT", "sha", commit.SHA, "err", err)
+				return
+			}
+			environ := []string{"COMMITCRON_USERNAME=" + commit.Username, "COMMITCRON_REPO=" + commit.Repo, "COMMITCRON_SHA=" + commit.SHA}
+			if err := runHookCommand(ctx, "HOOK_AFTER_COMMIT", afterCommit, data, environ); err != nil {
+				logger(ctx).Warn("HOOK_AFTER_COMMIT failed", "repo", commit.Username+"/"+commit.Repo, "sha", commit.SHA, "err", err)
+			}
+		}
+	}
+	if afterRun != nil {
+		hooks.OnRunFinished = func(ctx context.Context, report *Report) {
+			data, err := json.Marshal(report)
+			if err != nil {
+				logger(ctx).Warn("Error encoding the report for HOOK_AFTER_RUN", "err", err)
+				return
+			}
+			var environ []string
+			if len(data) <= maxReportEnvBytes {
+				environ = append(environ, "COMMITCRON_REPORT="+string(data))
+			}
+			// the report is worth delivering even when the run was interrupted, which is when it is most likely to be wanted
+			if err := runHookCommand(context.WithoutCancel(ctx), "HOOK_AFTER_RUN", afterRun, data, environ); err != nil {
+				logger(ctx).Warn("HOOK_AFTER_RUN failed", "err", err)
+			}
+		}
+	}
+	return hooks, nil
+}
+
+// loadHookCommand reads the command that the setting name is set to, split on whitespace, or nil if it is not set
+func loadHookCommand(env Settings, name string) ([]string, error) {
+	c, present := env.lookup(name)
+	if !present {
+		return nil, nil
+	}
+	command := strings.Fields(c)
+	if len(command) == 0 {
+		return nil, fmt.Errorf("Error parsing %v: it is empty", name)
+	}
+	return command, nil
+}
+
+// runHookCommand runs the hook command of the setting name, with stdin as its standard input, and environ added to its environment,
+// returning an error with what it printed if it fails
+func runHookCommand(ctx context.Context, name string, command []string, stdin []byte, environ []string) error {
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Env = append(cmd.Environ(), environ...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	if output := strings.TrimSpace(string(out)); output != "" {
+		return fmt.Errorf("Error running %v (%v): %w: %v", name, command[0], err, output)
+	}
+	return fmt.Errorf("Error running %v (%v): %w", name, command[0], err)
+}
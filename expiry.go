@@ -0,0 +1,44 @@
+package commitcron
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/anacanm/commitCron/auth"
+)
+
+// defaultExpiryWarningDays is how many days before the token expires that warnings start being logged, if TOKEN_EXPIRY_WARNING_DAYS is not specified
+const defaultExpiryWarningDays = 7
+
+// warnIfTokenExpiring persists the token's expiration and warns when the token is within TOKEN_EXPIRY_WARNING_DAYS of expiring, so that the nightly job doesn't silently start failing one day
+// the warning is logged, and recorded in the run's report, so that it is also sent wherever the report is, eg. to HOOK_AFTER_RUN, which is how a notification is sent
+// tokens that github did not report an expiration for (a zero expiration) never warn
+// the only error is an invalid TOKEN_EXPIRY_WARNING_DAYS
+func warnIfTokenExpiring(ctx context.Context, env Settings, expiration time.Time) error {
+	if expiration.IsZero() {
+		return nil
+	}
+	if err := auth.SaveExpiration(expiration); err != nil {
+		// not being able to persist the expiration only makes a future error message less helpful, so it is not fatal
+		logger(ctx).Warn("Error saving the token's expiration", "err", err)
+	}
+
+	warningDays := defaultExpiryWarningDays
+	if days, present := env.lookup("TOKEN_EXPIRY_WARNING_DAYS"); present {
+		var err error
+		warningDays, err = strconv.Atoi(days)
+		if err != nil {
+			return fmt.Errorf("Error parsing TOKEN_EXPIRY_WARNING_DAYS: %w", err)
+		}
+	}
+
+	remaining := expiration.Sub(currentTime(ctx))
+	if remaining < time.Duration(warningDays)*24*time.Hour {
+		days, expires := int(remaining.Hours()/24), expiration.Local().Format("2006-01-02")
+		logger(ctx).Warn("The github token expires soon, create a new one before then or contributions will stop being made", "days", days, "expires", expires)
+		recordWarning(ctx, fmt.Sprintf("the github token expires on %v, in %v days, create a new one before then or contributions will stop being made", expires, days))
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package commitcron
+
+import (
+	"fmt"
+	"strings"
+)
+
+// defaultExtensions are the extensions of the files that are modified when FILE_EXTENSIONS is not specified
+const defaultExtensions = ".js,.java,.go,.c,.cpp,.txt"
+
+// updateOnlyFlag marks an entry in FILE_EXTENSIONS as one whose files may be updated, but never created
+const updateOnlyFlag = ":update-only"
+
+// commentSyntaxes are the comment syntaxes of the extensions whose languages don't use // comments, which files with them are given when FILE_EXTENSIONS does not specify one,
+// as a prefix, optionally followed by a space and a suffix (as they are written in FILE_EXTENSIONS), every other extension is given // comments
+var commentSyntaxes = map[string]string{
+	// shell, scripting and configuration languages
+	".py": "#", ".rb": "#", ".sh": "#", ".bash": "#", ".zsh": "#", ".pl": "#", ".r": "#", ".R": "#", ".jl": "#", ".ex": "#", ".exs": "#", ".nim": "#",
+	".ps1": "#", ".yaml": "#", ".yml": "#", ".toml": "#", ".cfg": "#", ".conf": "#", ".mk": "#", ".cmake": "#", ".tf": "#", ".dockerfile": "#",
+	// sql and languages descended from it, or that happen to share its comments
+	".sql": "--", ".lua": "--", ".hs": "--", ".elm": "--", ".ada": "--", ".adb": "--", ".ads": "--", ".vhd": "--", ".vhdl": "--",
+	// lisps, assembly and ini files
+	".lisp": ";", ".cl": ";", ".el": ";", ".clj": ";", ".cljs": ";", ".edn": ";", ".scm": ";", ".rkt": ";", ".asm": ";", ".ini": ";",
+	// latex, erlang and prolog
+	".tex": "%", ".sty": "%", ".bib": "%", ".erl": "%", ".hrl": "%",
+	// markup
+	".html": "<!-- -->", ".htm": "<!-- -->", ".xml": "<!-- -->", ".svg": "<!-- -->", ".md": "<!-- -->", ".markdown": "<!-- -->", ".vue": "<!-- -->", ".xhtml": "<!-- -->",
+	// stylesheets, which have no line comments
+	".css": "/* */",
+}
+
+// ExtensionRule configures how files with a particular extension are modified
+type ExtensionRule struct {
+	Extension string
+	// CommentPrefix and CommentSuffix surround the comment that is inserted into files, eg. "<!--" and "-->" for html
+	CommentPrefix string
+	CommentSuffix string
+	// UpdateOnly files are only ever updated, new files are never created with the extension
+	UpdateOnly bool
+}
+
+// Comment returns text as a comment in the rule's comment syntax
+// text may come from elsewhere (eg. an llm's snippet), so whatever in it would end the comment early, or carry it on past the end of its line, is removed first (see commentText)
+func (r ExtensionRule) Comment(text string) string {
+	text = r.commentText(text)
+	if r.CommentSuffix == "" {
+		return r.CommentPrefix + " " + text
+	}
+	return r.CommentPrefix + " " + text + " " + r.CommentSuffix
+}
+
+// commentText returns text without anything that would stop it being a single, complete comment in the rule's syntax: line breaks, the comment suffix (eg. */), and trailing backslashes,
+// which continue a line, and so a // comment, onto the next in c and its relatives
+// -- is removed from html comments entirely, since xml doesn't allow it in a comment at all, and --> ends one
+// removing one occurrence may join the text around it into another, so each is removed until there are none left
+func (r ExtensionRule) commentText(text string) string {
+	text = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ").Replace(text)
+	forbidden := r.CommentSuffix
+	if forbidden == "-->" {
+		forbidden = "--"
+	}
+	for forbidden != "" && strings.Contains(text, forbidden) {
+		text = strings.ReplaceAll(text, forbidden, "")
+	}
+	return strings.TrimRight(text, "\\ \t")
+}
+
+// ExtensionRules are the rules for every extension whose files may be modified
+type ExtensionRules []ExtensionRule
+
+// loadExtensionRules reads the rules from FILE_EXTENSIONS, a comma separated list of entries of the form:
+//
+//	.ext[=comment][:update-only]
+//
+// where comment is the comment prefix, optionally followed by a space and a comment suffix, and defaults to the extension's entry in commentSyntaxes, or // if it has none. eg.
+//
+//	.go,.py,.sql=--,.html=<!-- -->,.txt:update-only
+func loadExtensionRules(env Settings) (ExtensionRules, error) {
+	spec, present := env.lookup("FILE_EXTENSIONS")
+	if !present {
+		spec = defaultExtensions
+	}
+	return parseExtensionRules(spec)
+}
+
+// parseExtensionRules parses a FILE_EXTENSIONS specification
+func parseExtensionRules(spec string) (ExtensionRules, error) {
+	var rules ExtensionRules
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		rule := ExtensionRule{CommentPrefix: "//"}
+		if strings.HasSuffix(entry, updateOnlyFlag) {
+			rule.UpdateOnly = true
+			entry = strings.TrimSuffix(entry, updateOnlyFlag)
+		}
+		ext, comment := entry, ""
+		if i := strings.Index(entry, "="); i >= 0 {
+			ext, comment = entry[:i], strings.TrimSpace(entry[i+1:])
+		}
+		if comment == "" {
+			comment = commentSyntaxes[ext]
+		}
+		if comment != "" {
+			parts := strings.SplitN(comment, " ", 2)
+			rule.CommentPrefix = parts[0]
+			if len(parts) == 2 {
+				rule.CommentSuffix = strings.TrimSpace(parts[1])
+			}
+		}
+		if !strings.HasPrefix(ext, ".") || len(ext) < 2 {
+			return nil, fmt.Errorf("Error parsing FILE_EXTENSIONS: %q is not an extension, extensions start with a \".\"", ext)
+		}
+		rule.Extension = ext
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// lookup returns the rule for the file named fileName, or false if its extension may not be modified
+// the longest matching extension wins, so that eg. ".d.ts" can be configured differently from ".ts"
+func (rules ExtensionRules) lookup(fileName string) (ExtensionRule, bool) {
+	var match ExtensionRule
+	found := false
+	for _, rule := range rules {
+		if strings.HasSuffix(fileName, rule.Extension) && len(rule.Extension) > len(match.Extension) {
+			match, found = rule, true
+		}
+	}
+	return match, found
+}
+
+// creatable returns the rule for the extension that new files are created with:
+// .go if files with that extension may be created (as has always been the case), otherwise the first extension that may be created
+func (rules ExtensionRules) creatable() (ExtensionRule, bool) {
+	for _, rule := range rules {
+		if rule.Extension == ".go" && !rule.UpdateOnly {
+			return rule, true
+		}
+	}
+	for _, rule := range rules {
+		if !rule.UpdateOnly {
+			return rule, true
+		}
+	}
+	return ExtensionRule{}, false
+}
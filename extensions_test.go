@@ -0,0 +1,31 @@
+package commitcron
+
+import "testing"
+
+func TestComment(t *testing.T) {
+	slashes := ExtensionRule{Extension: ".c", CommentPrefix: "//"}
+	block := ExtensionRule{Extension: ".css", CommentPrefix: "/*", CommentSuffix: "*/"}
+	html := ExtensionRule{Extension: ".html", CommentPrefix: "<!--", CommentSuffix: "-->"}
+	cases := []struct {
+		rule ExtensionRule
+		text string
+		want string
+	}{
+		{slashes, "a line", "// a line"},
+		// a trailing backslash would continue the comment onto the line after it
+		{slashes, `#define X \`, "// #define X"},
+		{slashes, "a line \\\\  ", "// a line"},
+		{slashes, "two\nlines", "// two lines"},
+		{block, "closes */ early", "/* closes  early */"},
+		// removing the suffix can't leave another behind
+		{block, "**//", "/*  */"},
+		{html, "closes --> early", "<!-- closes > early -->"},
+		{html, "a -- b", "<!-- a  b -->"},
+		{html, "---->>", "<!-- >> -->"},
+	}
+	for _, c := range cases {
+		if got := c.rule.Comment(c.text); got != c.want {
+			t.Errorf("%v: Comment(%q) = %q, want %q", c.rule.Extension, c.text, got, c.want)
+		}
+	}
+}
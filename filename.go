@@ -0,0 +1,128 @@
+package commitcron
+
+import (
+	cryptorand "crypto/rand"
+	"fmt"
+	"math/rand"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// defaultFileNameTemplate is the template that the names of new files are generated with when FILE_NAME_TEMPLATE is not specified
+const defaultFileNameTemplate = `{{.ULID}}{{.Ext}}`
+
+// maxFileNameAttempts is how many names are generated for a single new file before giving up on finding one that isn't taken,
+// which only happens if the template generates the same few names over and over, eg. if it references none of .ULID, .Seq and .Rand
+const maxFileNameAttempts = 100
+
+// fileNameData is what file name templates can reference, eg. "note-{{.Date}}-{{.Seq}}.md"
+type fileNameData struct {
+	// Date is the date the file is created, formatted as 2006-01-02
+	Date string
+	// Time is the moment the file is created, for other formats, eg. {{.Time.Format "2006/01"}}
+	Time time.Time
+	// Seq counts the names generated in the run, starting from 1
+	Seq int
+	// Rand is 8 random hexadecimal digits
+	Rand string
+	// ULID is a ulid (https://github.com/ulid/spec), which is unique, and sorts in the order the files were created in
+	ULID string
+	// Ext is the extension new files are created with, including the "."
+	Ext string
+}
+
+// parseFileNameTemplate parses the template that the names of new files are generated with
+func parseFileNameTemplate(text string) (*template.Template, error) {
+	t, err := template.New("FILE_NAME_TEMPLATE").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing FILE_NAME_TEMPLATE: %w", err)
+	}
+	return t, nil
+}
+
+// newFileName returns the slash separated path, relative to the directory it is created in, of the seq-th new file of the run, generated with t
+// if the name does not end in an extension that new files may be created with, the extension of rule is appended to it, so that it can still be modified
+func newFileName(t *template.Template, rules ExtensionRules, rule ExtensionRule, seq int, now time.Time) (string, error) {
+	var b strings.Builder
+	err := t.Execute(&b, fileNameData{
+		Date: now.Format(dateLayout),
+		Time: now,
+		Seq:  seq,
+		Rand: fmt.Sprintf("%08x", rand.Uint32()),
+		ULID: newULID(now),
+		Ext:  rule.Extension,
+	})
+	if err != nil {
+		return "", fmt.Errorf("Error generating file name: %w", err)
+	}
+	name := strings.TrimSpace(b.String())
+	if r, ok := rules.lookup(name); !ok || r.UpdateOnly {
+		name += rule.Extension
+	}
+	if err := validGitPath(name); err != nil {
+		return "", fmt.Errorf("FILE_NAME_TEMPLATE generated %q, which can't be used: %w", name, err)
+	}
+	return name, nil
+}
+
+// validGitPath returns an error if the slash separated relative path p is not one that git (and every common file system) will accept for a file
+func validGitPath(p string) error {
+	if p == "" || strings.HasPrefix(p, "/") {
+		return fmt.Errorf("the path must be relative, and not empty")
+	}
+	for _, r := range p {
+		if r < 0x20 || r == 0x7f {
+			return fmt.Errorf("the path contains a control character")
+		}
+		// these are not allowed in file names on windows, and a backslash would be taken as a separator there
+		if strings.ContainsRune(`\:*?"<>|`, r) {
+			return fmt.Errorf("the path contains %q", r)
+		}
+	}
+	for _, part := range strings.Split(p, "/") {
+		switch {
+		case part == "" || part == "." || part == "..":
+			return fmt.Errorf("the path has an empty, \".\" or \"..\" component")
+		case strings.EqualFold(part, ".git"):
+			return fmt.Errorf("the path has a .git component")
+		case strings.TrimSpace(part) != part || strings.HasSuffix(part, "."):
+			return fmt.Errorf("a component of the path starts or ends with a space, or ends with a \".\"")
+		}
+	}
+	if path.Clean(p) != p {
+		return fmt.Errorf("the path is not clean")
+	}
+	return nil
+}
+
+// crockfordBase32 is the alphabet that ulids are encoded in
+const crockfordBase32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newULID returns a ulid for now: the milliseconds since the unix epoch in its first 48 bits, followed by 80 random bits, encoded as 26 characters of crockford's base32
+func newULID(now time.Time) string {
+	var id [16]byte
+	ms := uint64(now.UnixNano() / int64(time.Millisecond))
+	for i := 0; i < 6; i++ {
+		id[i] = byte(ms >> (8 * uint(5-i)))
+	}
+	// as with commit ids, crypto/rand only fails if the operating system's random number generator does
+	if _, err := cryptorand.Read(id[6:]); err != nil {
+		rand.Read(id[6:])
+	}
+	// 128 bits are encoded as 26 characters of 5 bits, the first of which only holds the top 3 bits
+	var b strings.Builder
+	for i := 0; i < 26; i++ {
+		shift := uint(125 - 5*i)
+		var v byte
+		for bit := uint(0); bit < 5; bit++ {
+			pos := shift + 4 - bit
+			if pos < 128 && id[15-pos/8]&(1<<(pos%8)) != 0 {
+				v |= 1 << (4 - bit)
+			}
+		}
+		b.WriteByte(crockfordBase32[v])
+	}
+	return b.String()
+}
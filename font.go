@@ -0,0 +1,128 @@
+package commitcron
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// glyphWidth is how many weeks wide each character of text drawn on the contribution graph is, and glyphSpacing how many empty weeks separate them
+const (
+	glyphWidth   = 5
+	glyphSpacing = 1
+)
+
+// font is a 5x7 pixel font, each character is a line for each day of the week (from sunday to saturday), of "#" for the days that are drawn
+var font = map[rune][graphDays]string{
+	'A': {".###.", "#...#", "#...#", "#####", "#...#", "#...#", "#...#"},
+	'B': {"####.", "#...#", "#...#", "####.", "#...#", "#...#", "####."},
+	'C': {".###.", "#...#", "#....", "#....", "#....", "#...#", ".###."},
+	'D': {"####.", "#...#", "#...#", "#...#", "#...#", "#...#", "####."},
+	'E': {"#####", "#....", "#....", "####.", "#....", "#....", "#####"},
+	'F': {"#####", "#....", "#....", "####.", "#....", "#....", "#...."},
+	'G': {".###.", "#...#", "#....", "#.###", "#...#", "#...#", ".####"},
+	'H': {"#...#", "#...#", "#...#", "#####", "#...#", "#...#", "#...#"},
+	'I': {".###.", "..#..", "..#..", "..#..", "..#..", "..#..", ".###."},
+	'J': {"..###", "...#.", "...#.", "...#.", "...#.", "#..#.", ".##.."},
+	'K': {"#...#", "#..#.", "#.#..", "##...", "#.#..", "#..#.", "#...#"},
+	'L': {"#....", "#....", "#....", "#....", "#....", "#....", "#####"},
+	'M': {"#...#", "##.##", "#.#.#", "#.#.#", "#...#", "#...#", "#...#"},
+	'N': {"#...#", "#...#", "##..#", "#.#.#", "#..##", "#...#", "#...#"},
+	'O': {".###.", "#...#", "#...#", "#...#", "#...#", "#...#", ".###."},
+	'P': {"####.", "#...#", "#...#", "####.", "#....", "#....", "#...."},
+	'Q': {".###.", "#...#", "#...#", "#...#", "#.#.#", "#..#.", ".##.#"},
+	'R': {"####.", "#...#", "#...#", "####.", "#.#..", "#..#.", "#...#"},
+	'S': {".####", "#....", "#....", ".###.", "....#", "....#", "####."},
+	'T': {"#####", "..#..", "..#..", "..#..", "..#..", "..#..", "..#.."},
+	'U': {"#...#", "#...#", "#...#", "#...#", "#...#", "#...#", ".###."},
+	'V': {"#...#", "#...#", "#...#", "#...#", "#...#", ".#.#.", "..#.."},
+	'W': {"#...#", "#...#", "#...#", "#.#.#", "#.#.#", "#.#.#", ".#.#."},
+	'X': {"#...#", "#...#", ".#.#.", "..#..", ".#.#.", "#...#", "#...#"},
+	'Y': {"#...#", "#...#", ".#.#.", "..#..", "..#..", "..#..", "..#.."},
+	'Z': {"#####", "....#", "...#.", "..#..", ".#...", "#....", "#####"},
+	'0': {".###.", "#...#", "#..##", "#.#.#", "##..#", "#...#", ".###."},
+	'1': {"..#..", ".##..", "..#..", "..#..", "..#..", "..#..", ".###."},
+	'2': {".###.", "#...#", "....#", "...#.", "..#..", ".#...", "#####"},
+	'3': {"#####", "...#.", "..#..", "...#.", "....#", "#...#", ".###."},
+	'4': {"...#.", "..##.", ".#.#.", "#..#.", "#####", "...#.", "...#."},
+	'5': {"#####", "#....", "####.", "....#", "....#", "#...#", ".###."},
+	'6': {"..##.", ".#...", "#....", "####.", "#...#", "#...#", ".###."},
+	'7': {"#####", "....#", "...#.", "..#..", ".#...", ".#...", ".#..."},
+	'8': {".###.", "#...#", "#...#", ".###.", "#...#", "#...#", ".###."},
+	'9': {".###.", "#...#", "#...#", ".####", "....#", "...#.", ".##.."},
+	' ': {".....", ".....", ".....", ".....", ".....", ".....", "....."},
+	'!': {"..#..", "..#..", "..#..", "..#..", "..#..", ".....", "..#.."},
+	'?': {".###.", "#...#", "....#", "...#.", "..#..", ".....", "..#.."},
+	'.': {".....", ".....", ".....", ".....", ".....", ".##..", ".##.."},
+	'-': {".....", ".....", ".....", "#####", ".....", ".....", "....."},
+	'<': {"...#.", "..#..", ".#...", "#....", ".#...", "..#..", "...#."},
+	'>': {".#...", "..#..", "...#.", "....#", "...#.", "..#..", ".#..."},
+}
+
+// TextPattern returns the pattern that spells text in a 5x7 pixel font, at the darkest shade, centered on the full graph, letters are case insensitive
+// only letters, digits, spaces and !?.-<> can be drawn, and at most 9 characters fit
+func TextPattern(text string) (Pattern, error) {
+	p, err := textPattern(text, maxIntensity)
+	if err != nil {
+		return p, err
+	}
+	return p.centered(graphWeeks), nil
+}
+
+// textPattern returns the pattern that spells text in font, with every drawn day at intensity, letters are case insensitive
+func textPattern(text string, intensity int) (Pattern, error) {
+	var p Pattern
+	if text == "" {
+		return p, fmt.Errorf("there is no text to draw")
+	}
+	width := len([]rune(text))*(glyphWidth+glyphSpacing) - glyphSpacing
+	if width > graphWeeks {
+		return p, fmt.Errorf("%q is %v weeks wide, but the graph is only %v weeks wide, which fits %v characters", text, width, graphWeeks, (graphWeeks+glyphSpacing)/(glyphWidth+glyphSpacing))
+	}
+	for day := range p {
+		p[day] = make([]int, width)
+	}
+	for i, c := range []rune(text) {
+		glyph, ok := font[unicode.ToUpper(c)]
+		if !ok {
+			return p, fmt.Errorf("%q can't be drawn, only letters, digits, spaces and %q can", c, "!?.-<>")
+		}
+		for day, line := range glyph {
+			for x, pixel := range line {
+				if pixel == '#' {
+					p[day][i*(glyphWidth+glyphSpacing)+x] = intensity
+				}
+			}
+		}
+	}
+	return p, nil
+}
+
+// centered returns the pattern moved to the middle of a graph that is weeks wide, by padding it with empty weeks on the left
+func (p Pattern) centered(weeks int) Pattern {
+	offset := (weeks - p.Weeks()) / 2
+	if offset <= 0 {
+		return p
+	}
+	var centered Pattern
+	for day := range p {
+		centered[day] = append(make([]int, offset), p[day]...)
+	}
+	return centered
+}
+
+// String renders the pattern as it would be read by ParsePattern
+func (p Pattern) String() string {
+	var b strings.Builder
+	for _, line := range p {
+		for _, intensity := range line {
+			if intensity == 0 {
+				b.WriteByte('.')
+			} else {
+				b.WriteByte(byte('0' + intensity))
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
@@ -0,0 +1,328 @@
+package commitcron
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anacanm/commitCron/repocontents"
+)
+
+// maxGitDataResponseBytes is the ceiling on how much of a single response from the git data api is read
+const maxGitDataResponseBytes = 1 << 20
+
+// defaultFileMode is the mode that files are committed with when their mode is not known, which is that of a regular, non-executable file
+const defaultFileMode = "100644"
+
+// commitOptions configures how changes are committed, most of them only apply to the git data api, since the contents api can't do any better than committing a file at a time, at the moment of the request
+type commitOptions struct {
+	// FilesPerCommit is how many file changes share each commit, each commit counts as one contribution, so the default is 1
+	FilesPerCommit int
+	// Times configures the dates of the commits
+	Times commitTimes
+	// Dates, if it is not nil, are the dates of each of the commits, in place of Times, eg. for backfilling
+	Dates []time.Time
+	// Signer, if it is not nil, signs each commit
+	Signer *commitSigner
+	// Messages configures the commit messages, whichever api commits are made with
+	Messages commitMessages
+	// Author, if it is not nil, is who commits are authored and committed by (without a date), whichever api commits are made with
+	// otherwise, they are authored by the user that the token belongs to (or whoever git is configured to author them as)
+	Author *gitIdentity
+	// LLM, if it is not nil, generates commit messages (and optionally content) in place of templates
+	LLM *llmProvider
+	// Content configures the content that changed files are given, whichever api commits are made with
+	Content contentOptions
+	// Backend is the api that changes are uploaded with, contents (the default) or git-data, see uploadUpdates
+	Backend string
+	// Concurrency is how many uploads are made at once with the contents api
+	Concurrency int
+}
+
+// gitIdentity is the author or committer of a commit made with the git data api
+type gitIdentity struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	// Date is formatted as RFC 3339
+	Date string `json:"date,omitempty"`
+}
+
+// loadCommitOptions reads the commitOptions from the environment
+func loadCommitOptions(env Settings) (commitOptions, error) {
+	// currently, it does not seem that the github API accepts concurrent PUT requests (each one is a commit to the same branch, so they race and conflict),
+	// which is why the default is a single worker, making the uploads synchronous
+	opts := commitOptions{FilesPerCommit: 1, Backend: "contents", Concurrency: 1}
+	var err error
+	opts.Times, err = loadCommitTimes(env)
+	if err != nil {
+		return opts, err
+	}
+	opts.Signer, err = loadCommitSigner(env)
+	if err != nil {
+		return opts, err
+	}
+	opts.Messages, err = loadCommitMessages(env)
+	if err != nil {
+		return opts, err
+	}
+	opts.LLM, err = loadLLMProvider(env)
+	if err != nil {
+		return opts, err
+	}
+	opts.Content, err = loadContentOptions(env)
+	if err != nil {
+		return opts, err
+	}
+	name, email := env.get("COMMIT_AUTHOR_NAME"), env.get("COMMIT_AUTHOR_EMAIL")
+	if (name == "") != (email == "") {
+		return opts, fmt.Errorf("COMMIT_AUTHOR_NAME and COMMIT_AUTHOR_EMAIL must be set together")
+	}
+	if name != "" {
+		opts.Author = &gitIdentity{Name: name, Email: email}
+	}
+	if f, present := env.lookup("FILES_PER_COMMIT"); present {
+		opts.FilesPerCommit, err = strconv.Atoi(f)
+		if err != nil || opts.FilesPerCommit < 1 {
+			return opts, fmt.Errorf("Error parsing FILES_PER_COMMIT: must be a positive integer, got %q", f)
+		}
+	}
+	switch b := env.get("UPLOAD_BACKEND"); b {
+	case "", "contents":
+	case "git-data":
+		opts.Backend = b
+	default:
+		return opts, fmt.Errorf("Error parsing UPLOAD_BACKEND: must be contents or git-data, got %q", b)
+	}
+	if w, present := env.lookup("UPLOAD_CONCURRENCY"); present {
+		opts.Concurrency, err = strconv.Atoi(w)
+		if err != nil || opts.Concurrency < 1 {
+			return opts, fmt.Errorf("Error parsing UPLOAD_CONCURRENCY: must be a positive integer, got %q", w)
+		}
+	}
+	return opts, nil
+}
+
+// gitDataObject is the necessary data from the responses of the git data api that return a repository, ref, commit, tree or blob
+type gitDataObject struct {
+	SHA    string `json:"sha"`
+	Object struct {
+		SHA string `json:"sha"`
+	} `json:"object"`
+	Tree struct {
+		SHA string `json:"sha"`
+	} `json:"tree"`
+	DefaultBranch string `json:"default_branch"`
+	Message       string `json:"message"`
+}
+
+// uploadGitData commits updates to branch (or if it is "", the default branch) of the repository with the api url repoURL using the git data api instead of the contents api:
+// a blob is created for each file, then a tree and a commit for every opts.FilesPerCommit of them, each commit the parent of the next,
+// and finally the branch is moved to the last commit with a single ref update, so the branch is only ever changed once, and never races with itself
+// the ref update is not forced, so if the branch has moved on since it was read, nothing is changed and an error is returned
+func uploadGitData(ctx context.Context, repoURL string, branch string, updates []fileUpdate, opts commitOptions, client *http.Client) error {
+	refURL, parent, tree, err := branchHead(ctx, repoURL, branch, client)
+	if err != nil {
+		return err
+	}
+
+	// when the commits are dated explicitly, the api needs the whole identity that they are authored by, not only the date
+	commits := (len(updates) + opts.FilesPerCommit - 1) / opts.FilesPerCommit
+	dates := opts.Dates
+	if dates == nil {
+		dates = opts.Times.dates(commits, currentTime(ctx))
+	}
+	// a signature is made over the commit's identities and dates, so they must be set explicitly for the commit that github creates to match it
+	if dates == nil && opts.Signer != nil {
+		now := currentTime(ctx)
+		for i := 0; i < commits; i++ {
+			dates = append(dates, now)
+		}
+	}
+	var identity gitIdentity
+	if opts.Author != nil {
+		identity = *opts.Author
+	} else if dates != nil {
+		identity, err = authenticatedIdentity(ctx, client)
+		if err != nil {
+			return err
+		}
+	}
+
+	var made []string
+	for start := 0; start < len(updates); start += opts.FilesPerCommit {
+		end := start + opts.FilesPerCommit
+		if end > len(updates) {
+			end = len(updates)
+		}
+		var entries []map[string]interface{}
+		entryIndex := map[string]int{}
+		var messages []string
+		for _, u := range updates[start:end] {
+			mode := u.File.Mode
+			if mode == "" {
+				mode = defaultFileMode
+			}
+			// a null sha deletes the file from the tree
+			entry := map[string]interface{}{"path": u.File.Path, "mode": mode, "type": "blob", "sha": nil}
+			if !u.Delete {
+				var blob gitDataObject
+				err := jsonRequest(ctx, client, "POST", repoURL+"/git/blobs", map[string]string{
+					"content":  base64.StdEncoding.EncodeToString(u.Content),
+					"encoding": "base64",
+				}, &blob)
+				if err != nil {
+					return err
+				}
+				entry["sha"] = blob.SHA
+			}
+			// a file that is changed more than once in the same commit only has a single entry in its tree, with its last change
+			if j, ok := entryIndex[u.File.Path]; ok {
+				entries[j] = entry
+			} else {
+				entryIndex[u.File.Path] = len(entries)
+				entries = append(entries, entry)
+			}
+			messages = append(messages, u.Message)
+		}
+
+		var newTree gitDataObject
+		err := jsonRequest(ctx, client, "POST", repoURL+"/git/trees", map[string]interface{}{
+			"base_tree": tree,
+			"tree":      entries,
+		}, &newTree)
+		if err != nil {
+			return err
+		}
+		commitBody := map[string]interface{}{
+			"message": opts.Messages.finish(strings.Join(messages, "\n")),
+			"tree":    newTree.SHA,
+			"parents": []string{parent},
+		}
+		if dates != nil {
+			date := dates[start/opts.FilesPerCommit]
+			identity.Date = date.Format(time.RFC3339)
+			commitBody["author"] = identity
+			commitBody["committer"] = identity
+			if opts.Signer != nil {
+				signature, err := opts.Signer.sign(ctx, commitPayload(newTree.SHA, parent, identity, date, commitBody["message"].(string)))
+				if err != nil {
+					return err
+				}
+				commitBody["signature"] = signature
+			}
+		} else if opts.Author != nil {
+			commitBody["author"] = identity
+			commitBody["committer"] = identity
+		}
+		var commit gitDataObject
+		err = jsonRequest(ctx, client, "POST", repoURL+"/git/commits", commitBody, &commit)
+		if err != nil {
+			return err
+		}
+		tree, parent = newTree.SHA, commit.SHA
+		made = append(made, commit.SHA)
+	}
+
+	// the commits are only on the branch once its ref points to the last of them, so that is when they are recorded
+	if err := jsonRequest(ctx, client, "PATCH", refURL, map[string]interface{}{"sha": parent, "force": false}, nil); err != nil {
+		return err
+	}
+	recordFiles(ctx, updates...)
+	recordCommits(ctx, made...)
+	return nil
+}
+
+// branchHead returns the api url of the ref of branch (or if it is "", the default branch) of the repository with the api url repoURL,
+// and the sha of the commit it points to, and of that commit's tree
+func branchHead(ctx context.Context, repoURL string, branch string, client *http.Client) (refURL, commit, tree string, err error) {
+	if branch == "" {
+		var repo gitDataObject
+		if err := jsonRequest(ctx, client, "GET", repoURL, nil, &repo); err != nil {
+			return "", "", "", err
+		}
+		branch = repo.DefaultBranch
+	}
+	refURL = fmt.Sprintf("%v/git/refs/heads/%v", repoURL, branch)
+	var ref gitDataObject
+	if err := jsonRequest(ctx, client, "GET", refURL, nil, &ref); err != nil {
+		return "", "", "", err
+	}
+	var head gitDataObject
+	if err := jsonRequest(ctx, client, "GET", fmt.Sprintf("%v/git/commits/%v", repoURL, ref.Object.SHA), nil, &head); err != nil {
+		return "", "", "", err
+	}
+	return refURL, ref.Object.SHA, head.Tree.SHA, nil
+}
+
+// authenticatedIdentity returns the identity of the user that client is authenticated as, with their noreply email address,
+// which github always attributes to them (so the commits count as their contributions) without exposing their real email address
+func authenticatedIdentity(ctx context.Context, client *http.Client) (gitIdentity, error) {
+	var user struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+	}
+	if err := jsonRequest(ctx, client, "GET", "https://api.github.com/user", nil, &user); err != nil {
+		return gitIdentity{}, fmt.Errorf("Error finding the user to date commits as (a token for a user is needed to set commit dates): %w", err)
+	}
+	identity := gitIdentity{Name: user.Name, Email: fmt.Sprintf("%v+%v@users.noreply.github.com", user.ID, user.Login)}
+	if identity.Name == "" {
+		identity.Name = user.Login
+	}
+	return identity, nil
+}
+
+// APIError is the error for an unsuccessful response from the github api, so that callers can tell what the response was,
+// it is usually wrapped in errors that say what was being done, so find it with errors.As
+// it is the same type as repocontents.APIError, so that errors from listing a repository are found the same way
+type APIError = repocontents.APIError
+
+// isStatus reports whether err is, or wraps, an APIError for a response with the status code
+func isStatus(err error, code int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == code
+}
+
+// jsonRequest sends a request with the json encoding of body (if it is not nil) to url, and decodes the json response into out (if it is not nil)
+// an unsuccessful response is returned as an error, with the message that came with it
+func jsonRequest(ctx context.Context, client *http.Client, method, url string, body interface{}, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("Error marshalling data into request body: %w", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		return fmt.Errorf("Error creating http %v request for %v: %w", method, url, err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Error sending http %v request to %v: %w", method, url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var githubError errorResponse
+		json.NewDecoder(io.LimitReader(resp.Body, maxGitDataResponseBytes)).Decode(&githubError)
+		return &APIError{Method: method, URL: url, Status: resp.Status, StatusCode: resp.StatusCode, Message: githubError.Message}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxGitDataResponseBytes)).Decode(out); err != nil {
+		return fmt.Errorf("Error decoding json response from %v: %w", url, err)
+	}
+	return nil
+}
@@ -0,0 +1,637 @@
+//go:build !wasm
+
+package commitcron
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/anacanm/commitCron/auth"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+)
+
+// runGitEngine is run in place of run when ENGINE is git, it counts contributions the same way, but makes them by cloning the repository into the user's cache directory
+// (or updating the clone from a previous run), committing locally, and pushing, which takes a handful of requests however many contributions are made, and lets the commits be dated and grouped freely
+func runGitEngine(ctx context.Context, env Settings, account Account, client *http.Client, clientErr error, numberOfContributionsToMake int, minContributions int) (int, error) {
+	if clientErr != nil {
+		return 0, clientErr
+	}
+	started := time.Now()
+	counter, err := contributionsService(ctx, env, client)
+	if err != nil {
+		return 0, err
+	}
+	today, err := counter.Count(ctx, account.Username)
+	recordStep(ctx, "count", started)
+	if err != nil {
+		return 0, fmt.Errorf("Error getting contributions: %w", err)
+	}
+	recordContributions(ctx, today)
+	if today >= minContributions && minContributions != -1 {
+		return 0, nil
+	}
+
+	sel, err := loadSelection(env)
+	if err != nil {
+		return 0, err
+	}
+	started = time.Now()
+	made, err := gitEnginePush(ctx, env, account, client, numberOfContributionsToMake, sel)
+	recordStep(ctx, "push", started)
+	if err != nil {
+		return 0, err
+	}
+	return made, nil
+}
+
+// gitEngineDir returns the directory that the repository owner/repo is cloned into, inside the user's cache directory
+func gitEngineDir(owner, repo string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("Error finding user cache directory: %w", err)
+	}
+	return filepath.Join(dir, "commitcron", "clones", owner, repo), nil
+}
+
+// clientToken returns the token that client currently authorizes its requests with, for git to authenticate with too
+func clientToken(client *http.Client) (string, error) {
+	transport := client.Transport
+	if limited, ok := transport.(*rateLimitedTransport); ok {
+		transport = limited.base
+	}
+	authorized, ok := transport.(*auth.Transport)
+	if !ok {
+		return "", fmt.Errorf("the client has no token to authenticate git with")
+	}
+	return authorized.Source.Token()
+}
+
+// gitEngineRemote returns the url that the git engine clones the account's repository from and pushes to, and how it authenticates, as GIT_REMOTE says:
+// https (the default) authenticates with the token that client is authorized with, ssh with the key at SSH_KEY_PATH (decrypted with SSH_KEY_PASSPHRASE if it has one),
+// or if that is not set, with whatever keys the running ssh agent has
+// over ssh, github's host key is checked against the user's known_hosts file, as git itself would
+func gitEngineRemote(env Settings, account Account, client *http.Client) (string, transport.AuthMethod, error) {
+	switch remote := env.get("GIT_REMOTE"); remote {
+	case "", "https":
+		token, err := clientToken(client)
+		if err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf("https://github.com/%v/%v.git", account.Username, account.Repo), &githttp.BasicAuth{Username: "x-access-token", Password: token}, nil
+	case "ssh":
+		url := fmt.Sprintf("git@github.com:%v/%v.git", account.Username, account.Repo)
+		if keyPath := env.get("SSH_KEY_PATH"); keyPath != "" {
+			keys, err := gitssh.NewPublicKeysFromFile("git", keyPath, env.get("SSH_KEY_PASSPHRASE"))
+			if err != nil {
+				return "", nil, fmt.Errorf("Error reading SSH_KEY_PATH: %w", err)
+			}
+			return url, keys, nil
+		}
+		agent, err := gitssh.NewSSHAgentAuth("git")
+		if err != nil {
+			return "", nil, fmt.Errorf("Error connecting to the ssh agent, set SSH_KEY_PATH to use a key file instead: %w", err)
+		}
+		return url, agent, nil
+	default:
+		return "", nil, fmt.Errorf("Error parsing GIT_REMOTE: must be https or ssh, got %q", remote)
+	}
+}
+
+// gitEnginePush makes numberOfContributionsToMake contributions to the account's repository with git: the repository is cloned, the same files that would be updated
+// through the api are updated (and any remaining created), the changes are committed opts.FilesPerCommit at a time, dated as opts.Times says, and all of them are pushed at once
+// commits are authored by COMMIT_AUTHOR_NAME and COMMIT_AUTHOR_EMAIL if they are set, and otherwise by the user that the token belongs to, with their noreply email address
+// it returns the number of contributions that were made, which is fewer than numberOfContributionsToMake if PRE_COMMIT_COMMAND left any of the changes out
+func gitEnginePush(ctx context.Context, env Settings, account Account, client *http.Client, numberOfContributionsToMake int, sel Selection) (int, error) {
+	remoteURL, gitAuth, err := gitEngineRemote(env, account, client)
+	if err != nil {
+		return 0, err
+	}
+	repoURL := fmt.Sprintf("https://api.github.com/repos/%v/%v", account.Username, account.Repo)
+	if sel.Branch != "" {
+		if err := ensureBranch(ctx, repoURL, sel.Branch, "", client); err != nil {
+			return 0, err
+		}
+	}
+
+	dir, err := gitEngineDir(account.Username, account.Repo)
+	if err != nil {
+		return 0, err
+	}
+	// only the head commit of the one branch is needed, so that is all that is cloned, which keeps even large repositories quick to clone and small on disk
+	// (go-git can't filter out blobs as a partial clone would, but a clone of a single commit only has the blobs of its files anyway)
+	cloneOpts := &git.CloneOptions{
+		URL:          remoteURL,
+		Auth:         gitAuth,
+		Depth:        1,
+		SingleBranch: true,
+		Tags:         git.NoTags,
+	}
+	if sel.Branch != "" {
+		cloneOpts.ReferenceName = plumbing.NewBranchReferenceName(sel.Branch)
+	}
+	repo, err := openClone(ctx, dir, cloneOpts)
+	if err != nil {
+		return 0, err
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return 0, fmt.Errorf("Error opening the worktree of %v: %w", dir, err)
+	}
+
+	// the repository's .commitcronignore and .gitattributes files are read from the clone, instead of through the contents api
+	read := func(p string) ([]byte, bool, error) {
+		data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(p)))
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return data, err == nil, err
+	}
+	if err := sel.loadRepoFiles(read, account.Username); err != nil {
+		return 0, err
+	}
+	opts, err := loadCommitOptions(env)
+	if err != nil {
+		return 0, err
+	}
+
+	// the files of the head commit are listed with their blob shas, which play the same role as the shas the contents api reports
+	// unless in journal, changelog or recreate mode, where there are no files to choose
+	var candidates []RepoContent
+	head, err := repo.Head()
+	// base is the commit that the run's commits are made on top of, which is what the branch must still be when they are pushed, or zero if the repository is empty
+	base := plumbing.ZeroHash
+	if err == nil {
+		base = head.Hash()
+	}
+	if err == nil && opts.Content.Mode == "files" {
+		commit, err := repo.CommitObject(head.Hash())
+		if err != nil {
+			return 0, fmt.Errorf("Error reading the head commit of %v: %w", dir, err)
+		}
+		files, err := commit.Files()
+		if err != nil {
+			return 0, fmt.Errorf("Error listing the files of %v: %w", dir, err)
+		}
+		err = files.ForEach(func(f *object.File) error {
+			if f.Mode.IsFile() && sel.allows(f.Name) {
+				candidates = append(candidates, RepoContent{Name: path.Base(f.Name), Path: f.Name, SHA: f.Hash.String(), Type: "file", Mode: fmt.Sprintf("%o", uint32(f.Mode))})
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, fmt.Errorf("Error listing the files of %v: %w", dir, err)
+		}
+	}
+	contents, err := chooseLocalFiles(dir, candidates, numberOfContributionsToMake, sel, opts, read, localDirLister(dir), currentTime(ctx))
+	if err != nil {
+		return 0, err
+	}
+	updates, err := prepareUpdates(ctx, contents, sel, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	// the commits are signed as COMMIT_SIGNING says, or if it is not set, as the user's gitconfig says, as if the commits were made with git itself
+	// signing happens here, with the user's own gpg or ssh-keygen, so private keys never leave the machine
+	signer := opts.Signer
+	if signer == nil {
+		cfg, err := config.LoadConfig(config.GlobalScope)
+		if err != nil {
+			return 0, fmt.Errorf("Error reading gitconfig: %w", err)
+		}
+		if signer, err = gitConfigSigner(cfg); err != nil {
+			return 0, err
+		}
+	}
+
+	identity := gitIdentity{}
+	if opts.Author != nil {
+		identity = *opts.Author
+	} else if identity, err = authenticatedIdentity(ctx, client); err != nil {
+		return 0, err
+	}
+	check, err := loadPreCommitCommand(env)
+	if err != nil {
+		return 0, err
+	}
+
+	commits := (len(updates) + opts.FilesPerCommit - 1) / opts.FilesPerCommit
+	dates := opts.Times.dates(commits, currentTime(ctx))
+	committed := 0
+	// applied are the updates that were committed, ie. that passed PRE_COMMIT_COMMAND, if there is one
+	var applied []fileUpdate
+	for start := 0; start < len(updates); start += opts.FilesPerCommit {
+		end := start + opts.FilesPerCommit
+		if end > len(updates) {
+			end = len(updates)
+		}
+		var messages []string
+		for _, u := range updates[start:end] {
+			if sel.protects(u.File.Path) {
+				return 0, fmt.Errorf("refusing to modify %v, it is protected by PROTECTED_PATHS", u.File.Path)
+			}
+			if check == nil || u.Delete {
+				if err := applyUpdate(worktree, dir, u); err != nil {
+					return 0, err
+				}
+				messages = append(messages, u.Message)
+				applied = append(applied, u)
+				continue
+			}
+			passed, err := applyCheckedUpdate(ctx, worktree, dir, u, check)
+			if err != nil {
+				return 0, err
+			}
+			if passed {
+				messages = append(messages, u.Message)
+				applied = append(applied, u)
+			}
+		}
+		if len(messages) == 0 {
+			// every change in the commit failed PRE_COMMIT_COMMAND, so there is nothing to commit
+			continue
+		}
+		committed++
+		when := currentTime(ctx)
+		if dates != nil {
+			when = dates[start/opts.FilesPerCommit]
+		}
+		signature := &object.Signature{Name: identity.Name, Email: identity.Email, When: when}
+		// every update changes its file (see prepareUpdates), but go-git takes a commit that deletes the last file of the repository for an empty one, so its check is skipped
+		commitOpts := &git.CommitOptions{Author: signature, Committer: signature, AllowEmptyCommits: true}
+		hash, err := worktree.Commit(opts.Messages.finish(strings.Join(messages, "\n")), commitOpts)
+		if err != nil {
+			return 0, fmt.Errorf("Error committing to %v: %w", dir, err)
+		}
+		if signer != nil {
+			if err := signCommit(ctx, repo, hash, *signer); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if committed == 0 {
+		logger(ctx).Warn("Nothing was committed, every change failed PRE_COMMIT_COMMAND", "url", cloneOpts.URL)
+		return 0, nil
+	}
+	head, err = repo.Head()
+	if err != nil {
+		return 0, fmt.Errorf("Error reading the head of %v: %w", dir, err)
+	}
+	if err := checkFastForward(ctx, repo, gitAuth, head, base); err != nil {
+		return 0, fmt.Errorf("refusing to push to %v: %w", cloneOpts.URL, err)
+	}
+	// the refspec has no "+", so the push is never forced, and the branch is required to still be base when the push is made, in case it moved since it was checked
+	pushOpts := &git.PushOptions{Auth: gitAuth, RefSpecs: []config.RefSpec{config.RefSpec(fmt.Sprintf("%v:%v", head.Name(), head.Name()))}}
+	if !base.IsZero() {
+		pushOpts.RequireRemoteRefs = []config.RefSpec{config.RefSpec(fmt.Sprintf("%v:%v", base, head.Name()))}
+	}
+	if err := repo.PushContext(ctx, pushOpts); err != nil {
+		return 0, fmt.Errorf("Error pushing to %v: %w", cloneOpts.URL, err)
+	}
+
+	// the commits that were pushed are the last committed on the branch (signing replaced each of them, so their hashes are only known now),
+	// and they are only reported, so failing to list them doesn't fail the push that has already been made
+	recordFiles(ctx, applied...)
+	pushed, err := lastCommits(repo, head.Hash(), committed)
+	if err != nil {
+		logger(ctx).Warn("Error listing the commits that were pushed", "dir", dir, "err", err)
+		return len(applied), nil
+	}
+	recordCommits(ctx, pushed...)
+	return len(applied), nil
+}
+
+// lastCommits returns the hashes of the n commits that lead up to, and include, head, oldest first, following each commit's first parent
+func lastCommits(repo *git.Repository, head plumbing.Hash, n int) ([]string, error) {
+	hashes := make([]string, n)
+	for i := n - 1; i >= 0; i-- {
+		commit, err := repo.CommitObject(head)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading commit %v: %w", head, err)
+		}
+		hashes[i] = commit.Hash.String()
+		if commit.NumParents() == 0 {
+			return hashes[i:], nil
+		}
+		head = commit.ParentHashes[0]
+	}
+	return hashes, nil
+}
+
+// checkFastForward returns an error unless pushing head to the remote would be a fast-forward that only adds the run's commits, ie. head descends from base
+// through a single line of commits (so nothing that was there before has been rewritten), and the remote branch is still base (or doesn't exist, if base is zero),
+// so that someone else's commits, pushed since the clone was made, are never overwritten
+func checkFastForward(ctx context.Context, repo *git.Repository, gitAuth transport.AuthMethod, head *plumbing.Reference, base plumbing.Hash) error {
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return fmt.Errorf("Error reading commit %v: %w", head.Hash(), err)
+	}
+	for commit.Hash != base {
+		if commit.NumParents() == 0 && base.IsZero() {
+			break
+		}
+		if commit.NumParents() != 1 {
+			return fmt.Errorf("%v does not descend from %v in a single line of commits, the branch's history would be rewritten", head.Hash(), base)
+		}
+		if commit, err = commit.Parent(0); err != nil {
+			return fmt.Errorf("%v does not descend from %v, the branch's history would be rewritten: %w", head.Hash(), base, err)
+		}
+	}
+
+	remote, err := repo.Remote(git.DefaultRemoteName)
+	if err != nil {
+		return fmt.Errorf("Error reading remote %v: %w", git.DefaultRemoteName, err)
+	}
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: gitAuth})
+	if err != nil && !errors.Is(err, transport.ErrEmptyRemoteRepository) {
+		return fmt.Errorf("Error listing the remote's branches: %w", err)
+	}
+	current := plumbing.ZeroHash
+	for _, ref := range refs {
+		if ref.Name() == head.Name() {
+			current = ref.Hash()
+		}
+	}
+	if current != base {
+		return fmt.Errorf("%v is now %v, not %v, someone else has pushed to it since it was cloned, and the push would not be a fast-forward", head.Name().Short(), current, base)
+	}
+	return nil
+}
+
+// signCommit replaces the commit hash, which must be the head of repo, with the same commit signed by signer, and moves the head to it
+// go-git can only sign with a gpg key that it is given the private half of, so instead the commit is signed the way git itself signs, by running gpg or ssh-keygen
+func signCommit(ctx context.Context, repo *git.Repository, hash plumbing.Hash, signer commitSigner) error {
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		return fmt.Errorf("Error reading commit %v: %w", hash, err)
+	}
+	payload := repo.Storer.NewEncodedObject()
+	if err := commit.EncodeWithoutSignature(payload); err != nil {
+		return fmt.Errorf("Error encoding commit %v: %w", hash, err)
+	}
+	reader, err := payload.Reader()
+	if err != nil {
+		return fmt.Errorf("Error encoding commit %v: %w", hash, err)
+	}
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("Error encoding commit %v: %w", hash, err)
+	}
+	if commit.PGPSignature, err = signer.sign(ctx, data); err != nil {
+		return err
+	}
+	signed := repo.Storer.NewEncodedObject()
+	if err := commit.Encode(signed); err != nil {
+		return fmt.Errorf("Error encoding signed commit %v: %w", hash, err)
+	}
+	signedHash, err := repo.Storer.SetEncodedObject(signed)
+	if err != nil {
+		return fmt.Errorf("Error storing signed commit %v: %w", hash, err)
+	}
+	head, err := repo.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return fmt.Errorf("Error reading HEAD: %w", err)
+	}
+	name := plumbing.HEAD
+	if head.Type() == plumbing.SymbolicReference {
+		name = head.Target()
+	}
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(name, signedHash)); err != nil {
+		return fmt.Errorf("Error moving %v to the signed commit: %w", name, err)
+	}
+	return nil
+}
+
+// openClone returns the clone in dir made with cloneOpts by a previous run, brought up to date with the remote, or if there is none, or it can't be reused
+// (eg. it is corrupt, or of another branch), clones the repository into dir afresh
+func openClone(ctx context.Context, dir string, cloneOpts *git.CloneOptions) (*git.Repository, error) {
+	repo, err := reuseClone(ctx, dir, cloneOpts)
+	if err == nil {
+		return repo, nil
+	}
+	if _, statErr := os.Stat(dir); statErr == nil {
+		logger(ctx).Warn("Can't reuse the clone, cloning again", "dir", dir, "err", err)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, fmt.Errorf("Error removing the previous clone in %v: %w", dir, err)
+	}
+	repo, err = git.PlainCloneContext(ctx, dir, false, cloneOpts)
+	if errors.Is(err, transport.ErrEmptyRemoteRepository) {
+		// an empty repository can't be cloned, but it can be pushed to, so the history is started from scratch
+		repo, err = git.PlainInit(dir, false)
+		if err == nil {
+			_, err = repo.CreateRemote(&config.RemoteConfig{Name: git.DefaultRemoteName, URLs: []string{cloneOpts.URL}})
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error cloning %v: %w", cloneOpts.URL, err)
+	}
+	return repo, nil
+}
+
+// reuseClone opens the clone in dir, fetches the head of its branch, and hard resets it to that, discarding anything a previous run left behind (eg. commits that it failed to push),
+// so that the clone is of the repository as it is now, or returns an error if the clone doesn't exist, or isn't one that cloneOpts would have made, or is corrupt
+// this is the only place anything is ever reset, and only ever in this script's own clone
+func reuseClone(ctx context.Context, dir string, cloneOpts *git.CloneOptions) (*git.Repository, error) {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := repo.Remote(git.DefaultRemoteName)
+	if err != nil {
+		return nil, err
+	}
+	if urls := remote.Config().URLs; len(urls) != 1 || urls[0] != cloneOpts.URL {
+		return nil, fmt.Errorf("it is a clone of %v, not %v", urls, cloneOpts.URL)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	// a ReferenceName of HEAD (which cloning fills in when none is set) is the default branch, which the clone is assumed to still have checked out
+	if want := cloneOpts.ReferenceName; !head.Name().IsBranch() || (want != "" && want != plumbing.HEAD && head.Name() != want) {
+		return nil, fmt.Errorf("it has %v checked out, not %v", head.Name(), cloneOpts.ReferenceName)
+	}
+
+	branch := head.Name().Short()
+	tracking := plumbing.NewRemoteReferenceName(git.DefaultRemoteName, branch)
+	err = repo.FetchContext(ctx, &git.FetchOptions{
+		Auth:     cloneOpts.Auth,
+		Depth:    cloneOpts.Depth,
+		Tags:     cloneOpts.Tags,
+		RefSpecs: []config.RefSpec{config.RefSpec(fmt.Sprintf("+%v:%v", head.Name(), tracking))},
+		Force:    true,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return nil, err
+	}
+	latest, err := repo.Reference(tracking, true)
+	if err != nil {
+		return nil, err
+	}
+	// a clone whose objects can't be read is corrupt, which is found out here rather than in the middle of committing
+	commit, err := repo.CommitObject(latest.Hash())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := commit.Tree(); err != nil {
+		return nil, err
+	}
+
+	// a hard reset discards whatever is in the worktree, so it is only ever done in a clone inside the cache directory that this script owns
+	cache, err := gitEngineDir("", "")
+	if err != nil {
+		return nil, err
+	}
+	if rel, err := filepath.Rel(cache, dir); err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return nil, fmt.Errorf("refusing to reset %v, it is not in %v", dir, cache)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	if err := worktree.Reset(&git.ResetOptions{Commit: latest.Hash(), Mode: git.HardReset}); err != nil {
+		return nil, err
+	}
+	if err := worktree.Clean(&git.CleanOptions{Dir: true}); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// applyUpdate makes the change of u to the worktree of the clone in dir, and stages it
+func applyUpdate(worktree *git.Worktree, dir string, u fileUpdate) error {
+	if u.Delete {
+		if _, err := worktree.Remove(u.File.Path); err != nil {
+			return fmt.Errorf("Error removing %v: %w", u.File.Path, err)
+		}
+		return nil
+	}
+	local := filepath.Join(dir, filepath.FromSlash(u.File.Path))
+	// new files may be created in a TARGET_PATH that does not exist yet
+	if err := os.MkdirAll(filepath.Dir(local), 0755); err != nil {
+		return fmt.Errorf("Error creating the directory for %v: %w", u.File.Path, err)
+	}
+	if err := ioutil.WriteFile(local, u.Content, 0644); err != nil {
+		return fmt.Errorf("Error writing %v: %w", u.File.Path, err)
+	}
+	if _, err := worktree.Add(u.File.Path); err != nil {
+		return fmt.Errorf("Error staging %v: %w", u.File.Path, err)
+	}
+	return nil
+}
+
+// loadPreCommitCommand reads PRE_COMMIT_COMMAND, the command that each file the git engine changes is checked with before it is committed,
+// split into its arguments as FORMAT_COMMAND is, or returns nil if it is not set
+func loadPreCommitCommand(env Settings) ([]string, error) {
+	c, present := env.lookup("PRE_COMMIT_COMMAND")
+	if !present {
+		return nil, nil
+	}
+	command := strings.Fields(c)
+	if len(command) == 0 {
+		return nil, fmt.Errorf("Error parsing PRE_COMMIT_COMMAND: it is empty")
+	}
+	return command, nil
+}
+
+// applyCheckedUpdate applies u as applyUpdate does, then runs check in the clone in dir, with the path of u's file as its last argument,
+// and if it fails, puts the file back as it was, so that it is left out of the commit, and returns false
+// a failing check is not an error, the rest of the changes are still committed, only errors applying or undoing the change are returned
+func applyCheckedUpdate(ctx context.Context, worktree *git.Worktree, dir string, u fileUpdate, check []string) (bool, error) {
+	local := filepath.Join(dir, filepath.FromSlash(u.File.Path))
+	previous, err := ioutil.ReadFile(local)
+	existed := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("Error reading %v: %w", u.File.Path, err)
+	}
+	if err := applyUpdate(worktree, dir, u); err != nil {
+		return false, err
+	}
+
+	cmd := exec.CommandContext(ctx, check[0], append(check[1:], u.File.Path)...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		return true, nil
+	}
+	logger(ctx).Warn("Leaving a file out, it failed PRE_COMMIT_COMMAND", "path", u.File.Path, "err", err, "output", strings.TrimSpace(string(out)))
+
+	if existed {
+		return false, applyUpdate(worktree, dir, fileUpdate{File: u.File, Content: previous})
+	}
+	if err := os.Remove(local); err != nil {
+		return false, fmt.Errorf("Error removing %v: %w", u.File.Path, err)
+	}
+	if _, err := worktree.Remove(u.File.Path); err != nil {
+		return false, fmt.Errorf("Error unstaging %v: %w", u.File.Path, err)
+	}
+	return false, nil
+}
+
+// chooseLocalFiles chooses numberOfContributionsToMake of candidates, which are files in the clone in dir, to be modified, the same way chooseFiles does for the contents api,
+// and fills the rest with new files (or the journal, in journal, changelog or recreate mode), as the api does, with read reading the clone, and list listing it
+func chooseLocalFiles(dir string, candidates []RepoContent, numberOfContributionsToMake int, sel Selection, opts commitOptions, read repoFileReader, list repoDirLister, now time.Time) ([]RepoContent, error) {
+	shuffleCandidates(candidates)
+
+	contents := make([]RepoContent, 0, numberOfContributionsToMake)
+	for _, candidate := range candidates {
+		if len(contents) == numberOfContributionsToMake {
+			break
+		}
+		// files that are too large or have binary content are skipped here too, as chooseFiles does for the contents api
+		local := filepath.Join(dir, filepath.FromSlash(candidate.Path))
+		if info, err := os.Stat(local); err != nil || !sel.fits(info.Size()) {
+			continue
+		}
+		data, err := ioutil.ReadFile(local)
+		if err != nil || isBinary(data) {
+			continue
+		}
+		candidate.Content = data
+		contents = append(contents, candidate)
+	}
+	if sel.ReuseGenerated {
+		contents = sel.reuseGenerated(contents, numberOfContributionsToMake)
+	}
+	if opts.Content.Mode != "files" {
+		return journalContents(read, opts.Content.journalFile(sel, now), numberOfContributionsToMake)
+	}
+	return addNewFiles(contents, sel, read, list, now)
+}
+
+// localDirLister returns a repoDirLister that lists the directories of the clone in dir
+func localDirLister(dir string) repoDirLister {
+	return func(p, ext string) ([]string, error) {
+		entries, err := os.ReadDir(filepath.Join(dir, filepath.FromSlash(p)))
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error listing %v: %w", p, err)
+		}
+		var paths []string
+		for _, e := range entries {
+			if e.Type().IsRegular() && path.Ext(e.Name()) == ext {
+				paths = append(paths, path.Join(p, e.Name()))
+			}
+		}
+		return paths, nil
+	}
+}
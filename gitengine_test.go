@@ -0,0 +1,276 @@
+//go:build !wasm
+
+package commitcron
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// newRemote returns the path of a new bare repository, to be cloned and pushed to as the remote
+func newRemote(t *testing.T) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "remote.git")
+	if _, err := git.PlainInit(dir, true); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// cloneRemote clones remote into dir, or if remote is empty, initializes dir with remote as its origin
+func cloneRemote(t *testing.T, remote, dir string) *git.Repository {
+	t.Helper()
+	repo, err := git.PlainClone(dir, false, &git.CloneOptions{URL: remote})
+	if err == nil {
+		return repo
+	}
+	repo, err = git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.CreateRemote(&config.RemoteConfig{Name: git.DefaultRemoteName, URLs: []string{remote}}); err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+// commitFile writes content to name in the worktree of repo, and commits it with parents as the commit's parents, or the head if parents is nil
+func commitFile(t *testing.T, repo *git.Repository, name, content string, parents ...plumbing.Hash) plumbing.Hash {
+	t.Helper()
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(worktree.Filesystem.Root(), name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := worktree.Add(name); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := worktree.Commit("change "+name, &git.CommitOptions{
+		Author:  &object.Signature{Name: "test", Email: "test@example.com", When: time.Unix(1700000000, 0)},
+		Parents: parents,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+// push pushes the head of repo to the remote
+func push(t *testing.T, repo *git.Repository) {
+	t.Helper()
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	refSpec := config.RefSpec(head.Name().String() + ":" + head.Name().String())
+	if err := repo.Push(&git.PushOptions{RefSpecs: []config.RefSpec{refSpec}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// head returns the head of repo
+func head(t *testing.T, repo *git.Repository) *plumbing.Reference {
+	t.Helper()
+	ref, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ref
+}
+
+func TestCheckFastForward(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("fast-forward", func(t *testing.T) {
+		remote := newRemote(t)
+		seed := cloneRemote(t, remote, t.TempDir())
+		commitFile(t, seed, "a.txt", "a")
+		push(t, seed)
+
+		repo := cloneRemote(t, remote, t.TempDir())
+		base := head(t, repo).Hash()
+		commitFile(t, repo, "b.txt", "b")
+		commitFile(t, repo, "c.txt", "c")
+		if err := checkFastForward(ctx, repo, nil, head(t, repo), base); err != nil {
+			t.Fatalf("checkFastForward = %v, want nil", err)
+		}
+	})
+
+	t.Run("remote moved since the clone", func(t *testing.T) {
+		remote := newRemote(t)
+		seed := cloneRemote(t, remote, t.TempDir())
+		commitFile(t, seed, "a.txt", "a")
+		push(t, seed)
+
+		repo := cloneRemote(t, remote, t.TempDir())
+		base := head(t, repo).Hash()
+		commitFile(t, repo, "b.txt", "b")
+
+		// someone else pushes to the branch after the clone was made
+		commitFile(t, seed, "a.txt", "someone else's change")
+		push(t, seed)
+
+		err := checkFastForward(ctx, repo, nil, head(t, repo), base)
+		if err == nil || !strings.Contains(err.Error(), "someone else has pushed") {
+			t.Fatalf("checkFastForward = %v, want an error about someone else pushing", err)
+		}
+	})
+
+	t.Run("head is not a single line of descent from base", func(t *testing.T) {
+		remote := newRemote(t)
+		seed := cloneRemote(t, remote, t.TempDir())
+		root := commitFile(t, seed, "a.txt", "a")
+		push(t, seed)
+
+		repo := cloneRemote(t, remote, t.TempDir())
+		base := head(t, repo).Hash()
+		side := commitFile(t, repo, "b.txt", "b")
+		// a merge of the run's commit with a commit that was never on the branch
+		other := commitFile(t, repo, "c.txt", "c", root)
+		commitFile(t, repo, "d.txt", "d", side, other)
+
+		err := checkFastForward(ctx, repo, nil, head(t, repo), base)
+		if err == nil || !strings.Contains(err.Error(), "single line") {
+			t.Fatalf("checkFastForward = %v, want an error about a single line of commits", err)
+		}
+	})
+
+	t.Run("head does not descend from base", func(t *testing.T) {
+		remote := newRemote(t)
+		seed := cloneRemote(t, remote, t.TempDir())
+		commitFile(t, seed, "a.txt", "a")
+		push(t, seed)
+
+		// the branch's history is rewritten: head is a new root commit, with the same files, that base is not an ancestor of
+		repo := cloneRemote(t, remote, t.TempDir())
+		base := head(t, repo).Hash()
+		previous, err := repo.CommitObject(base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		orphan := &object.Commit{Author: previous.Author, Committer: previous.Committer, Message: "rewritten", TreeHash: previous.TreeHash}
+		obj := repo.Storer.NewEncodedObject()
+		if err := orphan.Encode(obj); err != nil {
+			t.Fatal(err)
+		}
+		hash, err := repo.Storer.SetEncodedObject(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ref := plumbing.NewHashReference(head(t, repo).Name(), hash)
+		if err := checkFastForward(ctx, repo, nil, ref, base); err == nil {
+			t.Fatal("checkFastForward = nil, want an error for a head that does not descend from base")
+		}
+	})
+
+	t.Run("empty remote", func(t *testing.T) {
+		remote := newRemote(t)
+		repo := cloneRemote(t, remote, t.TempDir())
+		commitFile(t, repo, "a.txt", "a")
+		commitFile(t, repo, "b.txt", "b")
+		if err := checkFastForward(ctx, repo, nil, head(t, repo), plumbing.ZeroHash); err != nil {
+			t.Fatalf("checkFastForward = %v, want nil for a new history pushed to an empty remote", err)
+		}
+	})
+
+	t.Run("remote no longer empty", func(t *testing.T) {
+		remote := newRemote(t)
+		repo := cloneRemote(t, remote, t.TempDir())
+		commitFile(t, repo, "a.txt", "a")
+
+		seed := cloneRemote(t, remote, t.TempDir())
+		commitFile(t, seed, "b.txt", "someone else's first commit")
+		push(t, seed)
+
+		err := checkFastForward(ctx, repo, nil, head(t, repo), plumbing.ZeroHash)
+		if err == nil || !strings.Contains(err.Error(), "someone else has pushed") {
+			t.Fatalf("checkFastForward = %v, want an error about someone else pushing", err)
+		}
+	})
+}
+
+func TestReuseClone(t *testing.T) {
+	ctx := context.Background()
+	// the cache directory that clones are confined to is inside the test's own directory
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	remote := newRemote(t)
+	seed := cloneRemote(t, remote, t.TempDir())
+	commitFile(t, seed, "a.txt", "a")
+	push(t, seed)
+
+	t.Run("outside the cache", func(t *testing.T) {
+		dir := t.TempDir()
+		repo := cloneRemote(t, remote, dir)
+		commitFile(t, repo, "local.txt", "a commit that a reset would discard")
+		left := filepath.Join(dir, "untracked.txt")
+		if err := os.WriteFile(left, []byte("untracked"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := reuseClone(ctx, dir, &git.CloneOptions{URL: remote})
+		if err == nil || !strings.Contains(err.Error(), "refusing to reset") {
+			t.Fatalf("reuseClone = %v, want it to refuse to reset a directory outside the cache", err)
+		}
+		if _, err := os.Stat(left); err != nil {
+			t.Fatalf("the untracked file was removed: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "local.txt")); err != nil {
+			t.Fatalf("the local commit was reset: %v", err)
+		}
+	})
+
+	t.Run("the cache directory itself", func(t *testing.T) {
+		cache, err := gitEngineDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cloneRemote(t, remote, cache)
+		if _, err := reuseClone(ctx, cache, &git.CloneOptions{URL: remote}); err == nil || !strings.Contains(err.Error(), "refusing to reset") {
+			t.Fatalf("reuseClone = %v, want it to refuse to reset the cache directory itself", err)
+		}
+	})
+
+	t.Run("inside the cache", func(t *testing.T) {
+		dir, err := gitEngineDir("owner", "repo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		repo := cloneRemote(t, remote, dir)
+		commitFile(t, repo, "local.txt", "a commit that a previous run failed to push")
+
+		repo, err = reuseClone(ctx, dir, &git.CloneOptions{URL: remote})
+		if err != nil {
+			t.Fatalf("reuseClone = %v, want nil", err)
+		}
+		if got, want := head(t, repo).Hash(), head(t, seed).Hash(); got != want {
+			t.Fatalf("the clone's head is %v, want the remote's %v", got, want)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "local.txt")); !os.IsNotExist(err) {
+			t.Fatalf("the unpushed commit's file is still there: %v", err)
+		}
+	})
+
+	t.Run("a clone of another repository", func(t *testing.T) {
+		dir, err := gitEngineDir("owner", "other")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cloneRemote(t, remote, dir)
+		if _, err := reuseClone(ctx, dir, &git.CloneOptions{URL: newRemote(t)}); err == nil {
+			t.Fatal("reuseClone = nil, want an error for a clone of another remote")
+		}
+	})
+}
@@ -0,0 +1,147 @@
+package commitcron
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/anacanm/commitCron/contributions"
+	"github.com/anacanm/commitCron/repocontents"
+)
+
+// ContributionsReader counts the contributions that a user has made today, contributions.Service counts them with the github api
+type ContributionsReader interface {
+	Count(ctx context.Context, username string) (int, error)
+}
+
+// RepoLister lists and reads the files in a repository, which is everything that planning needs to know about it
+type RepoLister interface {
+	// ListFiles returns the files in the repository owner/repo, on sel.Branch (or the default branch if it is ""), that sel allows and that fit within its size ceiling,
+	// or if there are too many to list at once, a random sample of them, of at least sample files if there are that many
+	ListFiles(ctx context.Context, owner, repo string, sel Selection, sample int) ([]RepoContent, error)
+	// ReadFile returns the content of the file at the slash separated path p in owner/repo, on ref (or the default branch if it is ""), or false if there is no such file,
+	// or it is larger than limit bytes
+	ReadFile(ctx context.Context, owner, repo, ref, p string, limit int64) ([]byte, bool, error)
+	// LastModified returns when the file at p in owner/repo was last modified on ref (or the default branch if it is ""), or the zero time if it never was
+	LastModified(ctx context.Context, owner, repo, ref, p string) (time.Time, error)
+}
+
+// FileWriter commits the changes in a plan to its repository, on its branch (or the default branch if it is "")
+type FileWriter interface {
+	WriteFiles(ctx context.Context, plan *Plan) error
+}
+
+// githubAPI implements RepoLister and FileWriter with the github api, with client, which is authorized as the account whose repository is changed
+// sel and opts are only used to write files, planning is passed its own
+type githubAPI struct {
+	client *http.Client
+	sel    Selection
+	opts   commitOptions
+}
+
+// contributionsService returns the contributions.Service that counts contributions with client, with the backend that CONTRIBUTIONS_BACKEND names,
+// by the clock of the Runner that ctx carries, and in its cache
+func contributionsService(ctx context.Context, env Settings, client *http.Client) (*contributions.Service, error) {
+	backend, err := loadContributionsBackend(env)
+	if err != nil {
+		return nil, err
+	}
+	service := contributions.NewService(client)
+	service.Now = func() time.Time { return currentTime(ctx) }
+	service.Backend = backend
+	service.Cache = runnerFrom(ctx).counts
+	return service, nil
+}
+
+// loadContributionsBackend reads CONTRIBUTIONS_BACKEND, which is how contributions are counted: events (the default) from the events api, or graphql from the contribution calendar
+func loadContributionsBackend(env Settings) (contributions.Backend, error) {
+	switch b := contributions.Backend(env.get("CONTRIBUTIONS_BACKEND")); b {
+	case "", contributions.Events:
+		return contributions.Events, nil
+	case contributions.GraphQL:
+		return b, nil
+	default:
+		return "", fmt.Errorf("Error parsing CONTRIBUTIONS_BACKEND: must be events or graphql, got %q", b)
+	}
+}
+
+// ListFiles lists the repository with repocontents, which lists it with a single request to the git trees api, unless it is too large to be listed at once,
+// in which case only the sample files closest to its root are listed
+func (g *githubAPI) ListFiles(ctx context.Context, owner, repo string, sel Selection, sample int) ([]RepoContent, error) {
+	files, err := repoLister(ctx, sel, g.client).List(ctx, repocontents.Repo{Owner: owner, Name: repo, Ref: sel.Branch}, sel.filter(sample))
+	if err != nil {
+		return nil, err
+	}
+	contents := make([]RepoContent, 0, len(files))
+	for _, f := range files {
+		contents = append(contents, RepoContent{Name: f.Name, Path: f.Path, SHA: f.SHA, Type: "file", Size: f.Size, Mode: f.Mode})
+	}
+	return contents, nil
+}
+
+// repoLister returns the repocontents.Lister that lists repositories with client, and logs with the logger of the Runner that ctx carries,
+// which caches the listings in the user's cache directory, unless sel.NoListingCache is set (or there is no cache directory)
+func repoLister(ctx context.Context, sel Selection, client *http.Client) *repocontents.Lister {
+	lister := repocontents.NewLister(client)
+	lister.Logger = logger(ctx)
+	if !sel.NoListingCache {
+		// without a cache directory, every repository is listed in full, which is only slower
+		lister.CacheDir, _ = repocontents.DefaultCacheDir()
+	}
+	return lister
+}
+
+// ReadFile reads the file through the contents api (see getRawFile)
+func (g *githubAPI) ReadFile(ctx context.Context, owner, repo, ref, p string, limit int64) ([]byte, bool, error) {
+	return getRawFile(ctx, repoContentsURL(owner, repo), p, ref, limit, g.client)
+}
+
+// LastModified finds the file's last commit with the commits api (see lastModified)
+func (g *githubAPI) LastModified(ctx context.Context, owner, repo, ref, p string) (time.Time, error) {
+	return lastModified(ctx, owner, repo, p, ref, g.client)
+}
+
+// WriteFiles uploads the plan's changes with the contents api, or the git data api (see uploadUpdates)
+func (g *githubAPI) WriteFiles(ctx context.Context, plan *Plan) error {
+	updates, err := plan.updates()
+	if err != nil {
+		return err
+	}
+	sel, opts := g.sel, g.opts
+	sel.Branch = plan.Branch
+	opts.FilesPerCommit, opts.Dates = plan.FilesPerCommit, plan.CommitDates
+	if opts.FilesPerCommit < 1 {
+		opts.FilesPerCommit = 1
+	}
+	return uploadUpdates(ctx, repoContentsURL(plan.Username, plan.Repo), updates, sel, opts, g.client)
+}
+
+// repoContentsURL returns the contents url of the root directory of owner/repo
+func repoContentsURL(owner, repo string) string {
+	return fmt.Sprintf("https://api.github.com/repos/%v/%v/contents", owner, repo)
+}
+
+// listerFileReader returns a repoFileReader that reads files with lister from owner/repo, on ref, or the default branch if ref is ""
+func listerFileReader(ctx context.Context, lister RepoLister, owner, repo, ref string) repoFileReader {
+	return func(p string) ([]byte, bool, error) {
+		return lister.ReadFile(ctx, owner, repo, ref, p, maxRepoFileBytes)
+	}
+}
+
+// listerDirLister returns a repoDirLister that lists directories of owner/repo, on ref (or the default branch if it is ""), with lister,
+// by listing the repository with a Selection of only the directory's files with the extension
+func listerDirLister(ctx context.Context, lister RepoLister, owner, repo, ref string) repoDirLister {
+	return func(dir, ext string) ([]string, error) {
+		sel := Selection{Branch: ref, TargetPath: dir, MaxDepth: 0, MaxFileSize: maxRawFileBytes, Extensions: ExtensionRules{{Extension: ext}}}
+		files, err := lister.ListFiles(ctx, owner, repo, sel, 0)
+		if err != nil {
+			return nil, err
+		}
+		paths := make([]string, 0, len(files))
+		for _, f := range files {
+			paths = append(paths, f.Path)
+		}
+		return paths, nil
+	}
+}
@@ -0,0 +1,67 @@
+package commitcron
+
+import (
+	"context"
+	"fmt"
+)
+
+// Hooks are called at points in a run, so that a program embedding the pipeline can veto what it is about to do, record metrics, or act on what it did (see WithHooks)
+// any of them may be nil, and they are called from the goroutines that the run makes contributions in, so they may be called concurrently, for different repositories
+type Hooks struct {
+	// OnRunStarted is called before a run makes any contributions (or any requests), and if it returns an error, the run is not made, and fails with it
+	OnRunStarted func(ctx context.Context) error
+	// OnPlanReady is called with each plan that has changes, before any of them are made, and if it returns an error, none are, and the repository's run fails with it
+	// only runs through the api are planned, so it is not called for ENGINE=git or PUSH_MODE=ssh
+	OnPlanReady func(ctx context.Context, plan *Plan) error
+	// OnCommitCreated is called with each commit once it is on the branch it was made for
+	OnCommitCreated func(ctx context.Context, commit Commit)
+	// OnRunFinished is called with the report of the run once it has finished, whether or not it succeeded
+	OnRunFinished func(ctx context.Context, report *Report)
+}
+
+// Commit is a commit that a run made, see Hooks.OnCommitCreated
+type Commit struct {
+	Username string `json:"username"`
+	Repo     string `json:"repo"`
+	SHA      string `json:"sha"`
+}
+
+// runStarted calls the OnRunStarted hook of the Runner that ctx carries, if it has one, and returns its veto, if it vetoes the run
+func runStarted(ctx context.Context) error {
+	hook := runnerFrom(ctx).hooks.OnRunStarted
+	if hook == nil {
+		return nil
+	}
+	if err := hook(ctx); err != nil {
+		return fmt.Errorf("the run was vetoed: %w", err)
+	}
+	return nil
+}
+
+// planReady calls the OnPlanReady hook of the Runner that ctx carries with plan, if it has one, and returns its veto, if it vetoes it
+func planReady(ctx context.Context, plan *Plan) error {
+	hook := runnerFrom(ctx).hooks.OnPlanReady
+	if hook == nil {
+		return nil
+	}
+	if err := hook(ctx, plan); err != nil {
+		return fmt.Errorf("the plan for %v/%v was vetoed: %w", plan.Username, plan.Repo, err)
+	}
+	return nil
+}
+
+// commitCreated calls the OnCommitCreated hook of the Runner that ctx carries with each of commits, if it has one
+func commitCreated(ctx context.Context, commits ...Commit) {
+	if hook := runnerFrom(ctx).hooks.OnCommitCreated; hook != nil {
+		for _, commit := range commits {
+			hook(ctx, commit)
+		}
+	}
+}
+
+// runFinished calls the OnRunFinished hook of the Runner that ctx carries with report, if it has one
+func runFinished(ctx context.Context, report *Report) {
+	if hook := runnerFrom(ctx).hooks.OnRunFinished; hook != nil {
+		hook(ctx, report)
+	}
+}
@@ -0,0 +1,45 @@
+package commitcron
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// checkAuthorEmail checks that commits authored by email count as contributions of the user that client is authenticated as,
+// which they only do if email is one of the user's verified email addresses (or their noreply address), otherwise they silently do not count, which is the most common way for this script to fail
+// listing the user's email addresses needs the user:email scope (or the Email addresses permission), so if they can't be listed, checked is false and the email could not be checked
+func checkAuthorEmail(ctx context.Context, client *http.Client, email string) (checked bool, err error) {
+	var user struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+	}
+	if err := jsonRequest(ctx, client, "GET", "https://api.github.com/user", nil, &user); err != nil {
+		return false, nil
+	}
+	// noreply addresses are of the form ID+login@users.noreply.github.com, or login@users.noreply.github.com for older accounts
+	for _, noreply := range []string{fmt.Sprintf("%v+%v@users.noreply.github.com", user.ID, user.Login), user.Login + "@users.noreply.github.com"} {
+		if strings.EqualFold(email, noreply) {
+			return true, nil
+		}
+	}
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Verified bool   `json:"verified"`
+	}
+	if err := jsonRequest(ctx, client, "GET", "https://api.github.com/user/emails", nil, &emails); err != nil {
+		return false, nil
+	}
+	for _, e := range emails {
+		if !strings.EqualFold(e.Email, email) {
+			continue
+		}
+		if !e.Verified {
+			return true, fmt.Errorf("%v is on %v's account, but it is not verified, so commits authored by it will not count as contributions until it is verified at https://github.com/settings/emails", email, user.Login)
+		}
+		return true, nil
+	}
+	return true, fmt.Errorf("%v is not an email address on %v's account, so commits authored by it will not count as contributions. Add it at https://github.com/settings/emails, or use your noreply address", email, user.Login)
+}
@@ -0,0 +1,78 @@
+package commitcron
+
+import (
+	"fmt"
+	"image"
+	// the formats that patterns can be imported from register their decoders with image
+	_ "image/gif"
+	_ "image/png"
+	"io"
+	"strings"
+)
+
+// DecodeImagePattern returns the pattern for the png or gif image read from r, scaled to the full graph (53 weeks by 7 days),
+// with the darkest parts of the image the most intense, or with invert, the lightest
+// each day of the graph is the average luminance of the part of the image that it covers, with transparent parts counting as white, bucketed into the graph's 5 shades
+func DecodeImagePattern(r io.Reader, invert bool) (Pattern, error) {
+	var p Pattern
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return p, fmt.Errorf("Error decoding the image, it must be a png or gif image: %w", err)
+	}
+
+	b := img.Bounds()
+	if b.Empty() {
+		return p, fmt.Errorf("the image is empty")
+	}
+	for day := range p {
+		p[day] = make([]int, graphWeeks)
+		y0, y1 := cellBounds(b.Min.Y, b.Dy(), day, graphDays)
+		for week := range p[day] {
+			x0, x1 := cellBounds(b.Min.X, b.Dx(), week, graphWeeks)
+			var sum float64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					// the color is alpha premultiplied, so the white behind it makes up the rest
+					r, g, bl, a := img.At(x, y).RGBA()
+					white := float64(0xffff - a)
+					sum += (0.299*(float64(r)+white) + 0.587*(float64(g)+white) + 0.114*(float64(bl)+white)) / 0xffff
+				}
+			}
+			darkness := 1 - sum/float64((y1-y0)*(x1-x0))
+			if invert {
+				darkness = 1 - darkness
+			}
+			intensity := int(darkness * (maxIntensity + 1))
+			if intensity > maxIntensity {
+				intensity = maxIntensity
+			}
+			p[day][week] = intensity
+		}
+	}
+	return p, nil
+}
+
+// cellBounds returns the range of pixels, from min, of an image that is size pixels long, that the i-th of n cells covers
+// every cell covers at least one pixel, so an image that is smaller than the graph is scaled up
+func cellBounds(min, size, i, n int) (int, int) {
+	start, end := min+i*size/n, min+(i+1)*size/n
+	if end <= start {
+		end = start + 1
+	}
+	return start, end
+}
+
+// previewShades are what each intensity is shown as when the pattern is previewed, from 0 to 4
+var previewShades = []string{"·", "░", "▒", "▓", "█"}
+
+// Preview renders the pattern as it would look on the contribution graph, for the terminal
+func (p Pattern) Preview() string {
+	var b strings.Builder
+	for _, line := range p {
+		for _, intensity := range line {
+			b.WriteString(previewShades[intensity])
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
@@ -0,0 +1,88 @@
+package commitcron
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/anacanm/commitCron/contributions"
+)
+
+// loadTargetLevel reads TARGET_LEVEL, the shade of the contribution graph, from 1 to 4, that each day is to reach, or 0 if it is not set
+func loadTargetLevel(env Settings) (int, error) {
+	t, present := env.lookup("TARGET_LEVEL")
+	if !present {
+		return 0, nil
+	}
+	level, err := strconv.Atoi(t)
+	if err != nil || level < 1 || level > maxIntensity {
+		return 0, fmt.Errorf("Error parsing TARGET_LEVEL: must be a shade from 1 to %v, got %q", maxIntensity, t)
+	}
+	return level, nil
+}
+
+// levelThresholds estimates the least number of contributions that a day needs to reach each level of the contribution graph, from the days that it shows
+// github buckets the counts by quartiles of the user's own activity, which it doesn't report, but the counts only ever get darker as they grow,
+// so the least count seen at a level certainly reaches it, and any count above every count seen at the levels below it does too
+// a level that no day has reached is estimated as just above the levels below it, which is the best that can be done without any day to go by
+func levelThresholds(days []contributions.CalendarDay) [maxIntensity + 1]int {
+	var thresholds [maxIntensity + 1]int
+	seen := [maxIntensity + 1]bool{}
+	highest := [maxIntensity + 1]int{}
+	for _, day := range days {
+		level := day.LevelIndex()
+		if level < 0 {
+			continue
+		}
+		if !seen[level] || day.Count < thresholds[level] {
+			thresholds[level] = day.Count
+		}
+		seen[level] = true
+		if day.Count > highest[level] {
+			highest[level] = day.Count
+		}
+	}
+	below := 0
+	for level := 1; level <= maxIntensity; level++ {
+		if !seen[level] {
+			thresholds[level] = below + 1
+		}
+		if thresholds[level] < 1 {
+			thresholds[level] = 1
+		}
+		if highest[level] > below {
+			below = highest[level]
+		}
+		if thresholds[level] > below {
+			below = thresholds[level]
+		}
+	}
+	thresholds[0] = 0
+	return thresholds
+}
+
+// contributionsToLevel returns how many more contributions username needs to make today for today to reach level on the contribution graph
+func contributionsToLevel(ctx context.Context, client *http.Client, username string, level int) (int, error) {
+	days, err := contributions.GetCalendar(ctx, client, username)
+	if err != nil {
+		return 0, err
+	}
+	if len(days) == 0 {
+		return 0, fmt.Errorf("the contribution calendar of %v is empty", username)
+	}
+	// the calendar is dated in the user's time zone, so its last day may not be today yet (or already be tomorrow), and today is looked up by its date, as it is counted (see contributions.Service),
+	// with no contributions if the calendar has not reached it yet
+	today, date := 0, currentTime(ctx).Local().Format(dateLayout)
+	for i := len(days) - 1; i >= 0; i-- {
+		if days[i].Date == date {
+			today = days[i].Count
+			break
+		}
+	}
+	needed := levelThresholds(days)[level] - today
+	if needed < 0 {
+		needed = 0
+	}
+	return needed, nil
+}
@@ -0,0 +1,123 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	commitcron "github.com/anacanm/commitCron"
+	"github.com/anacanm/commitCron/redact"
+)
+
+// inputPrefix is what github actions prefixes the names of an action's inputs with, as environment variables, eg. INPUT_GITHUB_TOKEN for the input github_token
+const inputPrefix = "INPUT_"
+
+// actionSettings returns env with the action's inputs in place of the settings they are named after (eg. the input repo_name is REPO_NAME),
+// so every setting can be an input, and one that is not an input can still be set with env in the workflow
+// inputs that are not given are empty, and are left out, so that they don't override the environment
+func actionSettings(env commitcron.Settings) commitcron.Settings {
+	settings := commitcron.Settings{}
+	for name, value := range env {
+		settings[name] = value
+	}
+	for name, value := range env {
+		if strings.HasPrefix(name, inputPrefix) && value != "" {
+			settings[strings.ToUpper(strings.TrimPrefix(name, inputPrefix))] = value
+		}
+	}
+	return settings
+}
+
+// runAction runs the pipeline as a step of a github actions workflow (see action.yml): every secret is masked in the workflow's log as soon as it is known,
+// the contributions that are made and the failures are annotated on the workflow run, the report is added to the step's summary,
+// and contributions_made, files_changed and report are set as the step's outputs
+func runAction(ctx context.Context, env commitcron.Settings) error {
+	redact.OnSecret(func(secret string) {
+		// a secret that spans lines (eg. a private key) is only masked line by line
+		for _, line := range strings.Split(secret, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				fmt.Printf("::add-mask::%v\n", line)
+			}
+		}
+	})
+	report, err := runPipeline(ctx, env)
+	if report == nil {
+		if err != nil {
+			annotate("error", "commitcron", err.Error())
+		}
+		return err
+	}
+	// the report's errors may quote a response that echoed a token, and the workflow's log is only masked for the secrets that were registered in time, so everything written from the report is redacted first
+	text := redact.String(report.String())
+	fmt.Print(text)
+
+	made, changed := 0, 0
+	for _, account := range report.Accounts {
+		if account.Err != nil && len(account.Repos) == 0 {
+			annotate("error", account.Username, account.Err.Error())
+		}
+		for _, repo := range account.Repos {
+			title := account.Username + "/" + repo.Repo
+			if repo.Err != nil {
+				annotate("error", title, repo.Err.Error())
+			}
+			for _, warning := range repo.Warnings {
+				annotate("warning", title, warning)
+			}
+			if repo.Made > 0 {
+				annotate("notice", title, fmt.Sprintf("made %v of %v planned contributions", repo.Made, repo.Planned))
+			}
+			made += repo.Made
+			changed += len(repo.Created) + len(repo.Updated) + len(repo.Deleted)
+		}
+	}
+
+	data, jsonErr := json.Marshal(report)
+	if jsonErr != nil {
+		return fmt.Errorf("Error encoding the report: %w", jsonErr)
+	}
+	if outErr := appendToFile(env["GITHUB_OUTPUT"], fmt.Sprintf("contributions_made=%v\nfiles_changed=%v\nreport=%s\n", made, changed, redact.String(string(data)))); outErr != nil {
+		return outErr
+	}
+	if outErr := appendToFile(env["GITHUB_STEP_SUMMARY"], fmt.Sprintf("### commitcron\n```\n%v```\n", text)); outErr != nil {
+		return outErr
+	}
+	return err
+}
+
+// annotate prints a workflow command that annotates the run with message, at level (notice, warning or error), titled title
+func annotate(level, title, message string) {
+	fmt.Printf("::%v title=%v::%v\n", level, escapeProperty(title), escapeData(redact.String(message)))
+}
+
+// appendToFile appends text to the file at path, which is one of the files that github actions reads a step's outputs or summary from,
+// or does nothing if path is "", ie. the command is not running in a github actions workflow
+func appendToFile(path, text string) error {
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("Error opening %v: %w", path, err)
+	}
+	if _, err := f.WriteString(text); err != nil {
+		f.Close()
+		return fmt.Errorf("Error writing to %v: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("Error writing to %v: %w", path, err)
+	}
+	return nil
+}
+
+// escapeData escapes s to be the message of a workflow command, which ends at the end of the line
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeProperty escapes s to be the value of a property of a workflow command (eg. its title), which also ends at a comma or colon
+func escapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
@@ -0,0 +1,203 @@
+// Package cli is the commitcron command, which cmd/commitcron runs: it loads the settings from the environment (or a .env file), sets up logging and cancellation,
+// and runs the subcommand that its arguments name, or the pipeline, with the commitcron package
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime/debug"
+	"syscall"
+	"time"
+
+	commitcron "github.com/anacanm/commitCron"
+	"github.com/anacanm/commitCron/redact"
+	"github.com/joho/godotenv"
+)
+
+// Main runs the command with its arguments, args, which do not include the program name
+// it exits the process if anything fails, so it only returns once the command has succeeded
+func Main(args []string) {
+	// when ssh runs this binary to ask for the deploy key's passphrase, answer and do nothing else
+	if os.Getenv(commitcron.AskpassEnv) != "" {
+		fmt.Println(os.Getenv("DEPLOY_KEY_PASSPHRASE"))
+		return
+	}
+
+	// everything logged is passed through redact, so that no token can ever appear in the output, whichever source it came from
+	// the library logs with the default slog logger, and setting it sends the log package's output (eg. log.Fatalf below) through the same handler
+	slog.SetDefault(slog.New(logHandler("")))
+	// a panic in the main goroutine would otherwise print its value and trace straight to stderr, bypassing redaction
+	// (the goroutines that a run starts recover their own panics, and return them as errors)
+	defer func() {
+		if r := recover(); r != nil {
+			log.Fatalf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+
+	// first I need to ensure that I have access to the env variables
+	// if an environment variable is not immediately present, then I need to load them from a .env file
+	_, present := os.LookupEnv("GITHUB_USERNAME")
+	if _, accountsFile := os.LookupEnv("ACCOUNTS_FILE"); accountsFile {
+		present = true
+	}
+	// if the environment variables are not accessible automatically, ie. running in development with a .env file, then load them from the .env file
+	var envErr error
+	if !present {
+		envErr = godotenv.Load()
+	}
+	// this is the only place that the environment is read, everything else is passed the settings read from it
+	env := commitcron.SettingsFromEnv()
+	// a github action is configured by its inputs, and has no .env file (see actionSettings)
+	action := len(args) > 0 && args[0] == "action"
+	if action {
+		env = actionSettings(env)
+	}
+	// LOG_FORMAT may only be set in the .env file, so the format is only known now
+	slog.SetDefault(slog.New(logHandler(env["LOG_FORMAT"])))
+
+	if len(args) > 0 && args[0] == "login" {
+		// login only needs GITHUB_CLIENT_ID, which may well be passed directly rather than in a .env file, so a missing .env file is not fatal here
+		if err := login(env, &http.Client{Timeout: time.Second * 7}); err != nil {
+			log.Fatalf("Error logging in: %v", err)
+		}
+		return
+	}
+
+	if envErr != nil && !action {
+		log.Fatalf("Error loading .env file: %v", envErr)
+	}
+
+	// the number of contributions and the files that are modified are both random, so they should differ from run to run
+	rand.Seed(time.Now().UnixNano())
+
+	// every subcommand, like the pipeline, stops promptly when the process is interrupted
+	ctx, cancel := interruptible()
+	defer cancel()
+
+	if action {
+		if err := runAction(ctx, env); err != nil {
+			log.Fatalf("Error running the action: %v", err)
+		}
+		return
+	}
+
+	if len(args) > 0 && args[0] == "doctor" {
+		if err := doctor(ctx, env, &http.Client{Timeout: time.Second * 7}); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		return
+	}
+
+	if len(args) > 0 && args[0] == "backfill" {
+		if err := backfill(ctx, env, args[1:], &http.Client{Timeout: time.Second * 7}); err != nil {
+			log.Fatalf("Error backfilling: %v", err)
+		}
+		return
+	}
+
+	if len(args) > 0 && args[0] == "art" {
+		if err := art(ctx, env, args[1:], &http.Client{Timeout: time.Second * 7}); err != nil {
+			log.Fatalf("Error drawing pattern: %v", err)
+		}
+		return
+	}
+
+	if len(args) > 0 && args[0] == "cleanup" {
+		if err := cleanup(ctx, env, args[1:], &http.Client{Timeout: time.Second * 7}); err != nil {
+			log.Fatalf("Error cleaning up: %v", err)
+		}
+		return
+	}
+
+	if len(args) > 0 && args[0] == "mirror" {
+		if err := mirror(ctx, env, args[1:], &http.Client{Timeout: time.Second * 7}); err != nil {
+			log.Fatalf("Error mirroring: %v", err)
+		}
+		return
+	}
+
+	if len(args) > 0 && args[0] == "plan" {
+		if err := plan(ctx, env, args[1:], &http.Client{Timeout: time.Second * 7}); err != nil {
+			log.Fatalf("Error planning: %v", err)
+		}
+		return
+	}
+
+	if len(args) > 0 && args[0] == "apply" {
+		if err := apply(ctx, env, args[1:], &http.Client{Timeout: time.Second * 7}); err != nil {
+			log.Fatalf("Error applying the plans: %v", err)
+		}
+		return
+	}
+
+	// the report of the run is printed once it has finished, for people to read, or with --json, for other programs
+	flags := flag.NewFlagSet("commitcron", flag.ExitOnError)
+	jsonReport := flags.Bool("json", false, "print the report of the run as json")
+	flags.Parse(args)
+
+	report, err := runPipeline(ctx, env)
+	// the report covers the accounts that failed too, so it is printed either way, and its errors may quote a response that echoed a token, so it is redacted like the log output
+	if report != nil {
+		if *jsonReport {
+			data, jsonErr := json.MarshalIndent(report, "", "  ")
+			if jsonErr != nil {
+				log.Fatalf("Error encoding the report: %v", jsonErr)
+			}
+			fmt.Println(redact.String(string(data)))
+		} else {
+			fmt.Print(redact.String(report.String()))
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// interruptible returns a context that is cancelled when the process is interrupted or terminated, which aborts every request in flight so that the process exits promptly
+func interruptible() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		log.Println("Interrupted, cancelling")
+		cancel()
+	}()
+	return ctx, cancel
+}
+
+// runPipeline runs the pipeline with the config that env configures, and the commands in HOOK_BEFORE_RUN, HOOK_AFTER_COMMIT and HOOK_AFTER_RUN at their points in the run
+func runPipeline(ctx context.Context, env commitcron.Settings) (*commitcron.Report, error) {
+	cfg, err := commitcron.ConfigFromSettings(env)
+	if err != nil {
+		return nil, err
+	}
+	cfg.TokenClient = &http.Client{Timeout: time.Second * 7}
+
+	hooks, err := commitcron.ExecHooks(env)
+	if err != nil {
+		return nil, err
+	}
+	runner, err := commitcron.New(commitcron.WithHooks(hooks))
+	if err != nil {
+		return nil, err
+	}
+	return runner.Run(ctx, cfg)
+}
+
+// logHandler returns the handler that everything is logged with, in the format LOG_FORMAT names, json for a json object per line, or otherwise key=value text
+func logHandler(format string) slog.Handler {
+	out := redact.NewWriter(os.Stderr)
+	if format == "json" {
+		return slog.NewJSONHandler(out, nil)
+	}
+	return slog.NewTextHandler(out, nil)
+}
@@ -0,0 +1,420 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	commitcron "github.com/anacanm/commitCron"
+	"github.com/anacanm/commitCron/auth"
+	"github.com/anacanm/commitCron/redact"
+)
+
+// dateLayout is the layout of the days passed to the subcommands, eg. backfill's --from
+const dateLayout = "2006-01-02"
+
+// confirm asks for explicit confirmation on stdin, and returns an error saying that what was not confirmed unless the answer is yes
+func confirm(what string) error {
+	fmt.Print("Type yes to continue: ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if strings.TrimSpace(answer) != "yes" {
+		return fmt.Errorf("%v was not confirmed", what)
+	}
+	return nil
+}
+
+// login obtains a token interactively with the oauth device flow, and stores it so that later runs use it without a GITHUB_API_TOKEN (see commitcron.Login)
+func login(env commitcron.Settings, client *http.Client) error {
+	path, err := commitcron.Login(env, client, func(code auth.DeviceCode) {
+		fmt.Printf("Open %v in your browser and enter the code: %v\n", code.VerificationURI, code.UserCode)
+		fmt.Println("Waiting for authorization...")
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Logged in, token stored in %v\n", path)
+	return nil
+}
+
+// doctor prints the result of each of the checks that commitcron.Doctor makes, and returns an error if any of them failed
+func doctor(ctx context.Context, env commitcron.Settings, tokenClient *http.Client) error {
+	checks, err := commitcron.Doctor(ctx, env, tokenClient)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, check := range checks {
+		switch {
+		case check.Skipped != "":
+			fmt.Printf("?    %v: %v\n", check.Name, check.Skipped)
+		case check.Err != nil:
+			failed++
+			fmt.Println(redact.String(fmt.Sprintf("FAIL %v: %v", check.Name, check.Err)))
+		default:
+			fmt.Printf("ok   %v\n", check.Name)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%v checks failed", failed)
+	}
+	return nil
+}
+
+// commitBackdated shows how many commits b will make, and makes them after asking for explicit confirmation (unless yes is set), as the subcommand named command,
+// with noun describing the commits, eg. "empty commits"
+func commitBackdated(ctx context.Context, b *commitcron.Backdating, command, noun string, yes bool) error {
+	fmt.Printf("This will make %v %v to %v/%v, dated from %v to %v.\n", len(b.Dates), noun, b.Username, b.Repo, b.Dates[0].Format(dateLayout), b.Dates[len(b.Dates)-1].Format(dateLayout))
+	if !yes {
+		if err := confirm(command); err != nil {
+			return err
+		}
+	}
+	return b.Commit(ctx)
+}
+
+// backfill generates backdated commits for each day from --from to --to (inclusive), --per-day of them on each day (see commitcron.PlanBackfill),
+// after asking for explicit confirmation (unless --yes is passed) once it has shown how many commits will be made
+func backfill(ctx context.Context, env commitcron.Settings, args []string, tokenClient *http.Client) error {
+	flags := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	fromFlag := flags.String("from", "", "the first day to backfill, eg. 2023-01-01")
+	toFlag := flags.String("to", "", "the last day to backfill, eg. 2023-06-30")
+	perDayFlag := flags.String("per-day", "0-4", "the range of commits to make each day, the number for each day is chosen at random")
+	yes := flags.Bool("yes", false, "make the commits without asking for confirmation")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	from, err := time.ParseInLocation(dateLayout, *fromFlag, time.Local)
+	if err != nil {
+		return fmt.Errorf("Error parsing --from: %w", err)
+	}
+	to, err := time.ParseInLocation(dateLayout, *toFlag, time.Local)
+	if err != nil {
+		return fmt.Errorf("Error parsing --to: %w", err)
+	}
+	perDay, err := parseCountRange(*perDayFlag)
+	if err != nil {
+		return fmt.Errorf("Error parsing --per-day: %w", err)
+	}
+
+	b, err := commitcron.PlanBackfill(ctx, env, commitcron.BackfillOptions{From: from, To: to, PerDay: perDay}, tokenClient)
+	if err != nil {
+		return err
+	}
+	if len(b.Dates) == 0 {
+		fmt.Println("Nothing to backfill, no commits were planned for any day")
+		return nil
+	}
+	if err := commitBackdated(ctx, b, "backfill", "commits", *yes); err != nil {
+		return err
+	}
+	fmt.Printf("Backfilled %v commits\n", len(b.Dates))
+	return nil
+}
+
+// parseCountRange parses a range of counts of the form "0-4", or a single count such as "2"
+func parseCountRange(s string) ([2]int, error) {
+	var counts [2]int
+	parts := strings.SplitN(s, "-", 2)
+	for i, part := range parts {
+		c, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || c < 0 {
+			return counts, fmt.Errorf("counts must be non-negative integers, got %q", part)
+		}
+		counts[i] = c
+	}
+	if len(parts) == 1 {
+		counts[1] = counts[0]
+	}
+	if counts[0] > counts[1] {
+		return counts, fmt.Errorf("the start must not be after the end, got %q", s)
+	}
+	return counts, nil
+}
+
+// art makes backdated commits that draw the pattern in --pattern, the --text spelled in font, or the pattern imported from --image, on the contribution graph,
+// with --per-level commits for each level of intensity of each day, starting from the week of --start (by default, the first week the graph currently shows),
+// after showing a preview of it, and asking for explicit confirmation (unless --yes is passed) (see commitcron.PlanArt)
+// text is centered on the graph, either the one that is currently shown, or with --year, the one for that year
+func art(ctx context.Context, env commitcron.Settings, args []string, tokenClient *http.Client) error {
+	flags := flag.NewFlagSet("art", flag.ContinueOnError)
+	patternFlag := flags.String("pattern", "", "the file that the pattern is read from, see ParsePattern")
+	imageFlag := flags.String("image", "", "the png or gif image that the pattern is imported from, in place of --pattern, see DecodeImagePattern")
+	invert := flags.Bool("invert", false, "draw the lightest parts of --image the darkest, eg. for light drawings on a dark background")
+	textFlag := flags.String("text", "", "the text to spell, in place of --pattern, eg. \"HIRE ME\"")
+	yearFlag := flags.Int("year", 0, "the year whose graph --text is centered on, in place of --start")
+	startFlag := flags.String("start", "", "a day in the week that the pattern starts on, eg. 2024-01-07, defaults to the first week the graph shows")
+	perLevel := flags.Int("per-level", 3, "the number of commits for each level of intensity")
+	yes := flags.Bool("yes", false, "make the commits without asking for confirmation")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	given := 0
+	for _, source := range []string{*patternFlag, *textFlag, *imageFlag} {
+		if source != "" {
+			given++
+		}
+	}
+	if given != 1 {
+		return fmt.Errorf("exactly one of --pattern, --text and --image is required")
+	}
+	if *yearFlag != 0 && *startFlag != "" {
+		return fmt.Errorf("only one of --year and --start may be given")
+	}
+	if *perLevel < 1 {
+		return fmt.Errorf("--per-level must be positive, got %v", *perLevel)
+	}
+
+	var p commitcron.Pattern
+	var err error
+	if *textFlag != "" {
+		p, err = commitcron.TextPattern(*textFlag)
+		if err != nil {
+			return err
+		}
+	} else if *imageFlag != "" {
+		p, err = imagePattern(*imageFlag, *invert)
+		if err != nil {
+			return err
+		}
+	} else {
+		data, err := ioutil.ReadFile(*patternFlag)
+		if err != nil {
+			return fmt.Errorf("Error reading --pattern: %w", err)
+		}
+		p, err = commitcron.ParsePattern(string(data))
+		if err != nil {
+			return fmt.Errorf("Error parsing %v: %w", *patternFlag, err)
+		}
+	}
+	var start time.Time
+	if *yearFlag != 0 {
+		// a year's graph starts with the week of january 1st
+		start = time.Date(*yearFlag, time.January, 1, 0, 0, 0, 0, time.Local)
+	} else if *startFlag != "" {
+		start, err = time.ParseInLocation(dateLayout, *startFlag, time.Local)
+		if err != nil {
+			return fmt.Errorf("Error parsing --start: %w", err)
+		}
+	}
+
+	b, err := commitcron.PlanArt(ctx, env, commitcron.ArtOptions{Pattern: p, Start: start, PerLevel: *perLevel}, tokenClient)
+	if err != nil {
+		return err
+	}
+	if len(b.Dates) == 0 {
+		fmt.Println("Nothing to draw, the pattern is empty")
+		return nil
+	}
+	fmt.Print(p.Preview())
+	if err := commitBackdated(ctx, b, "art", "commits", *yes); err != nil {
+		return err
+	}
+	fmt.Printf("Drew the pattern with %v commits\n", len(b.Dates))
+	return nil
+}
+
+// imagePattern returns the pattern for the png or gif image in the file at path (see commitcron.DecodeImagePattern)
+func imagePattern(path string, invert bool) (commitcron.Pattern, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return commitcron.Pattern{}, fmt.Errorf("Error opening %v: %w", path, err)
+	}
+	defer f.Close()
+	p, err := commitcron.DecodeImagePattern(f, invert)
+	if err != nil {
+		return p, fmt.Errorf("Error importing %v: %w", path, err)
+	}
+	return p, nil
+}
+
+// mirror replays the commits that the account in MIRROR_TOKEN has authored since the last time it was mirrored (or since --since, the first time)
+// as empty commits to the account's repository (see commitcron.PlanMirror), after asking for explicit confirmation (unless --yes is passed)
+func mirror(ctx context.Context, env commitcron.Settings, args []string, tokenClient *http.Client) error {
+	flags := flag.NewFlagSet("mirror", flag.ContinueOnError)
+	sinceFlag := flags.String("since", "", "the first day to mirror commits from, eg. 2024-01-01, required the first time, later runs continue from the last mirrored commit")
+	yes := flags.Bool("yes", false, "make the commits without asking for confirmation")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	var opts commitcron.MirrorOptions
+	if *sinceFlag != "" {
+		var err error
+		opts.Since, err = time.ParseInLocation(dateLayout, *sinceFlag, time.Local)
+		if err != nil {
+			return fmt.Errorf("Error parsing --since: %w", err)
+		}
+	}
+
+	b, err := commitcron.PlanMirror(ctx, env, opts, tokenClient)
+	if err != nil {
+		return err
+	}
+	if len(b.Dates) == 0 {
+		fmt.Println("Nothing to mirror, there are no new commits")
+		return nil
+	}
+	if err := commitBackdated(ctx, b, "mirror", "empty commits", *yes); err != nil {
+		return err
+	}
+	fmt.Printf("Mirrored %v commits\n", len(b.Dates))
+	return nil
+}
+
+// cleanup archives (with --archive) or deletes the micro repositories that were created more than --older-than ago (see commitcron.PlanCleanup),
+// after asking for explicit confirmation (unless --yes is passed)
+// a repository that isn't found is kept, and reported, unless --forget-missing is passed
+func cleanup(ctx context.Context, env commitcron.Settings, args []string, tokenClient *http.Client) error {
+	flags := flag.NewFlagSet("cleanup", flag.ContinueOnError)
+	olderThan := flags.Duration("older-than", 30*24*time.Hour, "how long ago a repository must have been created to be cleaned up")
+	archive := flags.Bool("archive", false, "archive the repositories instead of deleting them")
+	yes := flags.Bool("yes", false, "clean up without asking for confirmation")
+	forgetMissing := flags.Bool("forget-missing", false, "stop recording the repositories that are not found, rather than reporting them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	plan, err := commitcron.PlanCleanup(ctx, env, commitcron.CleanupOptions{OlderThan: *olderThan, Archive: *archive, ForgetMissing: *forgetMissing}, tokenClient)
+	if err != nil {
+		return err
+	}
+	if len(plan.Repos) == 0 {
+		fmt.Println("Nothing to clean up")
+		return nil
+	}
+	verb := "delete"
+	if plan.Archive {
+		verb = "archive"
+	}
+	fmt.Printf("This will %v %v repositories:\n", verb, len(plan.Repos))
+	for _, repo := range plan.Repos {
+		fmt.Printf("  %v/%v (created %v)\n", repo.Owner, repo.Name, repo.CreatedAt.Format(dateLayout))
+	}
+	if !*yes {
+		if err := confirm("cleanup"); err != nil {
+			return err
+		}
+	}
+
+	report, err := plan.Execute(ctx)
+	for _, repo := range report.Cleaned {
+		fmt.Printf("Cleaned up %v\n", repo)
+	}
+	for _, repo := range report.Forgotten {
+		fmt.Printf("Forgot %v, which was not found\n", repo)
+	}
+	if err != nil {
+		return err
+	}
+	if len(report.Missing) > 0 {
+		return fmt.Errorf("%v were not found, either they were deleted some other way, or the token can't access them, once you have checked which, run cleanup again with --forget-missing to stop recording them", strings.Join(report.Missing, ", "))
+	}
+	return nil
+}
+
+// plan plans a run (see commitcron.Planner) with the configuration in the environment, and prints the plans for review, or with --json, writes them as json to --out (or stdout),
+// to be executed later by apply
+func plan(ctx context.Context, env commitcron.Settings, args []string, tokenClient *http.Client) error {
+	flags := flag.NewFlagSet("plan", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "write the plans as json, to be executed with apply, instead of printing them for review")
+	out := flags.String("out", "", "the file to write the json plans to, instead of stdout, implies --json")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := commitcron.ConfigFromSettings(env)
+	if err != nil {
+		return err
+	}
+	cfg.TokenClient = tokenClient
+	plans, err := commitcron.NewPlanner(cfg).Plan(ctx)
+	if err != nil {
+		return err
+	}
+	// the plans are redacted before they are printed, as the report of a run is, since a file's content or an error could quote a token
+	if !*asJSON && *out == "" {
+		for _, plan := range plans {
+			fmt.Print(redact.String(plan.String()))
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(plans, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Error encoding the plans: %w", err)
+	}
+	if *out == "" {
+		fmt.Println(redact.String(string(data)))
+		return nil
+	}
+	// the plans contain the full content of every file that they change, which is not necessarily public, so only the owner can read them
+	if err := ioutil.WriteFile(*out, data, 0600); err != nil {
+		return fmt.Errorf("Error writing the plans to %v: %w", *out, err)
+	}
+	return nil
+}
+
+// apply executes the plans in the json file --plan (written by plan --json), after asking for explicit confirmation (unless --yes is passed)
+func apply(ctx context.Context, env commitcron.Settings, args []string, tokenClient *http.Client) error {
+	flags := flag.NewFlagSet("apply", flag.ContinueOnError)
+	planFile := flags.String("plan", "", "the json file of plans to execute, written by plan --json, required")
+	yes := flags.Bool("yes", false, "execute the plans without asking for confirmation")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *planFile == "" {
+		return fmt.Errorf("--plan is required")
+	}
+
+	data, err := ioutil.ReadFile(*planFile)
+	if err != nil {
+		return fmt.Errorf("Error reading the plans: %w", err)
+	}
+	var plans []*commitcron.Plan
+	if err := json.Unmarshal(data, &plans); err != nil {
+		return fmt.Errorf("Error parsing the plans in %v: %w", *planFile, err)
+	}
+	changes := 0
+	for _, plan := range plans {
+		fmt.Print(redact.String(plan.String()))
+		changes += len(plan.Changes)
+	}
+	if changes == 0 {
+		fmt.Println("Nothing to apply, no changes were planned")
+		return nil
+	}
+
+	fmt.Printf("This will make %v changes to %v repositories.\n", changes, len(plans))
+	if !*yes {
+		if err := confirm("apply"); err != nil {
+			return err
+		}
+	}
+
+	cfg, err := commitcron.ConfigFromSettings(env)
+	if err != nil {
+		return err
+	}
+	cfg.TokenClient = tokenClient
+	hooks, err := commitcron.ExecHooks(env)
+	if err != nil {
+		return err
+	}
+	runner, err := commitcron.New(commitcron.WithHooks(hooks))
+	if err != nil {
+		return err
+	}
+	report, err := runner.Planner(cfg).Execute(ctx, plans)
+	if report != nil {
+		fmt.Print(redact.String(report.String()))
+	}
+	return err
+}
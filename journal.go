@@ -0,0 +1,134 @@
+package commitcron
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// defaultJournalEntry is the template that each entry in the journal is generated with when JOURNAL_ENTRY is not specified,
+// defaultDailyJournalEntry the template for daily files, which are already dated, and defaultChangelogEntry the template for the changelog
+const (
+	defaultJournalEntry      = `- {{.Date.Format "2006-01-02 15:04"}} {{words 3}}`
+	defaultDailyJournalEntry = `- {{.Date.Format "15:04"}} {{words 3}}`
+	defaultChangelogEntry    = `- {{words 3}}`
+)
+
+// journalFile returns the path of the file that the contributions made at now are made to in journal, changelog or recreate mode, in sel.createdDir():
+// CHANGELOG.md in changelog mode, recreated with the extension that new files are created with in recreate mode,
+// otherwise a single JOURNAL.md, or if the layout is daily, a file for each day, eg. notes/2006-01-02.md
+func (o contentOptions) journalFile(sel Selection, now time.Time) string {
+	dir := sel.createdDir()
+	if o.Mode == "recreate" {
+		rule, _ := sel.Extensions.creatable()
+		return path.Join(dir, "recreated"+rule.Extension)
+	}
+	if o.Mode == "changelog" {
+		return path.Join(dir, "CHANGELOG.md")
+	}
+	if o.JournalLayout == "daily" {
+		return path.Join(dir, "notes", now.Format(dateLayout)+".md")
+	}
+	return path.Join(dir, "JOURNAL.md")
+}
+
+// journalContents returns n changes to the file at the slash separated path p, read with read, so that each contribution is a change to the same file
+// the file's sha is that of its blob, which is what the contents api identifies the file's current version with, or "" if it does not exist yet
+func journalContents(read repoFileReader, p string, n int) ([]RepoContent, error) {
+	data, found, err := read(p)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading %v: %w", p, err)
+	}
+	file := RepoContent{Name: path.Base(p), Path: p, Type: "file"}
+	if found {
+		file.Content, file.SHA = data, blobSHA(data)
+	}
+	contents := make([]RepoContent, n)
+	for i := range contents {
+		contents[i] = file
+	}
+	return contents, nil
+}
+
+// journalEntry returns the entry that the counter-th change of the run, made at date, adds to the journal, generated with t
+func journalEntry(t *template.Template, file RepoContent, date time.Time, counter int) (string, error) {
+	var b strings.Builder
+	err := t.Execute(&b, contentData{FileName: file.Name, Path: file.Path, Date: date, Counter: counter})
+	if err != nil {
+		return "", fmt.Errorf("Error generating journal entry for %v: %w", file.Path, err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// journalHeading returns the heading that a new journal file is created with, the date of daily files, or "Journal" otherwise
+func journalHeading(layout string, date time.Time) string {
+	if layout == "daily" {
+		return "# " + date.Format("Monday, January 2, 2006")
+	}
+	return "# Journal"
+}
+
+// blobSHA returns the sha that git identifies a blob with the given content by
+func blobSHA(content []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(content))
+	h.Write(content)
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// journalChange returns the content of the journal or changelog file after the i-th change of the run adds its entry to it, dated with the date of its commit if opts dates them
+func (o contentOptions) journalChange(file RepoContent, rule ExtensionRule, opts commitOptions, i int, now time.Time) ([]byte, error) {
+	date := now
+	if len(opts.Dates) > 0 {
+		date = opts.Dates[i/opts.FilesPerCommit]
+	}
+	entry, err := journalEntry(o.JournalEntry, file, date, i+1)
+	if err != nil {
+		return nil, err
+	}
+	if o.Mode == "changelog" {
+		if file.SHA == "" {
+			return []byte("# Changelog\n\n" + changelogHeading(date) + "\n\n" + entry + "\n"), nil
+		}
+		return changelogInsert(file.Content, changelogHeading(date), entry), nil
+	}
+	if file.SHA == "" {
+		return []byte(journalHeading(o.JournalLayout, date) + "\n\n" + entry + "\n"), nil
+	}
+	return insert(file.Content, entry, "append", rule), nil
+}
+
+// changelogHeading returns the heading of the changelog's section for the day of date
+func changelogHeading(date time.Time) string {
+	return "## " + date.Format(dateLayout)
+}
+
+// changelogInsert returns the changelog content with entry added to the end of the section with heading, which is added above the newest section if there isn't one,
+// since a changelog's newest section is at the top
+func changelogInsert(content []byte, heading, entry string) []byte {
+	lines := strings.Split(strings.TrimRight(string(content), "\n"), "\n")
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "## ") {
+			continue
+		}
+		if strings.TrimSpace(line) != heading {
+			// the day's section doesn't exist yet, so it goes above the newest one
+			section := []string{heading, "", entry, ""}
+			lines = append(lines[:i], append(section, lines[i:]...)...)
+			return []byte(strings.Join(lines, "\n") + "\n")
+		}
+		// the entry goes after the last line of the day's section that isn't blank
+		end := i + 1
+		for j := i + 1; j < len(lines) && !strings.HasPrefix(lines[j], "## "); j++ {
+			if strings.TrimSpace(lines[j]) != "" {
+				end = j + 1
+			}
+		}
+		lines = append(lines[:end], append([]string{entry}, lines[end:]...)...)
+		return []byte(strings.Join(lines, "\n") + "\n")
+	}
+	return []byte(strings.Join(lines, "\n") + "\n\n" + heading + "\n\n" + entry + "\n")
+}
@@ -0,0 +1,134 @@
+package commitcron
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anacanm/commitCron/redact"
+)
+
+// defaultLLMTimeout is how long a single request to the llm provider may take before falling back, if LLM_TIMEOUT is not set
+const defaultLLMTimeout = 10 * time.Second
+
+// llmProvider generates commit messages (and optionally file content) with an openai compatible chat completions api
+// it is strictly optional: whenever a request fails or times out, whatever would have been generated without it is used instead,
+// and after the first failure it is not used again for the rest of the run, so that an unreachable provider costs at most one timeout
+type llmProvider struct {
+	// BaseURL is the url that /chat/completions is appended to, eg. https://api.openai.com/v1
+	BaseURL string
+	APIKey  string
+	Model   string
+	// Content is whether the content of files is generated too, as a small snippet in a comment, rather than only commit messages
+	Content bool
+	client  *http.Client
+	failed  bool
+}
+
+// loadLLMProvider reads the llmProvider from the environment, it returns nil if LLM_BASE_URL is not set
+func loadLLMProvider(env Settings) (*llmProvider, error) {
+	baseURL := env.get("LLM_BASE_URL")
+	if baseURL == "" {
+		return nil, nil
+	}
+	p := &llmProvider{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		APIKey:  env.get("LLM_API_KEY"),
+		Model:   env.get("LLM_MODEL"),
+	}
+	redact.Secret(p.APIKey)
+	if p.Model == "" {
+		return nil, fmt.Errorf("LLM_BASE_URL is set, but LLM_MODEL is not")
+	}
+	timeout := defaultLLMTimeout
+	if t, present := env.lookup("LLM_TIMEOUT"); present {
+		var err error
+		timeout, err = time.ParseDuration(t)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing LLM_TIMEOUT: %w", err)
+		}
+	}
+	if c, present := env.lookup("LLM_CONTENT"); present {
+		var err error
+		p.Content, err = strconv.ParseBool(c)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing LLM_CONTENT: %w", err)
+		}
+	}
+	p.client = &http.Client{Timeout: timeout, Transport: bearerTransport{apiKey: p.APIKey}}
+	return p, nil
+}
+
+// commitMessage returns a generated commit message for the change to file, in style, or ok is false if it could not be generated
+func (p *llmProvider) commitMessage(ctx context.Context, file RepoContent, style string) (message string, ok bool) {
+	operation := "updated"
+	if file.SHA == "" {
+		operation = "created"
+	}
+	prompt := fmt.Sprintf("Write a short, natural sounding git commit subject line (under 60 characters) for a commit that %v the file %v with a small change to its comments.", operation, file.Path)
+	switch style {
+	case "conventional":
+		prompt += " Use the Conventional Commits format, with a plausible type and scope."
+	case "gitmoji":
+		prompt += " Start it with the appropriate gitmoji."
+	}
+	prompt += " Reply with only the subject line."
+	message, ok = p.complete(ctx, prompt)
+	// only the first line is used, models sometimes add an explanation despite being told not to
+	message = strings.Trim(strings.TrimSpace(strings.SplitN(message, "\n", 2)[0]), "\"`")
+	return message, ok && message != ""
+}
+
+// snippet returns a small generated snippet for a file named fileName, or ok is false if it could not be generated
+func (p *llmProvider) snippet(ctx context.Context, fileName string) (snippet string, ok bool) {
+	prompt := fmt.Sprintf("Write a short (at most 5 lines) and plausible code snippet or note that could appear in a file named %v. Reply with only the snippet, without markdown.", fileName)
+	snippet, ok = p.complete(ctx, prompt)
+	snippet = strings.TrimSpace(strings.Trim(strings.TrimSpace(snippet), "`"))
+	return snippet, ok && snippet != ""
+}
+
+// complete sends prompt to the provider and returns its reply, or ok is false if the request failed (which is logged, and disables the provider for the rest of the run)
+func (p *llmProvider) complete(ctx context.Context, prompt string) (reply string, ok bool) {
+	if p.failed {
+		return "", false
+	}
+	var resp struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	err := jsonRequest(ctx, p.client, "POST", p.BaseURL+"/chat/completions", map[string]interface{}{
+		"model":      p.Model,
+		"messages":   []map[string]string{{"role": "user", "content": prompt}},
+		"max_tokens": 200,
+	}, &resp)
+	if err == nil && len(resp.Choices) == 0 {
+		err = fmt.Errorf("the response had no choices")
+	}
+	if err != nil {
+		p.failed = true
+		logger(ctx).Warn("Error generating text, falling back to templates for the rest of the run", "url", p.BaseURL, "err", err)
+		return "", false
+	}
+	return resp.Choices[0].Message.Content, true
+}
+
+// bearerTransport sets the Authorization header of every request to a bearer token
+type bearerTransport struct {
+	apiKey string
+}
+
+// RoundTrip implements http.RoundTripper
+func (t bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.apiKey == "" {
+		return http.DefaultTransport.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.apiKey)
+	return http.DefaultTransport.RoundTrip(req)
+}
@@ -0,0 +1,27 @@
+//go:build wasm
+
+package commitcron
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// a webassembly build has no git, ssh, or filesystem to clone into, so only the api engine is built into it, which is everything that planning needs,
+// and a run that is configured to make its contributions locally fails with that, instead of the whole package failing to build
+
+// runGitEngine fails, since ENGINE=git needs a clone of the repository on disk
+func runGitEngine(ctx context.Context, env Settings, account Account, client *http.Client, clientErr error, numberOfContributionsToMake int, minContributions int) (int, error) {
+	return 0, fmt.Errorf("ENGINE=git is not supported in a webassembly build, use ENGINE=api")
+}
+
+// deployKeyPush fails, since PUSH_MODE=ssh needs git and ssh
+func deployKeyPush(ctx context.Context, env Settings, account Account, numberOfContributionsToMake int, sel Selection) error {
+	return fmt.Errorf("PUSH_MODE=ssh is not supported in a webassembly build")
+}
+
+// globalSigningKey returns "", since there is no gitconfig to read user.signingkey from, so SIGNING_KEY has to be set to sign commits
+func globalSigningKey(format string) (string, error) {
+	return "", nil
+}
@@ -0,0 +1,36 @@
+package commitcron
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/anacanm/commitCron/auth"
+	"github.com/anacanm/commitCron/redact"
+)
+
+// Login obtains a token with the oauth device flow, and stores it so that later runs use it without a GITHUB_API_TOKEN, returning the path it was stored in
+// show is called with the code that the user has to enter at its verification uri, and Login then waits until they have
+// the oauth app identified by GITHUB_CLIENT_ID must have device flow enabled
+func Login(env Settings, client *http.Client, show func(code auth.DeviceCode)) (string, error) {
+	clientID := env.get("GITHUB_CLIENT_ID")
+	if clientID == "" {
+		return "", fmt.Errorf("GITHUB_CLIENT_ID must be set to the client ID of an oauth app with device flow enabled")
+	}
+
+	// the repo scope is needed both to count contributions to private repositories and to modify the target repository
+	code, err := auth.RequestDeviceCode(client, clientID, "repo")
+	if err != nil {
+		return "", err
+	}
+	show(code)
+
+	token, err := auth.PollDeviceToken(client, clientID, code)
+	if err != nil {
+		return "", err
+	}
+	redact.Secret(token)
+	if err := auth.SaveToken(token); err != nil {
+		return "", err
+	}
+	return auth.StoredTokenPath()
+}
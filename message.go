@@ -0,0 +1,233 @@
+package commitcron
+
+import (
+	cryptorand "crypto/rand"
+	"fmt"
+	"math/rand"
+	"path"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// coAuthorPattern matches a single co-author, of the form "Name <email>"
+var coAuthorPattern = regexp.MustCompile(`^[^<>]+ <[^<>@\s]+@[^<>\s]+>$`)
+
+// idTrailer is the key of the trailer that identifies every commit made by this script, eg. "Commitcron-Id: 0b5c1f9e-...",
+// which later cleanup and audits rely on to find the synthetic commits
+const idTrailer = "Commitcron-Id"
+
+// messageTemplateEnv is the environment variable that the commit message template is read from, templates for the files of a single extension are read from
+// the same variable, suffixed with the extension (eg. COMMIT_MESSAGE_TEMPLATE_GO for .go files, or COMMIT_MESSAGE_TEMPLATE_PB_GO for .pb.go files)
+const messageTemplateEnv = "COMMIT_MESSAGE_TEMPLATE"
+
+// messageWords are the words that {{words n}} picks from in commit message templates
+var messageWords = []string{
+	"tidy", "update", "refine", "adjust", "cleanup", "notes", "tweak", "minor", "fix", "typo", "docs", "comments", "formatting", "wording", "small",
+	"config", "helpers", "misc", "follow-up", "polish", "rename", "simplify", "touch-up", "improve", "sync", "review", "draft", "revise", "sort", "layout",
+}
+
+// messageData is what commit message templates can reference, eg. "{{if .Created}}add{{else}}update{{end}} {{.FileName}} ({{.Counter}}, {{.Date.Format "Jan 2"}})"
+type messageData struct {
+	FileName string
+	Path     string
+	// SHA is the sha of the file before it is changed, which is "" if it is being created
+	SHA     string
+	Created bool
+	Date    time.Time
+	// Counter counts the changes made in the run, starting from 1
+	Counter int
+}
+
+// docsExtensions are the extensions of files whose changes are typed as docs by the conventional style
+var docsExtensions = map[string]bool{".md": true, ".txt": true, ".rst": true, ".adoc": true}
+
+// conventionalUpdates are the types and descriptions (given the file name) of the changes that the conventional style picks from for updated files
+var conventionalUpdates = []struct {
+	Type        string
+	Description string
+}{
+	{"refactor", "tidy up %v"},
+	{"refactor", "simplify %v"},
+	{"style", "clean up formatting in %v"},
+	{"chore", "update comments in %v"},
+	{"chore", "adjust %v"},
+}
+
+// gitmojiUpdates are the descriptions (given the file name) of the changes that the gitmoji style picks from for updated files, each prefixed with its gitmoji
+var gitmojiUpdates = []string{
+	"🎨 Improve formatting of %v",
+	"♻️ Refactor %v",
+	"✏️ Fix typos in %v",
+	"💡 Update comments in %v",
+}
+
+// commitMessages configures the messages of the commits that are made
+type commitMessages struct {
+	// Style is the style of the messages that are generated when there is no template for them, plain (the default), conventional, or gitmoji
+	Style string
+	// Template, if it is not nil, generates the subject of every commit, in place of the default
+	Template *template.Template
+	// ExtensionTemplates generate the subjects of the commits to files with their extension (eg. ".go"), in place of Template
+	ExtensionTemplates map[string]*template.Template
+	// Wordlist, if it is not nil, supplies the subjects of commits when there is no template for them, in place of Style, and is what {{line}} takes from in templates
+	Wordlist *messageWordlist
+	// CoAuthors are credited in a Co-authored-by trailer on every commit, each is of the form "Name <email>"
+	CoAuthors []string
+}
+
+// loadCommitMessages reads the commitMessages from the environment
+func loadCommitMessages(env Settings) (commitMessages, error) {
+	messages := commitMessages{ExtensionTemplates: map[string]*template.Template{}, Style: env.get("COMMIT_MESSAGE_STYLE")}
+	switch messages.Style {
+	case "", "plain", "conventional", "gitmoji":
+	default:
+		return messages, fmt.Errorf("Error parsing COMMIT_MESSAGE_STYLE: must be plain, conventional or gitmoji, got %q", messages.Style)
+	}
+	if path, present := env.lookup("COMMIT_MESSAGES_FILE"); present {
+		var err error
+		messages.Wordlist, err = loadMessageWordlist(path)
+		if err != nil {
+			return messages, err
+		}
+	}
+	funcs := template.FuncMap{
+		"words": randomWords,
+		"line": func() (string, error) {
+			if messages.Wordlist == nil {
+				return "", fmt.Errorf("{{line}} needs COMMIT_MESSAGES_FILE to be set")
+			}
+			return messages.Wordlist.next()
+		},
+	}
+	for name, value := range env {
+		if !strings.HasPrefix(name, messageTemplateEnv) {
+			continue
+		}
+		t, err := template.New(name).Funcs(funcs).Parse(value)
+		if err != nil {
+			return messages, fmt.Errorf("Error parsing %v: %w", name, err)
+		}
+		if name == messageTemplateEnv {
+			messages.Template = t
+		} else if suffix := strings.TrimPrefix(name, messageTemplateEnv+"_"); suffix != name {
+			messages.ExtensionTemplates["."+strings.ToLower(strings.Replace(suffix, "_", ".", -1))] = t
+		}
+	}
+	if c, present := env.lookup("COMMIT_CO_AUTHORS"); present {
+		for _, coAuthor := range strings.Split(c, ",") {
+			coAuthor = strings.TrimSpace(coAuthor)
+			if coAuthor == "" {
+				continue
+			}
+			if !coAuthorPattern.MatchString(coAuthor) {
+				return messages, fmt.Errorf("Error parsing COMMIT_CO_AUTHORS: each co-author must be of the form Name <email>, got %q", coAuthor)
+			}
+			messages.CoAuthors = append(messages.CoAuthors, coAuthor)
+		}
+	}
+	return messages, nil
+}
+
+// subject returns the message that the change to file (with the extension rule, and the counter-th change of the run) is committed with,
+// generated by the template for its extension, or failing that, the template for all files, or failing that, taken from m.Wordlist,
+// or failing that, in m.Style (where fallback is the plain style's message)
+func (m commitMessages) subject(fallback string, file RepoContent, rule ExtensionRule, counter int, now time.Time) (string, error) {
+	t, ok := m.ExtensionTemplates[rule.Extension]
+	if !ok {
+		t = m.Template
+	}
+	if t == nil && m.Wordlist != nil {
+		return m.Wordlist.next()
+	}
+	if t == nil {
+		switch m.Style {
+		case "conventional":
+			return conventionalSubject(file, rule), nil
+		case "gitmoji":
+			return gitmojiSubject(file, rule), nil
+		}
+		return fallback, nil
+	}
+	var b strings.Builder
+	err := t.Execute(&b, messageData{
+		FileName: file.Name,
+		Path:     file.Path,
+		SHA:      file.SHA,
+		Created:  file.SHA == "",
+		Date:     now,
+		Counter:  counter,
+	})
+	if err != nil {
+		return "", fmt.Errorf("Error generating commit message for %v: %w", file.Path, err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// conventionalSubject returns a Conventional Commits (https://www.conventionalcommits.org) subject for the change to file, eg. "refactor(cmd): tidy up main.go",
+// so that repositories that enforce the convention (eg. with commitlint) accept the commit
+// the scope is the directory that the file is in, or for files in the root directory, the file's name without its extension
+func conventionalSubject(file RepoContent, rule ExtensionRule) string {
+	scope := path.Base(path.Dir(file.Path))
+	if scope == "." || scope == "/" {
+		scope = strings.TrimSuffix(file.Name, rule.Extension)
+	}
+	switch {
+	case docsExtensions[rule.Extension]:
+		if file.SHA == "" {
+			return fmt.Sprintf("docs(%v): add %v", scope, file.Name)
+		}
+		return fmt.Sprintf("docs(%v): update %v", scope, file.Name)
+	case file.SHA == "":
+		return fmt.Sprintf("chore(%v): add %v", scope, file.Name)
+	default:
+		update := conventionalUpdates[rand.Intn(len(conventionalUpdates))]
+		return fmt.Sprintf("%v(%v): %v", update.Type, scope, fmt.Sprintf(update.Description, file.Name))
+	}
+}
+
+// gitmojiSubject returns a subject for the change to file prefixed with the gitmoji (https://gitmoji.dev) for the kind of change it is, eg. "✨ Add notes.go"
+func gitmojiSubject(file RepoContent, rule ExtensionRule) string {
+	switch {
+	case docsExtensions[rule.Extension] && file.SHA == "":
+		return fmt.Sprintf("📝 Add %v", file.Name)
+	case docsExtensions[rule.Extension]:
+		return fmt.Sprintf("📝 Update %v", file.Name)
+	case file.SHA == "":
+		return fmt.Sprintf("✨ Add %v", file.Name)
+	default:
+		return fmt.Sprintf(gitmojiUpdates[rand.Intn(len(gitmojiUpdates))], file.Name)
+	}
+}
+
+// randomWords returns n words from messageWords chosen at random, separated by spaces
+func randomWords(n int) string {
+	words := make([]string, n)
+	for i := range words {
+		words[i] = messageWords[rand.Intn(len(messageWords))]
+	}
+	return strings.Join(words, " ")
+}
+
+// finish returns message with the trailers that every commit is given appended, separated from it by a blank line, as git expects trailers to be
+// every commit is given a unique idTrailer, so that the commits made by this script can always be told apart from real ones
+func (m commitMessages) finish(message string) string {
+	trailers := []string{fmt.Sprintf("%v: %v", idTrailer, newCommitID())}
+	for _, coAuthor := range m.CoAuthors {
+		trailers = append(trailers, "Co-authored-by: "+coAuthor)
+	}
+	return message + "\n\n" + strings.Join(trailers, "\n")
+}
+
+// newCommitID returns a random (version 4) uuid
+func newCommitID() string {
+	var id [16]byte
+	// crypto/rand.Read only fails if the operating system's random number generator does, in which case there is nothing better to do than a less random id
+	if _, err := cryptorand.Read(id[:]); err != nil {
+		rand.Read(id[:])
+	}
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:16])
+}
@@ -0,0 +1,281 @@
+package commitcron
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultMicroRepoPrefix is what the names of micro repositories start with when MICRO_REPO_PREFIX is not specified
+const defaultMicroRepoPrefix = "scratch"
+
+// microRepoOptions configures micro repository mode, in which a run occasionally creates a small private repository, since creating a repository is a contribution too
+type microRepoOptions struct {
+	// Chance is the probability, from 0 to 1, that a run creates a repository, 0 (the default) disables micro repository mode
+	Chance float64
+	// Template, if it is not "", is the owner/name of the template repository that repositories are generated from, otherwise they are seeded with a README
+	Template string
+	// Prefix is what the names of the repositories start with, they are followed by the date they were created on and a random suffix
+	Prefix string
+}
+
+// loadMicroRepoOptions reads the microRepoOptions from the environment
+func loadMicroRepoOptions(env Settings) (microRepoOptions, error) {
+	opts := microRepoOptions{Prefix: defaultMicroRepoPrefix, Template: env.get("MICRO_REPO_TEMPLATE")}
+	if c, present := env.lookup("MICRO_REPO_CHANCE"); present {
+		chance, err := strconv.ParseFloat(c, 64)
+		if err != nil || chance < 0 || chance > 1 {
+			return opts, fmt.Errorf("Error parsing MICRO_REPO_CHANCE: must be a number from 0 to 1, got %q", c)
+		}
+		opts.Chance = chance
+	}
+	if opts.Template != "" && len(strings.Split(opts.Template, "/")) != 2 {
+		return opts, fmt.Errorf("Error parsing MICRO_REPO_TEMPLATE: must be of the form owner/name, got %q", opts.Template)
+	}
+	if p, present := env.lookup("MICRO_REPO_PREFIX"); present {
+		opts.Prefix = strings.TrimSpace(p)
+	}
+	return opts, nil
+}
+
+// MicroRepo is a repository created in micro repository mode, as it is recorded so that it can be archived or deleted later (see PlanCleanup)
+type MicroRepo struct {
+	Owner     string    `json:"owner"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	Archived  bool      `json:"archived"`
+}
+
+// microReposPath returns the path of the file that the micro repositories that have been created are recorded in, inside the user's config directory,
+// since unlike a cache, losing it would leave the repositories for the owner to clean up by hand
+func microReposPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("Error finding user config directory: %w", err)
+	}
+	return filepath.Join(dir, "commitcron", "micro-repos.json"), nil
+}
+
+// loadMicroRepos returns the micro repositories that have been recorded, or none if nothing has been recorded yet
+func loadMicroRepos() ([]MicroRepo, error) {
+	path, err := microReposPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading %v: %w", path, err)
+	}
+	var repos []MicroRepo
+	if err := json.Unmarshal(data, &repos); err != nil {
+		return nil, fmt.Errorf("Error decoding json from %v: %w", path, err)
+	}
+	return repos, nil
+}
+
+// saveMicroRepos records repos, replacing whatever was recorded before
+func saveMicroRepos(repos []MicroRepo) error {
+	path, err := microReposPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("Error creating %v: %w", filepath.Dir(path), err)
+	}
+	data, err := json.MarshalIndent(repos, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Error encoding micro repositories: %w", err)
+	}
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("Error writing micro repositories to %v: %w", path, err)
+	}
+	return nil
+}
+
+// createMicroRepo creates a private repository for the account username (which client must be authorized as), and records it,
+// generated from opts.Template if it is set, and otherwise seeded with a README, so that it has a first commit
+func createMicroRepo(ctx context.Context, username string, opts microRepoOptions, now time.Time, client *http.Client) (MicroRepo, error) {
+	repo := MicroRepo{Owner: username, Name: fmt.Sprintf("%v-%v-%04x", opts.Prefix, now.Format(dateLayout), rand.Intn(1<<16)), CreatedAt: now}
+	if opts.Prefix == "" {
+		repo.Name = strings.TrimPrefix(repo.Name, "-")
+	}
+	var err error
+	if opts.Template != "" {
+		err = jsonRequest(ctx, client, "POST", fmt.Sprintf("https://api.github.com/repos/%v/generate", opts.Template), map[string]interface{}{
+			"owner":   username,
+			"name":    repo.Name,
+			"private": true,
+		}, nil)
+	} else {
+		err = jsonRequest(ctx, client, "POST", "https://api.github.com/user/repos", map[string]interface{}{
+			"name":        repo.Name,
+			"description": "Scratch space",
+			"private":     true,
+			"auto_init":   true,
+		}, nil)
+	}
+	if err != nil {
+		return repo, fmt.Errorf("Error creating repository %v: %w", repo.Name, err)
+	}
+
+	repos, err := loadMicroRepos()
+	if err != nil {
+		return repo, fmt.Errorf("Error recording repository %v, it will have to be cleaned up by hand: %w", repo.Name, err)
+	}
+	if err := saveMicroRepos(append(repos, repo)); err != nil {
+		return repo, fmt.Errorf("Error recording repository %v, it will have to be cleaned up by hand: %w", repo.Name, err)
+	}
+	return repo, nil
+}
+
+// CleanupOptions are which micro repositories PlanCleanup cleans up, and how
+type CleanupOptions struct {
+	// OlderThan is how long ago a repository must have been created to be cleaned up
+	OlderThan time.Duration
+	// Archive archives the repositories instead of deleting them
+	Archive bool
+	// ForgetMissing stops recording the repositories that are not found, rather than reporting them in CleanupReport.Missing
+	ForgetMissing bool
+}
+
+// CleanupPlan is the micro repositories that are due to be cleaned up, planned by PlanCleanup, which Execute cleans up once they have been reviewed
+type CleanupPlan struct {
+	// Repos are the repositories that are due
+	Repos []MicroRepo
+	// Archive is whether they are archived, rather than deleted
+	Archive bool
+
+	env           Settings
+	forgetMissing bool
+	tokenClient   *http.Client
+	// runner is the Runner that planned the cleanup, whose options it is executed with
+	runner *Runner
+}
+
+// CleanupReport is what Execute cleaned up, each repository as owner/name
+type CleanupReport struct {
+	// Cleaned are the repositories that were archived or deleted
+	Cleaned []string
+	// Forgotten are the repositories that were not found, and are no longer recorded, since ForgetMissing was set
+	Forgotten []string
+	// Missing are the repositories that were not found, and are still recorded: either they were deleted some other way, or the token can't access them,
+	// once that is checked, cleaning up again with ForgetMissing stops recording them
+	Missing []string
+}
+
+// PlanCleanup plans archiving (with opts.Archive) or deleting the micro repositories that were created more than opts.OlderThan ago
+func PlanCleanup(ctx context.Context, env Settings, opts CleanupOptions, tokenClient *http.Client) (*CleanupPlan, error) {
+	return (&Runner{}).PlanCleanup(ctx, env, opts, tokenClient)
+}
+
+// PlanCleanup plans cleaning up as the package's PlanCleanup does, with the runner's options
+func (r *Runner) PlanCleanup(ctx context.Context, env Settings, opts CleanupOptions, tokenClient *http.Client) (*CleanupPlan, error) {
+	ctx = withRunner(ctx, r)
+	if _, err := loadAccounts(env); err != nil {
+		return nil, err
+	}
+	repos, err := loadMicroRepos()
+	if err != nil {
+		return nil, err
+	}
+	plan := &CleanupPlan{Archive: opts.Archive, env: env, forgetMissing: opts.ForgetMissing, tokenClient: tokenClient, runner: r}
+	for _, repo := range repos {
+		if currentTime(ctx).Sub(repo.CreatedAt) >= opts.OlderThan && !(repo.Archived && opts.Archive) {
+			plan.Repos = append(plan.Repos, repo)
+		}
+	}
+	return plan, nil
+}
+
+// Execute archives or deletes the planned repositories, and stops recording the ones that were deleted
+// a repository that isn't found is kept, since a token that can't access it isn't told it exists, unless ForgetMissing was set
+// deleting repositories requires a token with the delete_repo scope, archiving only one that can administer them
+func (c *CleanupPlan) Execute(ctx context.Context) (CleanupReport, error) {
+	ctx = withRunner(ctx, c.runner)
+	var report CleanupReport
+	accounts, err := loadAccounts(c.env)
+	if err != nil {
+		return report, err
+	}
+	clients := map[string]*http.Client{}
+	for _, account := range accounts {
+		if clients[account.Username], err = account.newClient(c.runner, c.env, c.tokenClient); err != nil {
+			return report, fmt.Errorf("Error configuring github credentials for %v: %w", account.Username, err)
+		}
+	}
+	// the recorded repositories are read again, since they may have changed since the plan was made, and only the planned ones are cleaned up
+	repos, err := loadMicroRepos()
+	if err != nil {
+		return report, err
+	}
+	planned := map[string]bool{}
+	for _, repo := range c.Repos {
+		planned[repo.Owner+"/"+repo.Name] = true
+	}
+	// whatever is cleaned up is recorded as it is, even if cleaning up a later repository fails
+	gone := map[int]bool{}
+	defer func() {
+		var kept []MicroRepo
+		for i, repo := range repos {
+			if !gone[i] {
+				kept = append(kept, repo)
+			}
+		}
+		if err := saveMicroRepos(kept); err != nil {
+			logger(ctx).Error("Error saving the micro repositories that are left", "err", err)
+		}
+	}()
+	verb := "delete"
+	if c.Archive {
+		verb = "archive"
+	}
+	for i, repo := range repos {
+		name := repo.Owner + "/" + repo.Name
+		if !planned[name] {
+			continue
+		}
+		client, ok := clients[repo.Owner]
+		if !ok {
+			return report, fmt.Errorf("%v belongs to %v, which is not one of the configured accounts", name, repo.Owner)
+		}
+		url := "https://api.github.com/repos/" + name
+		if c.Archive {
+			err = jsonRequest(ctx, client, "PATCH", url, map[string]bool{"archived": true}, nil)
+			repos[i].Archived = err == nil
+		} else {
+			err = jsonRequest(ctx, client, "DELETE", url, nil, nil)
+			gone[i] = err == nil
+		}
+		if isStatus(err, http.StatusNotFound) {
+			// github answers a token that can't access a repository (eg. a fine-grained token that wasn't granted it, or can't administer it) as if it didn't exist,
+			// so a 404 alone doesn't mean the repository was deleted some other way, and it is only forgotten if the owner's credentials can't see it either, and ForgetMissing says to
+			if getErr := jsonRequest(ctx, client, "GET", url, nil, nil); getErr == nil {
+				err = fmt.Errorf("the token for %v can see the repository, but not %v it: %w", repo.Owner, verb, err)
+			} else if isStatus(getErr, http.StatusNotFound) {
+				if c.forgetMissing {
+					gone[i] = true
+					report.Forgotten = append(report.Forgotten, name)
+					continue
+				}
+				report.Missing = append(report.Missing, name)
+				continue
+			}
+		}
+		if err != nil {
+			return report, fmt.Errorf("Error cleaning up %v: %w", name, err)
+		}
+		report.Cleaned = append(report.Cleaned, name)
+	}
+	return report, nil
+}
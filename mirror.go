@@ -0,0 +1,259 @@
+package commitcron
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anacanm/commitCron/auth"
+	"github.com/anacanm/commitCron/redact"
+)
+
+// defaultMirrorAPIURL is the api that commits are mirrored from when MIRROR_API_URL is not specified, eg. for a private account on github.com itself
+const defaultMirrorAPIURL = "https://api.github.com"
+
+// mirrorMessage is the message of every mirrored commit (before its trailers), which says nothing about the commit it mirrors
+const mirrorMessage = "Mirrored activity"
+
+// mirrorPageSize is how many commits are asked for in each page of search results, and mirrorMaxPages how many pages are read,
+// since the search api returns no more than the first 1000 results of any search
+const (
+	mirrorPageSize = 100
+	mirrorMaxPages = 10
+)
+
+// mirrorSource is the account whose commits are mirrored, on the instance with the api url APIURL
+type mirrorSource struct {
+	APIURL string
+	Client *http.Client
+}
+
+// loadMirrorSource reads the mirrorSource from the environment: MIRROR_API_URL (eg. https://github.example.com/api/v3 for github enterprise server),
+// and MIRROR_TOKEN or MIRROR_TOKEN_FILE, a token for the account there, which is never used for anything but reading when its commits were made
+// its client is sent with runner's http client (see WithHTTPClient), but not its base url or rate limit, which are for the api of the account the contributions are made for
+func loadMirrorSource(runner *Runner, env Settings) (mirrorSource, error) {
+	source := mirrorSource{APIURL: strings.TrimRight(env.get("MIRROR_API_URL"), "/")}
+	if source.APIURL == "" {
+		source.APIURL = defaultMirrorAPIURL
+	}
+	// the source is a different account from the one the contributions are made for, so it is only ever configured explicitly, never from the usual credentials
+	account := Account{Token: env.get("MIRROR_TOKEN"), TokenFile: env.get("MIRROR_TOKEN_FILE")}
+	if account.Token == "" && account.TokenFile == "" {
+		return source, fmt.Errorf("MIRROR_TOKEN or MIRROR_TOKEN_FILE must be set to the token of the account to mirror")
+	}
+	redact.Secret(account.Token)
+	tokens, err := account.tokenSource(env, nil)
+	if err != nil {
+		return source, fmt.Errorf("Error creating the mirrored account's client: %w", err)
+	}
+	source.Client = &http.Client{
+		Timeout:   runner.timeout(),
+		Transport: &auth.Transport{Source: tokens, Base: runner.httpTransport()},
+	}
+	return source, nil
+}
+
+// commitDates returns when each of the commits that the source's account authored after since was made, in order, read from the commit search api,
+// which only searches the repositories that the token can read, and only returns the first 1000 commits, the rest are left for the next run
+// only the dates are kept, nothing else about the commits (their repositories, messages or content) is
+func (s mirrorSource) commitDates(ctx context.Context, since time.Time) ([]time.Time, error) {
+	var user struct {
+		Login string `json:"login"`
+	}
+	if err := jsonRequest(ctx, s.Client, "GET", s.APIURL+"/user", nil, &user); err != nil {
+		return nil, fmt.Errorf("Error finding the account to mirror: %w", err)
+	}
+
+	query := fmt.Sprintf("author:%v author-date:>%v", user.Login, since.UTC().Format(time.RFC3339))
+	var dates []time.Time
+	for page := 1; page <= mirrorMaxPages; page++ {
+		var results struct {
+			Items []struct {
+				Commit struct {
+					Author struct {
+						Date time.Time `json:"date"`
+					} `json:"author"`
+				} `json:"commit"`
+			} `json:"items"`
+		}
+		searchURL := fmt.Sprintf("%v/search/commits?q=%v&sort=author-date&order=asc&per_page=%v&page=%v", s.APIURL, url.QueryEscape(query), mirrorPageSize, page)
+		if err := jsonRequest(ctx, s.Client, "GET", searchURL, nil, &results); err != nil {
+			return nil, fmt.Errorf("Error searching for commits to mirror: %w", err)
+		}
+		for _, item := range results.Items {
+			dates = append(dates, item.Commit.Author.Date.In(time.Local))
+		}
+		if len(results.Items) < mirrorPageSize {
+			break
+		}
+	}
+	// the commits are committed in order, each the parent of the next, so they must be dated in order too, whatever order the search returned them in
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+	return dates, nil
+}
+
+// mirrorStatePath returns the path of the file that the date of the last mirrored commit of each source is recorded in, inside the user's config directory
+func mirrorStatePath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("Error finding user config directory: %w", err)
+	}
+	return filepath.Join(dir, "commitcron", "mirror.json"), nil
+}
+
+// loadMirrorState returns the date of the last mirrored commit of each source, by its api url, or none if nothing has been mirrored yet
+func loadMirrorState() (map[string]time.Time, error) {
+	path, err := mirrorStatePath()
+	if err != nil {
+		return nil, err
+	}
+	state := map[string]time.Time{}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading %v: %w", path, err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("Error decoding json from %v: %w", path, err)
+	}
+	return state, nil
+}
+
+// saveMirrorState records state, replacing whatever was recorded before
+func saveMirrorState(state map[string]time.Time) error {
+	path, err := mirrorStatePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("Error creating %v: %w", filepath.Dir(path), err)
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Error encoding mirror state: %w", err)
+	}
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("Error writing mirror state to %v: %w", path, err)
+	}
+	return nil
+}
+
+// MirrorOptions are what PlanMirror mirrors
+type MirrorOptions struct {
+	// Since is the first day to mirror commits from, which is required the first time, later runs continue from the last mirrored commit if it is zero
+	Since time.Time
+}
+
+// PlanMirror plans replaying the commits that an account on another instance (eg. github enterprise at work), or a private account, has authored since the last time it was mirrored
+// (or since opts.Since) as empty commits to the account's repository, each dated exactly as the commit it mirrors, so that the public graph reflects the work
+// only the dates are mirrored, the commits are all empty, with the same message, so nothing about the work itself is ever published
+func PlanMirror(ctx context.Context, env Settings, opts MirrorOptions, tokenClient *http.Client) (*Backdating, error) {
+	return (&Runner{}).PlanMirror(ctx, env, opts, tokenClient)
+}
+
+// PlanMirror plans mirroring as the package's PlanMirror does, with the runner's options, including for the mirrored account's client (see loadMirrorSource)
+func (r *Runner) PlanMirror(ctx context.Context, env Settings, opts MirrorOptions, tokenClient *http.Client) (*Backdating, error) {
+	ctx = withRunner(ctx, r)
+	source, err := loadMirrorSource(r, env)
+	if err != nil {
+		return nil, err
+	}
+	state, err := loadMirrorState()
+	if err != nil {
+		return nil, err
+	}
+	since, mirrored := state[source.APIURL]
+	if !opts.Since.IsZero() {
+		// a second before the day starts, since only commits after it are searched for
+		since = opts.Since.Add(-time.Second)
+	} else if !mirrored {
+		return nil, fmt.Errorf("nothing has been mirrored from %v yet, so the first day to mirror commits from is required", source.APIURL)
+	}
+
+	account, client, created, err := backfillAccount(ctx, r, env, tokenClient)
+	if err != nil {
+		return nil, err
+	}
+	dates, err := source.commitDates(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+	if len(dates) > 0 && dates[0].Before(created) {
+		return nil, fmt.Errorf("the first commit to mirror (%v) is before the account was created (%v), mirror from a later day", dates[0].Format(dateLayout), created.Format(dateLayout))
+	}
+
+	commitOpts, err := loadCommitOptions(env)
+	if err != nil {
+		return nil, err
+	}
+	sel, err := loadSelection(env)
+	if err != nil {
+		return nil, err
+	}
+	return &Backdating{Username: account.Username, Repo: account.Repo, Dates: dates, runner: r, commit: func(ctx context.Context) error {
+		repoURL := fmt.Sprintf("https://api.github.com/repos/%v/%v", account.Username, account.Repo)
+		if sel.Branch != "" {
+			if err := ensureBranch(ctx, repoURL, sel.Branch, "", client); err != nil {
+				return err
+			}
+		}
+		if err := commitEmpty(ctx, repoURL, sel.Branch, dates, commitOpts, client); err != nil {
+			return err
+		}
+		state[source.APIURL] = dates[len(dates)-1]
+		if err := saveMirrorState(state); err != nil {
+			return fmt.Errorf("Error recording the mirrored commits, the next run will mirror them again unless it is given a later day to mirror from: %w", err)
+		}
+		return nil
+	}}, nil
+}
+
+// commitEmpty makes an empty commit (with the same tree as its parent) for each of dates to branch (or if it is "", the default branch) of the repository with the api url repoURL,
+// with the git data api, each the parent of the next, and moves the branch to the last of them with a single ref update, which is not forced, as uploadGitData does
+func commitEmpty(ctx context.Context, repoURL string, branch string, dates []time.Time, opts commitOptions, client *http.Client) error {
+	refURL, parent, tree, err := branchHead(ctx, repoURL, branch, client)
+	if err != nil {
+		return err
+	}
+	identity := gitIdentity{}
+	if opts.Author != nil {
+		identity = *opts.Author
+	} else if identity, err = authenticatedIdentity(ctx, client); err != nil {
+		return err
+	}
+	for _, date := range dates {
+		identity.Date = date.Format(time.RFC3339)
+		// mirrored commits get the same trailers as every other generated commit, and the signature has to cover the message exactly as it is committed
+		message := opts.Messages.finish(mirrorMessage)
+		commitBody := map[string]interface{}{
+			"message":   message,
+			"tree":      tree,
+			"parents":   []string{parent},
+			"author":    identity,
+			"committer": identity,
+		}
+		if opts.Signer != nil {
+			signature, err := opts.Signer.sign(ctx, commitPayload(tree, parent, identity, date, message))
+			if err != nil {
+				return err
+			}
+			commitBody["signature"] = signature
+		}
+		var commit gitDataObject
+		if err := jsonRequest(ctx, client, "POST", repoURL+"/git/commits", commitBody, &commit); err != nil {
+			return err
+		}
+		parent = commit.SHA
+	}
+	return jsonRequest(ctx, client, "PATCH", refURL, map[string]interface{}{"sha": parent, "force": false}, nil)
+}
@@ -0,0 +1,49 @@
+package commitcron
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// roundTripperFunc is an http.RoundTripper that answers every request with a function
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// the mirrored account is on another api, so the Runner's base url doesn't apply to it, but its http client does
+func TestMirrorSourceUsesRunnerTransport(t *testing.T) {
+	var sent *http.Request
+	runner, err := New(
+		WithHTTPClient(&http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			sent = req
+			return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("{}")), Request: req}, nil
+		})}),
+		WithBaseURL("https://github.example.com/api/v3"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := loadMirrorSource(runner, Settings{"MIRROR_API_URL": "https://mirrored.example.com/api/v3", "MIRROR_TOKEN": "mirror-token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := source.Client.Get(source.APIURL + "/user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if sent == nil {
+		t.Fatal("the request wasn't sent with the runner's http client")
+	}
+	if got, want := sent.URL.String(), "https://mirrored.example.com/api/v3/user"; got != want {
+		t.Errorf("sent the request to %v, want %v", got, want)
+	}
+	if got, want := sent.Header.Get("Authorization"), "token mirror-token"; got != want {
+		t.Errorf("authorized the request with %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,182 @@
+// Package pathmatch matches slash separated repository paths against gitignore style patterns
+// it is used for every file in this project that uses gitignore pattern syntax (eg. .commitcronignore), and for glob lists in configuration
+// see: https://git-scm.com/docs/gitignore#_pattern_format
+package pathmatch
+
+import (
+	"regexp"
+	"strings"
+)
+
+// pattern is a single compiled gitignore pattern
+type pattern struct {
+	re *regexp.Regexp
+	// negate is true for patterns starting with "!", which re-include paths excluded by earlier patterns
+	negate bool
+	// dirOnly is true for patterns ending with "/", which only match directories
+	dirOnly bool
+}
+
+// Matcher matches paths against a list of gitignore style patterns, where the last pattern that matches a path decides whether it matches
+type Matcher struct {
+	patterns []pattern
+}
+
+// Parse compiles the patterns in text, one per line, as they would appear in a .gitignore file
+// blank lines and lines starting with "#" are skipped, and patterns that can't be compiled are ignored, the same as git ignores them
+func Parse(text string) *Matcher {
+	return New(strings.Split(text, "\n"))
+}
+
+// New compiles patterns, each of which is a single gitignore style pattern
+func New(patterns []string) *Matcher {
+	m := &Matcher{}
+	for _, line := range patterns {
+		line = strings.TrimRight(line, "\r")
+		// trailing spaces are ignored unless they are escaped
+		if !strings.HasSuffix(line, "\\ ") {
+			line = strings.TrimRight(line, " ")
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if p, ok := compile(line); ok {
+			m.patterns = append(m.patterns, p)
+		}
+	}
+	return m
+}
+
+// Empty reports whether m has no patterns, and so matches nothing
+func (m *Matcher) Empty() bool {
+	return m == nil || len(m.patterns) == 0
+}
+
+// Match reports whether the slash separated path p (relative to the repository root) matches, isDir says whether p is a directory
+// as with gitignore, a path inside a matched directory matches too, and it can't be un-matched by a negated pattern
+func (m *Matcher) Match(p string, isDir bool) bool {
+	if m.Empty() {
+		return false
+	}
+	p = strings.Trim(p, "/")
+	parts := strings.Split(p, "/")
+	for i := 1; i < len(parts); i++ {
+		if m.match(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return m.match(p, isDir)
+}
+
+// MatchLast reports whether the slash separated path p (relative to the repository root) matches, isDir says whether p is a directory
+// a pattern that matches a directory matches every path inside it, but unlike Match, the last pattern that matches p or any directory it is in decides,
+// so a negated pattern can un-match a path inside a directory matched by an earlier one, which is how .gitattributes and CODEOWNERS files are evaluated
+func (m *Matcher) MatchLast(p string, isDir bool) bool {
+	if m.Empty() {
+		return false
+	}
+	p = strings.Trim(p, "/")
+	parts := strings.Split(p, "/")
+	matched := false
+	for _, pat := range m.patterns {
+		for i := 1; i <= len(parts); i++ {
+			dir := i < len(parts) || isDir
+			if pat.dirOnly && !dir {
+				continue
+			}
+			if pat.re.MatchString(strings.Join(parts[:i], "/")) {
+				matched = !pat.negate
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// match checks p against the patterns alone, without checking the directories it is in
+func (m *Matcher) match(p string, isDir bool) bool {
+	matched := false
+	for _, pat := range m.patterns {
+		if pat.dirOnly && !isDir {
+			continue
+		}
+		if pat.re.MatchString(p) {
+			matched = !pat.negate
+		}
+	}
+	return matched
+}
+
+// compile converts a single gitignore pattern into a regular expression
+func compile(line string) (pattern, bool) {
+	var p pattern
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return p, false
+	}
+
+	// a pattern with a slash at its start or in its middle is relative to the root, otherwise it matches at any depth
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	var re strings.Builder
+	re.WriteString("^")
+	if !anchored {
+		re.WriteString("(?:.*/)?")
+	}
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case strings.HasPrefix(line[i:], "**/"):
+			// leading or middle "**/" matches zero or more directories
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(line[i:], "/**") && i+3 == len(line):
+			// trailing "/**" matches everything inside
+			re.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(line[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(line[i+1:], ']')
+			if end < 0 {
+				re.WriteString(regexp.QuoteMeta(string(c)))
+				continue
+			}
+			class := line[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			re.WriteString("[" + strings.Replace(class, "\\", "\\\\", -1) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(line):
+			i++
+			re.WriteString(regexp.QuoteMeta(string(line[i])))
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+
+	compiled, err := regexp.Compile(re.String())
+	if err != nil {
+		return p, false
+	}
+	p.re = compiled
+	return p, true
+}
@@ -0,0 +1,133 @@
+package pathmatch
+
+import "testing"
+
+// matchCases are checked with Match, which follows git's rules for .gitignore files (the expected results are what git check-ignore reports)
+var matchCases = []struct {
+	name     string
+	patterns string
+	path     string
+	isDir    bool
+	want     bool
+}{
+	// a pattern without a slash matches at any depth
+	{"name at the root", "go.mod", "go.mod", false, true},
+	{"name at any depth", "go.mod", "sub/dir/go.mod", false, true},
+	{"name is not a prefix", "go.mod", "go.mod.bak", false, false},
+	{"glob at any depth", "*.log", "a/b/debug.log", false, true},
+	{"star doesn't cross a slash", "a*c", "ab/c", false, false},
+	{"question mark", "file?.txt", "file1.txt", false, true},
+	{"question mark doesn't match a slash", "a?b", "a/b", false, false},
+
+	// a slash at the start or in the middle anchors the pattern to the root
+	{"leading slash", "/build", "build", true, true},
+	{"leading slash is anchored", "/build", "src/build", true, false},
+	{"middle slash is anchored", "doc/frotz", "doc/frotz", false, true},
+	{"middle slash is anchored below the root", "doc/frotz", "a/doc/frotz", false, false},
+
+	// a trailing slash only matches directories, and everything inside them
+	{"directory pattern matches a directory", "build/", "build", true, true},
+	{"directory pattern doesn't match a file", "build/", "build", false, false},
+	{"directory pattern matches inside", "build/", "build/out/app", false, true},
+	{"directory pattern at any depth", "node_modules/", "web/node_modules/x/index.js", false, true},
+
+	// **
+	{"leading **", "**/foo", "a/b/foo", false, true},
+	{"leading ** matches at the root", "**/foo", "foo", false, true},
+	{"trailing **", "abc/**", "abc/x/y", false, true},
+	{"trailing ** doesn't match the directory itself", "abc/**", "abc", false, false},
+	{"middle **", "a/**/b", "a/x/y/b", false, true},
+	{"middle ** matches no directories", "a/**/b", "a/b", false, true},
+
+	// character classes and escapes
+	{"class", "[abc].txt", "b.txt", false, true},
+	{"class doesn't match", "[abc].txt", "d.txt", false, false},
+	{"negated class", "[!abc].txt", "d.txt", false, true},
+	{"range", "v[0-9]", "v7", false, true},
+	{"escaped star", `\*.txt`, "*.txt", false, true},
+	{"escaped star is literal", `\*.txt`, "a.txt", false, false},
+	{"escaped hash", `\#notes`, "#notes", false, true},
+	{"escaped bang", `\!important`, "!important", false, true},
+	{"dot is literal", "a.c", "abc", false, false},
+
+	// blank lines, comments and trailing spaces
+	{"comment", "# go.mod", "# go.mod", false, false},
+	{"blank lines", "\n\n   \n", "anything", false, false},
+	{"trailing spaces are ignored", "go.mod   ", "go.mod", false, true},
+	{"escaped trailing space is kept", `name\ `, "name ", false, true},
+	{"crlf line endings", "go.mod\r\n*.log\r\n", "x.log", false, true},
+
+	// negation: the last pattern that matches decides
+	{"negation re-includes", "*.log\n!keep.log", "keep.log", false, false},
+	{"negation before the pattern is overridden", "!keep.log\n*.log", "keep.log", false, true},
+	{"negation only re-includes what it matches", "*.log\n!keep.log", "other.log", false, true},
+	// a file can't be re-included if a directory it is in is excluded
+	{"excluded directory can't be re-included inside", "build/\n!build/keep.txt", "build/keep.txt", false, true},
+	{"everything under src", "src/**\n!src/scratch/", "src/other.go", false, true},
+	{"re-including only a directory keeps its files ignored", "src/**\n!src/scratch/", "src/scratch/foo.go", false, true},
+	{"re-including a directory and its files", "src/**\n!src/scratch/\n!src/scratch/**", "src/scratch/foo.go", false, false},
+	{"re-including a directory and its nested files", "src/**\n!src/scratch/\n!src/scratch/**", "src/scratch/a/b.go", false, false},
+	{"re-including a directory doesn't re-include its neighbours", "src/**\n!src/scratch/\n!src/scratch/**", "src/scratchy.go", false, true},
+	{"re-including a directory and its files keeps others ignored", "src/**\n!src/scratch/\n!src/scratch/**", "src/a.go", false, true},
+
+	// slashes around the path don't matter
+	{"leading and trailing slashes of the path", "build/", "/build/", true, true},
+}
+
+func TestMatch(t *testing.T) {
+	for _, c := range matchCases {
+		if got := Parse(c.patterns).Match(c.path, c.isDir); got != c.want {
+			t.Errorf("%v: Parse(%q).Match(%q, %v) = %v, want %v", c.name, c.patterns, c.path, c.isDir, got, c.want)
+		}
+	}
+}
+
+func TestMatchLast(t *testing.T) {
+	cases := []struct {
+		name     string
+		patterns string
+		path     string
+		want     bool
+	}{
+		{"directory matches inside", "vendor/", "vendor/lib/a.go", true},
+		{"glob matches inside a matched directory", "gen/**", "gen/a/b.go", true},
+		// unlike Match, a later negation can un-match a path inside a directory matched by an earlier pattern, as in .gitattributes and CODEOWNERS
+		{"negation inside a matched directory", "vendor/\n!vendor/ours/", "vendor/ours/a.go", false},
+		{"negation of a file inside a matched directory", "docs/\n!docs/README.md", "docs/README.md", false},
+		{"negation doesn't affect neighbours", "vendor/\n!vendor/ours/", "vendor/theirs/a.go", true},
+		{"later pattern wins", "!*.go\n*.go", "a.go", true},
+		{"no pattern matches", "*.md", "a.go", false},
+	}
+	for _, c := range cases {
+		if got := Parse(c.patterns).MatchLast(c.path, false); got != c.want {
+			t.Errorf("%v: Parse(%q).MatchLast(%q, false) = %v, want %v", c.name, c.patterns, c.path, got, c.want)
+		}
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	var m *Matcher
+	if !m.Empty() || m.Match("a", false) || m.MatchLast("a", false) {
+		t.Error("a nil Matcher should be empty and match nothing")
+	}
+	if !Parse("# only a comment\n\n").Empty() {
+		t.Error("a Matcher of only comments and blank lines should be empty")
+	}
+	if Parse("*").Empty() {
+		t.Error("a Matcher with a pattern should not be empty")
+	}
+	// a pattern that can't be compiled is ignored, as git ignores it
+	if m := New([]string{"[z-a]", "/"}); !m.Empty() {
+		t.Errorf("New of invalid patterns has %v patterns, want none", len(m.patterns))
+	}
+}
+
+func TestNew(t *testing.T) {
+	// each of New's patterns is a single pattern, as in a glob list in configuration
+	m := New([]string{"*.lock", "!keep.lock", "dist/"})
+	for p, want := range map[string]bool{"yarn.lock": true, "keep.lock": false, "dist/app.js": true, "src/app.js": false} {
+		if got := m.Match(p, false); got != want {
+			t.Errorf("Match(%q) = %v, want %v", p, got, want)
+		}
+	}
+}
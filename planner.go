@@ -0,0 +1,475 @@
+package commitcron
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/anacanm/commitCron/auth"
+	"golang.org/x/sync/errgroup"
+)
+
+// Plan is everything a run will change in a single repository, decided before anything is changed, so that it can be printed, or serialized to json,
+// reviewed, and then executed as it is (see Planner)
+type Plan struct {
+	Username string `json:"username"`
+	Repo     string `json:"repo"`
+	// Branch is the branch that the files were read from, and that the changes are committed to, or "" for the default branch
+	Branch string `json:"branch,omitempty"`
+	// ContributionsToday is how many contributions the account had made today when the plan was made
+	ContributionsToday int `json:"contributions_today"`
+	// Changes are the changes to be made, in the order they are committed, there are none if no contributions are needed
+	Changes []PlannedChange `json:"changes"`
+	// FilesPerCommit is how many of the changes share each commit
+	FilesPerCommit int `json:"files_per_commit"`
+	// CommitDates are the dates of each of the commits, or none if the commits are dated when they are made
+	CommitDates []time.Time `json:"commit_dates,omitempty"`
+}
+
+// PlannedChange is a single change to a file in a Plan
+type PlannedChange struct {
+	// Action is create, update or delete
+	Action string `json:"action"`
+	Path   string `json:"path"`
+	// SHA is the sha of the file's blob when the plan was made, or "" if it is created
+	SHA string `json:"sha,omitempty"`
+	// Mode is the file's mode, or "" for a regular file
+	Mode string `json:"mode,omitempty"`
+	// Message is the commit message, before it is finished (eg. with a trailer, see commitMessages.finish)
+	Message string `json:"message"`
+	// Content is the whole content that the file is given, or "" if it is deleted
+	Content string `json:"content,omitempty"`
+}
+
+// String renders the plan for review, a line for each change, without the content that the files are given
+func (p *Plan) String() string {
+	var b strings.Builder
+	branch := p.Branch
+	if branch == "" {
+		branch = "the default branch"
+	}
+	fmt.Fprintf(&b, "%v/%v, on %v: %v contributions made today, %v changes planned\n", p.Username, p.Repo, branch, p.ContributionsToday, len(p.Changes))
+	for i, c := range p.Changes {
+		date := "when committed"
+		if p.FilesPerCommit > 0 && i/p.FilesPerCommit < len(p.CommitDates) {
+			date = p.CommitDates[i/p.FilesPerCommit].Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(&b, "  %-6v %v (%v): %v\n", c.Action, c.Path, date, c.Message)
+	}
+	return b.String()
+}
+
+// plannedChanges returns the PlannedChange for each of updates
+func plannedChanges(updates []fileUpdate) []PlannedChange {
+	changes := make([]PlannedChange, 0, len(updates))
+	for _, u := range updates {
+		change := PlannedChange{Action: "update", Path: u.File.Path, SHA: u.File.SHA, Mode: u.File.Mode, Message: u.Message, Content: string(u.Content)}
+		switch {
+		case u.Delete:
+			change.Action = "delete"
+		case u.File.SHA == "":
+			change.Action = "create"
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// updates returns the fileUpdate that each of the plan's changes is made with
+func (p *Plan) updates() ([]fileUpdate, error) {
+	updates := make([]fileUpdate, 0, len(p.Changes))
+	for _, c := range p.Changes {
+		u := fileUpdate{
+			File:    RepoContent{Name: path.Base(c.Path), Path: c.Path, SHA: c.SHA, Type: "file", Mode: c.Mode},
+			Content: []byte(c.Content),
+			Message: c.Message,
+		}
+		switch c.Action {
+		case "create", "update":
+		case "delete":
+			u.Delete, u.Content = true, nil
+		default:
+			return nil, fmt.Errorf("%v: %q is not an action, must be create, update or delete", c.Path, c.Action)
+		}
+		if err := validGitPath(c.Path); err != nil {
+			return nil, fmt.Errorf("%v can't be changed: %w", c.Path, err)
+		}
+		updates = append(updates, u)
+	}
+	return updates, nil
+}
+
+// Planner plans runs of the pipeline through the api, without making any contributions, so that the plans can be reviewed before they are executed
+// only the api engine can be planned, the git engine and PUSH_MODE=ssh decide what to change in their clone of the repository as they change it
+type Planner struct {
+	cfg    Config
+	runner *Runner
+}
+
+// NewPlanner returns a Planner for the accounts in cfg, with the default options (see Runner.Planner)
+func NewPlanner(cfg Config) *Planner {
+	return (&Runner{}).Planner(cfg)
+}
+
+// Plan plans the contributions that Run would make for each of the accounts' repositories, and returns a plan for each of them (those that need no contributions have no changes)
+// planning changes nothing: it only reads, and a BRANCH that does not exist yet is planned from the default branch, and only created when the plan is executed
+func (p *Planner) Plan(ctx context.Context) ([]*Plan, error) {
+	ctx, env := withConfig(withRunner(ctx, p.runner), p.cfg), p.cfg.Settings
+	engine, err := loadEngine(env)
+	if err != nil {
+		return nil, err
+	}
+	if engine != "api" || env.get("PUSH_MODE") == "ssh" {
+		return nil, fmt.Errorf("only the api engine can be planned, not ENGINE=%v or PUSH_MODE=ssh", engine)
+	}
+	var plans []*Plan
+	for _, account := range p.cfg.Accounts {
+		client, err := account.newClient(p.runner, env, p.cfg.TokenClient)
+		if err != nil {
+			return plans, fmt.Errorf("Error configuring github credentials for %v: %w", account.Username, err)
+		}
+		split, minContributions, err := accountSplit(ctx, env, account, client, nil, p.cfg.NumberOfContributions, p.cfg.MinContributions)
+		if err != nil {
+			return plans, err
+		}
+		for i, repo := range account.repos() {
+			repoAccount := account
+			repoAccount.Repo = repo
+			plan, err := planRepo(ctx, env, repoAccount, client, split[i], minContributions)
+			if err != nil {
+				return plans, fmt.Errorf("Error planning %v/%v: %w", account.Username, repo, err)
+			}
+			plans = append(plans, plan)
+		}
+	}
+	return plans, nil
+}
+
+// Execute makes the changes in each of plans to its repository, with the credentials of the account in the planner's config that it was planned for,
+// and returns a report of what was made
+// since each change gives its file the whole planned content, a plan that changes a file that has changed since it was planned is refused, rather than undoing that change,
+// and has to be planned again (see checkPlanCurrent)
+func (p *Planner) Execute(ctx context.Context, plans []*Plan) (*Report, error) {
+	ctx, env := withConfig(withRunner(ctx, p.runner), p.cfg), p.cfg.Settings
+	report := &Report{Started: currentTime(ctx)}
+	if err := runStarted(ctx); err != nil {
+		return report, err
+	}
+	started := time.Now()
+	var errs []error
+	for _, plan := range plans {
+		planStarted := time.Now()
+		result := RepoReport{Repo: plan.Repo, Planned: len(plan.Changes)}
+		repoCtx, _ := withRecorder(ctx, plan.Username, &result)
+		if account, ok := p.account(plan); !ok {
+			result.Err = fmt.Errorf("%v/%v is not one of the configured accounts' repositories", plan.Username, plan.Repo)
+		} else if client, err := account.newClient(p.runner, env, p.cfg.TokenClient); err != nil {
+			result.Err = fmt.Errorf("Error configuring github credentials: %w", err)
+		} else if len(plan.Changes) > 0 {
+			if result.Err = planReady(repoCtx, plan); result.Err == nil {
+				result.Made, result.Err = executePlan(repoCtx, env, account, client, plan)
+				recordStep(repoCtx, "execute", planStarted)
+			}
+		}
+		if result.Err != nil {
+			logger(ctx).Error("Failed to execute the plan", "account", plan.Username, "repo", plan.Repo, "err", result.Err)
+			errs = append(errs, fmt.Errorf("%v/%v: %w", plan.Username, plan.Repo, result.Err))
+		}
+		// the contributions were counted when the plan was made, rather than when it is executed
+		report.Accounts = append(report.Accounts, AccountReport{
+			Username:            plan.Username,
+			ContributionsBefore: plan.ContributionsToday,
+			ContributionsAfter:  plan.ContributionsToday + result.Made,
+			Repos:               []RepoReport{result},
+			Duration:            time.Since(planStarted),
+			Err:                 result.Err,
+		})
+	}
+	report.Duration = time.Since(started)
+	runFinished(ctx, report)
+	if len(errs) > 0 {
+		return report, fmt.Errorf("%v of %v plans failed: %w", len(errs), len(plans), errors.Join(errs...))
+	}
+	return report, nil
+}
+
+// account returns the configured account that plan was planned for, with its Repo set to the plan's
+func (p *Planner) account(plan *Plan) (Account, bool) {
+	for _, account := range p.cfg.Accounts {
+		if account.Username != plan.Username {
+			continue
+		}
+		for _, repo := range account.repos() {
+			if repo == plan.Repo {
+				account.Repo = repo
+				return account, true
+			}
+		}
+	}
+	return Account{}, false
+}
+
+// planRepo counts the contributions that the account has made today, and if there are fewer than minContributions (or minContributions is -1),
+// plans numberOfContributionsToMake contributions to the account's repository, otherwise the plan has no changes
+func planRepo(ctx context.Context, env Settings, account Account, client *http.Client, numberOfContributionsToMake int, minContributions int) (*Plan, error) {
+	// fail early with a clear message if the token is unable to modify the repository, as far as that can be checked without writing to it (see executePlan)
+	access, err := auth.CheckReadOnly(client, account.Username, account.Repo)
+	if err != nil {
+		return nil, fmt.Errorf("Error validating github credentials: %w", err)
+	}
+	if err := warnIfTokenExpiring(ctx, env, access.Expiration); err != nil {
+		return nil, err
+	}
+
+	sel, err := loadSelection(env)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := loadCommitOptions(env)
+	if err != nil {
+		return nil, err
+	}
+
+	// a branch that does not exist yet is only created when the plan is executed, from the default branch, so until then, that is what is read in its place
+	read := sel
+	if sel.Branch != "" {
+		exists, err := branchExists(ctx, fmt.Sprintf("https://api.github.com/repos/%v/%v", account.Username, account.Repo), sel.Branch, client)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			read.Branch = ""
+		}
+	}
+	api := &githubAPI{client: client}
+	counter, err := contributionsService(ctx, env, client)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := planChanges(ctx, account, counter, api, read, opts, numberOfContributionsToMake, minContributions)
+	if err != nil {
+		return nil, err
+	}
+	plan.Branch = sel.Branch
+	return plan, nil
+}
+
+// planChanges is planRepo once the repository is ready to be read: it counts the account's contributions with counter, and reads its repository with lister,
+// without changing anything, or making any request of its own
+func planChanges(ctx context.Context, account Account, counter ContributionsReader, lister RepoLister, sel Selection, opts commitOptions, numberOfContributionsToMake int, minContributions int) (*Plan, error) {
+	content := opts.Content
+	plan := &Plan{Username: account.Username, Repo: account.Repo, Branch: sel.Branch, FilesPerCommit: opts.FilesPerCommit}
+
+	// counting today's contributions and finding the files to modify are independent of each other, so they are done concurrently
+	// g cancels gctx as soon as either fails, which aborts the other's request in flight, and g.Wait is the single place their errors are collected
+	g, gctx := errgroup.WithContext(ctx)
+	// traversalCtx is also cancelled as soon as the traversal turns out not to be needed, since we have already achieved our daily quota
+	traversalCtx, cancelTraversal := context.WithCancel(gctx)
+	defer cancelTraversal()
+
+	var makeContributions bool
+	g.Go(func() (err error) {
+		defer recoverPanic(&err)
+		today, err := counter.Count(gctx, account.Username)
+		if err != nil {
+			return fmt.Errorf("Error getting contributions: %w", err)
+		}
+
+		plan.ContributionsToday = today
+		recordContributions(ctx, today)
+		makeContributions = today < minContributions || minContributions == -1
+		if !makeContributions {
+			cancelTraversal()
+		}
+		return nil
+	})
+
+	var contents []RepoContent
+	g.Go(func() (err error) {
+		defer recoverPanic(&err)
+		// in journal, changelog and recreate mode, every contribution is a change to the same file, so there are no files to choose
+		if content.Mode != "files" {
+			contents, err = journalContents(listerFileReader(traversalCtx, lister, account.Username, account.Repo, sel.Branch), content.journalFile(sel, currentTime(ctx)), numberOfContributionsToMake)
+			if err != nil && traversalCtx.Err() != nil && gctx.Err() == nil {
+				return nil
+			}
+			return err
+		}
+
+		// paths that the repository's owner has excluded in its .commitcronignore file, or marked as generated or vendored in its .gitattributes file, are never selected
+		err = sel.loadRepoFiles(listerFileReader(traversalCtx, lister, account.Username, account.Repo, sel.Branch), account.Username)
+
+		// if the repository is too large to be listed at once, only a sample of its files is listed, so the files are chosen at random from that sample
+		var candidates []RepoContent
+		if err == nil {
+			candidates, err = lister.ListFiles(traversalCtx, account.Username, account.Repo, sel, numberOfContributionsToMake*candidateOversample)
+		}
+		if err == nil {
+			shuffleCandidates(candidates)
+			if sel.PreferStale {
+				err = preferStale(traversalCtx, candidates, numberOfContributionsToMake*candidateOversample, account.Username, account.Repo, sel.Branch, lister)
+			}
+		}
+		if err == nil {
+			contents, err = chooseFiles(traversalCtx, candidates, numberOfContributionsToMake, sel, account.Username, account.Repo, lister)
+		}
+		if err == nil && sel.ReuseGenerated {
+			contents = sel.reuseGenerated(contents, numberOfContributionsToMake)
+		}
+		if err != nil && traversalCtx.Err() != nil && gctx.Err() == nil {
+			// the traversal was cancelled because it was not needed, which is not an error
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Error getting repo contents from %v: %w", repoContentsURL(account.Username, account.Repo), err)
+		}
+		return nil
+	})
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	if !makeContributions || numberOfContributionsToMake == 0 {
+		return plan, nil
+	}
+
+	// the dates are decided now, so that the journal's entries are dated the same as the commits that add them
+	commits := (numberOfContributionsToMake + opts.FilesPerCommit - 1) / opts.FilesPerCommit
+	opts.Dates = opts.Times.dates(commits, currentTime(ctx))
+	updates, err := planUpdates(ctx, listerFileReader(ctx, lister, account.Username, account.Repo, sel.Branch), listerDirLister(ctx, lister, account.Username, account.Repo, sel.Branch), contents, sel, opts)
+	if err != nil {
+		return nil, err
+	}
+	plan.Changes, plan.CommitDates = plannedChanges(updates), opts.Dates
+	return plan, nil
+}
+
+// executePlan makes the changes in plan to the account's repository, returning the number of contributions made
+// in pull request mode, the changes are committed to a fresh branch made from the plan's branch (or the default branch), and merged into it with a pull request
+func executePlan(ctx context.Context, env Settings, account Account, client *http.Client, plan *Plan) (int, error) {
+	// the plan is checked before anything is changed, rather than once a pull request branch has been made for it
+	if _, err := plan.updates(); err != nil {
+		return 0, err
+	}
+	sel, err := loadSelection(env)
+	if err != nil {
+		return 0, err
+	}
+	sel.Branch = plan.Branch
+	opts, err := loadCommitOptions(env)
+	if err != nil {
+		return 0, err
+	}
+	prOpts, err := loadPullRequestOptions(ctx, env, account)
+	if err != nil {
+		return 0, err
+	}
+	// planning only checks what it can without writing to the repository, so the token's write access is checked in full (which writes an unreferenced blob) before anything is changed
+	if _, err := auth.CheckAccess(client, account.Username, account.Repo); err != nil {
+		return 0, fmt.Errorf("Error validating github credentials: %w", err)
+	}
+	repoURL := fmt.Sprintf("https://api.github.com/repos/%v/%v", account.Username, account.Repo)
+	// planning doesn't create the branch, so it is created here if it doesn't exist yet
+	if sel.Branch != "" {
+		if err := ensureBranch(ctx, repoURL, sel.Branch, "", client); err != nil {
+			return 0, err
+		}
+	}
+
+	// the plan is checked against the branch that it was planned on, before a pull request branch is made from it
+	if err := checkPlanCurrent(ctx, &githubAPI{client: client}, plan); err != nil {
+		return 0, err
+	}
+
+	// in pull request mode, the files are chosen from the branch (or the default branch), and the changes are committed to a fresh branch made from it, to be merged into it
+	base := sel.Branch
+	if prOpts.Enabled {
+		// leftover branches are only clutter, so failing to delete them is not a reason to fail the run
+		if deleted, err := cleanupPullRequestBranches(ctx, repoURL, currentTime(ctx), client); err != nil {
+			logger(ctx).Error("Error cleaning up old branches", "prefix", pullRequestBranchPrefix, "err", err)
+		} else if deleted > 0 {
+			logger(ctx).Info("Deleted old branches", "prefix", pullRequestBranchPrefix, "deleted", deleted)
+		}
+		sel.Branch = pullRequestBranch(currentTime(ctx))
+		if err := ensureBranch(ctx, repoURL, sel.Branch, base, client); err != nil {
+			return 0, err
+		}
+	}
+	// the changes are written to the branch that they are committed to, which in pull request mode is not the plan's
+	written := *plan
+	written.Branch = sel.Branch
+	var writer FileWriter = &githubAPI{client: client, sel: sel, opts: opts}
+	if err := writer.WriteFiles(ctx, &written); err != nil {
+		return 0, err
+	}
+	pruned, err := pruneGenerated(ctx, account.Username, account.Repo, sel, opts, client)
+	if err != nil {
+		return len(plan.Changes) + pruned, fmt.Errorf("Error pruning generated files: %w", err)
+	}
+	made := len(plan.Changes) + pruned
+	if !prOpts.Enabled {
+		return made, nil
+	}
+
+	pr, err := openPullRequest(ctx, repoURL, sel.Branch, base, fmt.Sprintf("Activity for %v", currentTime(ctx).Format(dateLayout)), prOpts.Draft, client)
+	if err != nil {
+		return made, err
+	}
+	// labels and the like only make the pull request easier to find, so failing to add them is not a reason to leave it unmerged
+	if err := markPullRequest(ctx, repoURL, pr, prOpts, account.Username, client); err != nil {
+		logger(ctx).Warn("Error marking the pull request", "url", pr.HTMLURL, "err", err)
+	}
+	// a failed review is logged rather than returned, since the pull request may well be mergeable without it
+	if prOpts.Reviewer != nil {
+		if err := reviewPullRequest(ctx, repoURL, pr, prOpts.ReviewEvent, prOpts.Reviewer); err != nil {
+			logger(ctx).Warn("Error reviewing the pull request", "url", pr.HTMLURL, "err", err)
+		}
+	}
+	if prOpts.Draft {
+		if err := markReadyForReview(ctx, pr, client); err != nil {
+			return made, err
+		}
+	}
+	merged, err := mergePullRequest(ctx, repoURL, pr, prOpts.MergeMethod, client)
+	if err != nil {
+		return made, err
+	}
+	if merged {
+		logger(ctx).Info("Opened and merged a pull request", "url", pr.HTMLURL)
+		// a branch that is waiting for auto-merge can't be deleted yet, so it is deleted by a later run's cleanup instead
+		if err := deleteBranch(ctx, repoURL, sel.Branch, client); err != nil {
+			logger(ctx).Warn("Error deleting the merged branch", "branch", sel.Branch, "err", err)
+		}
+	} else {
+		logger(ctx).Info("Opened a pull request, it will be merged once its requirements are met", "url", pr.HTMLURL)
+	}
+	return made, nil
+}
+
+// checkPlanCurrent returns an error unless every file that plan changes is still as it was when the plan was made, as read with lister
+// a file that is changed more than once is only checked once, since only the first of its changes is made to it as it is in the repository, the rest build on the one before them
+func checkPlanCurrent(ctx context.Context, lister RepoLister, plan *Plan) error {
+	checked := map[string]bool{}
+	for _, c := range plan.Changes {
+		if checked[c.Path] {
+			continue
+		}
+		checked[c.Path] = true
+		data, found, err := lister.ReadFile(ctx, plan.Username, plan.Repo, plan.Branch, c.Path, maxRawFileBytes)
+		if err != nil {
+			return fmt.Errorf("Error checking whether %v has changed since the plan was made: %w", c.Path, err)
+		}
+		current := ""
+		if found {
+			current = blobSHA(data)
+		}
+		if current != c.SHA {
+			return fmt.Errorf("%v has changed since the plan was made, and executing the plan would undo that change, so it has to be planned again", c.Path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package commitcron
+
+import (
+	"bytes"
+	"context"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeCounter is a ContributionsReader that counts a fixed number of contributions
+type fakeCounter struct {
+	today int
+}
+
+func (c fakeCounter) Count(ctx context.Context, username string) (int, error) {
+	return c.today, nil
+}
+
+// fakeRepo is a RepoLister and FileWriter of a repository that is held in memory, keyed by path
+// if blockListing is set, ListFiles doesn't return until its context is cancelled
+type fakeRepo struct {
+	mu           sync.Mutex
+	files        map[string][]byte
+	blockListing bool
+	// listed and sample are whether ListFiles was called, and the sample it was first asked for, which is the listing of the candidates
+	// (the directories that new go files are created in are listed after it, see listerDirLister)
+	listed bool
+	sample int
+}
+
+func (r *fakeRepo) ListFiles(ctx context.Context, owner, repo string, sel Selection, sample int) ([]RepoContent, error) {
+	r.mu.Lock()
+	if !r.listed {
+		r.listed, r.sample = true, sample
+	}
+	r.mu.Unlock()
+	if r.blockListing {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	filter := sel.filter(sample)
+	var contents []RepoContent
+	for p, data := range r.files {
+		if filter.Allows(p) && int64(len(data)) <= filter.MaxSize {
+			contents = append(contents, RepoContent{Name: path.Base(p), Path: p, SHA: blobSHA(data), Type: "file", Size: int64(len(data))})
+		}
+	}
+	return contents, nil
+}
+
+func (r *fakeRepo) ReadFile(ctx context.Context, owner, repo, ref, p string, limit int64) ([]byte, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	data, ok := r.files[p]
+	if !ok || int64(len(data)) > limit {
+		return nil, false, nil
+	}
+	return data, true, nil
+}
+
+func (r *fakeRepo) LastModified(ctx context.Context, owner, repo, ref, p string) (time.Time, error) {
+	return time.Time{}, nil
+}
+
+func (r *fakeRepo) WriteFiles(ctx context.Context, plan *Plan) error {
+	updates, err := plan.updates()
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, u := range updates {
+		if u.Delete {
+			delete(r.files, u.File.Path)
+		} else {
+			r.files[u.File.Path] = u.Content
+		}
+	}
+	return nil
+}
+
+// testPlanOptions returns the Selection and commitOptions that env configures
+func testPlanOptions(t *testing.T, env Settings) (Selection, commitOptions) {
+	t.Helper()
+	sel, err := loadSelection(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := loadCommitOptions(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sel, opts
+}
+
+func TestPlanChangesQuotaMet(t *testing.T) {
+	sel, opts := testPlanOptions(t, Settings{})
+	// the listing blocks until it is cancelled, so planning only finishes if the quota being met cancels it
+	repo := &fakeRepo{files: map[string][]byte{"a.txt": []byte("a\n")}, blockListing: true}
+	account := Account{Username: "user", Repo: "repo"}
+
+	plan, err := planChanges(context.Background(), account, fakeCounter{today: 5}, repo, sel, opts, 3, 5)
+	if err != nil {
+		t.Fatalf("planChanges = %v, want nil", err)
+	}
+	if len(plan.Changes) != 0 {
+		t.Fatalf("planned %v changes, want none once the quota is met", len(plan.Changes))
+	}
+	if plan.ContributionsToday != 5 {
+		t.Fatalf("ContributionsToday = %v, want 5", plan.ContributionsToday)
+	}
+}
+
+func TestPlanChangesQuotaNotMet(t *testing.T) {
+	sel, opts := testPlanOptions(t, Settings{})
+	repo := &fakeRepo{files: map[string][]byte{"a.txt": []byte("a\n")}}
+	account := Account{Username: "user", Repo: "repo"}
+
+	// -1 makes contributions regardless of how many have been made
+	for _, min := range []int{5, -1} {
+		plan, err := planChanges(context.Background(), account, fakeCounter{today: 4}, repo, sel, opts, 2, min)
+		if err != nil {
+			t.Fatalf("planChanges = %v, want nil", err)
+		}
+		if len(plan.Changes) != 2 {
+			t.Fatalf("with a minimum of %v, planned %v changes, want 2", min, len(plan.Changes))
+		}
+	}
+}
+
+func TestPlanChangesOversampleAndBinarySkip(t *testing.T) {
+	sel, opts := testPlanOptions(t, Settings{})
+	repo := &fakeRepo{files: map[string][]byte{
+		"a.txt":      []byte("text\n"),
+		"b.txt":      []byte("more text\n"),
+		"binary.txt": {0x89, 'P', 'N', 'G', 0x00, 0x01},
+		"invalid.go": {0xff, 0xfe, 0xfd},
+		"skip.md":    []byte("not an extension that is modified\n"),
+	}}
+	account := Account{Username: "user", Repo: "repo"}
+
+	const n = 4
+	plan, err := planChanges(context.Background(), account, fakeCounter{}, repo, sel, opts, n, 1)
+	if err != nil {
+		t.Fatalf("planChanges = %v, want nil", err)
+	}
+	if repo.sample != n*candidateOversample {
+		t.Fatalf("listed a sample of %v, want %v", repo.sample, n*candidateOversample)
+	}
+	if len(plan.Changes) != n {
+		t.Fatalf("planned %v changes, want %v", len(plan.Changes), n)
+	}
+	updated, created := map[string]bool{}, 0
+	for _, c := range plan.Changes {
+		switch c.Action {
+		case "update":
+			updated[c.Path] = true
+			if want := blobSHA(repo.files[c.Path]); c.SHA != want {
+				t.Errorf("%v is planned from sha %v, want that of its content, %v", c.Path, c.SHA, want)
+			}
+			if !strings.HasPrefix(c.Content, string(repo.files[c.Path])) {
+				t.Errorf("%v is planned as %q, which doesn't keep its content %q", c.Path, c.Content, repo.files[c.Path])
+			}
+		case "create":
+			created++
+			if _, exists := repo.files[c.Path]; exists {
+				t.Errorf("%v is planned to be created, but it already exists", c.Path)
+			}
+		default:
+			t.Errorf("%v is planned to be %vd", c.Path, c.Action)
+		}
+	}
+	// the binary files and the file with an extension that isn't modified are never chosen, so the two text files are updated, and the rest created
+	if !updated["a.txt"] || !updated["b.txt"] || len(updated) != 2 || created != n-2 {
+		t.Fatalf("updated %v and created %v files, want a.txt and b.txt updated and %v created", updated, created, n-2)
+	}
+}
+
+func TestPlanChangesJournal(t *testing.T) {
+	sel, opts := testPlanOptions(t, Settings{"CONTENT_MODE": "journal"})
+	existing := []byte("# Journal\n\n- an entry from yesterday\n")
+	repo := &fakeRepo{files: map[string][]byte{"JOURNAL.md": existing, "a.txt": []byte("a\n")}}
+	account := Account{Username: "user", Repo: "repo"}
+
+	plan, err := planChanges(context.Background(), account, fakeCounter{}, repo, sel, opts, 3, 1)
+	if err != nil {
+		t.Fatalf("planChanges = %v, want nil", err)
+	}
+	if repo.listed {
+		t.Fatal("the repository was listed, but in journal mode there are no files to choose")
+	}
+	if len(plan.Changes) != 3 {
+		t.Fatalf("planned %v changes, want 3", len(plan.Changes))
+	}
+	previous := existing
+	for i, c := range plan.Changes {
+		if c.Path != "JOURNAL.md" || c.Action != "update" {
+			t.Fatalf("change %v is to %v %v, want every change to update JOURNAL.md", i, c.Action, c.Path)
+		}
+		// each change builds on the one before it
+		if c.SHA != blobSHA(previous) {
+			t.Fatalf("change %v is from sha %v, want that of the change before it, %v", i, c.SHA, blobSHA(previous))
+		}
+		if !bytes.Contains([]byte(c.Content), existing) || len(c.Content) <= len(previous) {
+			t.Fatalf("change %v, %q, doesn't add to %q", i, c.Content, previous)
+		}
+		previous = []byte(c.Content)
+	}
+
+	var writer FileWriter = repo
+	if err := writer.WriteFiles(context.Background(), plan); err != nil {
+		t.Fatal(err)
+	}
+	if got := repo.files["JOURNAL.md"]; !bytes.Equal(got, previous) {
+		t.Fatalf("JOURNAL.md is %q once the plan is written, want %q", got, previous)
+	}
+}
+
+func TestCheckPlanCurrent(t *testing.T) {
+	sel, opts := testPlanOptions(t, Settings{})
+	repo := &fakeRepo{files: map[string][]byte{"a.txt": []byte("a\n")}}
+	account := Account{Username: "user", Repo: "repo"}
+
+	plan, err := planChanges(context.Background(), account, fakeCounter{}, repo, sel, opts, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkPlanCurrent(context.Background(), repo, plan); err != nil {
+		t.Fatalf("checkPlanCurrent = %v, want nil for an unchanged repository", err)
+	}
+
+	// someone else changes the file that is planned to be updated, after the plan was made
+	repo.files["a.txt"] = []byte("a\nsomeone else's line\n")
+	if err := checkPlanCurrent(context.Background(), repo, plan); err == nil {
+		t.Fatal("checkPlanCurrent = nil, want an error for a file that changed since the plan was made")
+	}
+	repo.files["a.txt"] = []byte("a\n")
+
+	// or creates the file that is planned to be created
+	for _, c := range plan.Changes {
+		if c.Action == "create" {
+			repo.files[c.Path] = []byte("someone else's file\n")
+		}
+	}
+	if err := checkPlanCurrent(context.Background(), repo, plan); err == nil {
+		t.Fatal("checkPlanCurrent = nil, want an error for a file that was created since the plan was made")
+	}
+}
@@ -0,0 +1,324 @@
+package commitcron
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anacanm/commitCron/redact"
+)
+
+// pullRequestBranchPrefix is the prefix of the branches that pull request mode makes its changes on, so that they are recognizable as this script's
+const pullRequestBranchPrefix = "commitcron/"
+
+// pullRequestOptions configures pull request mode, in which each run's changes are committed to a fresh branch, and merged with a pull request
+// instead of being committed to the branch directly, which both makes a pull request contribution, and works on branches that are protected from being pushed to
+type pullRequestOptions struct {
+	Enabled bool
+	// MergeMethod is merge (the default), squash, or rebase
+	MergeMethod string
+	// Reviewer, if it is not nil, is the client of a second account that reviews each pull request before it is merged, since github doesn't let anyone review their own
+	Reviewer *http.Client
+	// ReviewEvent is the kind of review that Reviewer submits, APPROVE (the default) or COMMENT
+	ReviewEvent string
+	// Labels are added to each pull request, eg. bot and automated, so that they are easy to filter
+	Labels []string
+	// AssignSelf assigns each pull request to the account it is opened by
+	AssignSelf bool
+	// Milestone is the title or number of the milestone that each pull request is added to, if it is not ""
+	Milestone string
+	// Draft pull requests are opened as drafts, and only marked as ready for review right before they are merged,
+	// so that nobody (eg. required reviewers) is notified of them until then
+	Draft bool
+}
+
+// loadPullRequestOptions reads the pullRequestOptions for account from the environment, and from the account itself, whose settings take precedence
+func loadPullRequestOptions(ctx context.Context, env Settings, account Account) (pullRequestOptions, error) {
+	opts := pullRequestOptions{MergeMethod: "merge", ReviewEvent: "APPROVE"}
+	var err error
+	if p, present := env.lookup("PR_MODE"); present {
+		opts.Enabled, err = strconv.ParseBool(p)
+		if err != nil {
+			return opts, fmt.Errorf("Error parsing PR_MODE: %w", err)
+		}
+	}
+	if d, present := env.lookup("PR_DRAFT"); present {
+		opts.Draft, err = strconv.ParseBool(d)
+		if err != nil {
+			return opts, fmt.Errorf("Error parsing PR_DRAFT: %w", err)
+		}
+	}
+	if account.PRDraft != nil {
+		opts.Draft = *account.PRDraft
+	}
+	for _, label := range strings.Split(env.get("PR_LABELS"), ",") {
+		if label = strings.TrimSpace(label); label != "" {
+			opts.Labels = append(opts.Labels, label)
+		}
+	}
+	if a, present := env.lookup("PR_ASSIGN_SELF"); present {
+		opts.AssignSelf, err = strconv.ParseBool(a)
+		if err != nil {
+			return opts, fmt.Errorf("Error parsing PR_ASSIGN_SELF: %w", err)
+		}
+	}
+	opts.Milestone = strings.TrimSpace(env.get("PR_MILESTONE"))
+	if m, present := env.lookup("PR_MERGE_METHOD"); present {
+		switch m {
+		case "merge", "squash", "rebase":
+			opts.MergeMethod = m
+		default:
+			return opts, fmt.Errorf("Error parsing PR_MERGE_METHOD: must be merge, squash or rebase, got %q", m)
+		}
+	}
+
+	// the reviewer is a different account from the one the contributions are made for, so it is only ever configured explicitly, never from the usual credentials
+	reviewer := Account{Token: env.get("REVIEWER_TOKEN"), TokenFile: env.get("REVIEWER_TOKEN_FILE")}
+	if reviewer.Token != "" || reviewer.TokenFile != "" {
+		if !opts.Enabled {
+			return opts, fmt.Errorf("REVIEWER_TOKEN and REVIEWER_TOKEN_FILE require PR_MODE, since only pull requests can be reviewed")
+		}
+		redact.Secret(reviewer.Token)
+		opts.Reviewer, err = reviewer.newClient(runnerFrom(ctx), env, nil)
+		if err != nil {
+			return opts, fmt.Errorf("Error creating the reviewer's client: %w", err)
+		}
+	}
+	if e, present := env.lookup("REVIEW_EVENT"); present {
+		switch e {
+		case "APPROVE", "COMMENT":
+			opts.ReviewEvent = e
+		default:
+			return opts, fmt.Errorf("Error parsing REVIEW_EVENT: must be APPROVE or COMMENT, got %q", e)
+		}
+	}
+	return opts, nil
+}
+
+// pullRequestBranch returns the name of a fresh branch for the changes made at now
+func pullRequestBranch(now time.Time) string {
+	return pullRequestBranchPrefix + now.Format(dateLayout) + "-" + strings.ToLower(newULID(now)[10:])
+}
+
+// pullRequest is the necessary data from the pull requests api's response for a single pull request
+type pullRequest struct {
+	Number  int    `json:"number"`
+	NodeID  string `json:"node_id"`
+	HTMLURL string `json:"html_url"`
+}
+
+// openPullRequest opens a pull request (a draft, if draft is set) to merge head into base (or the default branch, if base is "") in the repository with the api url repoURL
+func openPullRequest(ctx context.Context, repoURL string, head, base, title string, draft bool, client *http.Client) (pullRequest, error) {
+	var pr pullRequest
+	if base == "" {
+		var repo gitDataObject
+		if err := jsonRequest(ctx, client, "GET", repoURL, nil, &repo); err != nil {
+			return pr, err
+		}
+		base = repo.DefaultBranch
+	}
+	err := jsonRequest(ctx, client, "POST", repoURL+"/pulls", map[string]interface{}{
+		"title": title,
+		"head":  head,
+		"base":  base,
+		"body":  "Opened automatically by commitCron.",
+		"draft": draft,
+	}, &pr)
+	if err != nil {
+		return pr, fmt.Errorf("Error opening a pull request for %v: %w", head, err)
+	}
+	return pr, nil
+}
+
+// markPullRequest adds the labels, assignee and milestone of opts to pr in the repository with the api url repoURL, opened by the account username
+// pull requests are issues as far as these are concerned, so they are set through the issues api, which creates any label that doesn't exist yet
+func markPullRequest(ctx context.Context, repoURL string, pr pullRequest, opts pullRequestOptions, username string, client *http.Client) error {
+	body := map[string]interface{}{}
+	if len(opts.Labels) > 0 {
+		body["labels"] = opts.Labels
+	}
+	if opts.AssignSelf {
+		body["assignees"] = []string{username}
+	}
+	if opts.Milestone != "" {
+		number, err := milestoneNumber(ctx, repoURL, opts.Milestone, client)
+		if err != nil {
+			return err
+		}
+		body["milestone"] = number
+	}
+	if len(body) == 0 {
+		return nil
+	}
+	if err := jsonRequest(ctx, client, "PATCH", fmt.Sprintf("%v/issues/%v", repoURL, pr.Number), body, nil); err != nil {
+		return fmt.Errorf("Error adding labels, assignees and milestone to %v: %w", pr.HTMLURL, err)
+	}
+	return nil
+}
+
+// milestoneNumber returns the number of the open milestone with the title (or number) milestone in the repository with the api url repoURL
+func milestoneNumber(ctx context.Context, repoURL string, milestone string, client *http.Client) (int, error) {
+	if n, err := strconv.Atoi(milestone); err == nil {
+		return n, nil
+	}
+	var milestones []struct {
+		Number int    `json:"number"`
+		Title  string `json:"title"`
+	}
+	if err := jsonRequest(ctx, client, "GET", repoURL+"/milestones?state=open&per_page=100", nil, &milestones); err != nil {
+		return 0, fmt.Errorf("Error listing milestones: %w", err)
+	}
+	for _, m := range milestones {
+		if m.Title == milestone {
+			return m.Number, nil
+		}
+	}
+	return 0, fmt.Errorf("there is no open milestone titled %q", milestone)
+}
+
+// reviewComments are the bodies that reviews are submitted with
+var reviewComments = []string{
+	"Looks good to me.",
+	"LGTM",
+	"Thanks, merging once the checks pass.",
+	"Reviewed, no concerns.",
+	"Nice, ship it.",
+	"Looks fine, approving.",
+}
+
+// reviewPullRequest submits a review of pr in the repository with the api url repoURL, as the account that reviewer is authorized as
+func reviewPullRequest(ctx context.Context, repoURL string, pr pullRequest, event string, reviewer *http.Client) error {
+	err := jsonRequest(ctx, reviewer, "POST", fmt.Sprintf("%v/pulls/%v/reviews", repoURL, pr.Number), map[string]string{
+		"event": event,
+		"body":  reviewComments[rand.Intn(len(reviewComments))],
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("Error reviewing %v (the reviewer must be able to access the repository, and can't be the account that opened it): %w", pr.HTMLURL, err)
+	}
+	return nil
+}
+
+// mergePullRequest merges pr in the repository with the api url repoURL with method, if it can be merged right away,
+// otherwise (eg. the branch requires status checks to pass first) it enables auto-merge, so that github merges it as soon as the requirements are met
+// returns whether it was merged right away
+func mergePullRequest(ctx context.Context, repoURL string, pr pullRequest, method string, client *http.Client) (bool, error) {
+	err := jsonRequest(ctx, client, "PUT", fmt.Sprintf("%v/pulls/%v/merge", repoURL, pr.Number), map[string]string{"merge_method": method}, nil)
+	if err == nil {
+		return true, nil
+	}
+	// 405 means the pull request can't be merged yet, which is what auto-merge is for, anything else is an actual failure
+	if !isStatus(err, http.StatusMethodNotAllowed) {
+		return false, fmt.Errorf("Error merging %v: %w", pr.HTMLURL, err)
+	}
+	logger(ctx).Info("The pull request can't be merged yet, enabling auto-merge", "url", pr.HTMLURL, "reason", err)
+	if err := enableAutoMerge(ctx, pr, method, client); err != nil {
+		return false, fmt.Errorf("Error enabling auto-merge for %v (auto-merge must be allowed in the repository's settings): %w", pr.HTMLURL, err)
+	}
+	return false, nil
+}
+
+// enableAutoMerge enables auto-merge for pr, which is only possible through the graphql api
+func enableAutoMerge(ctx context.Context, pr pullRequest, method string, client *http.Client) error {
+	return graphqlMutation(ctx, `mutation($id: ID!, $method: PullRequestMergeMethod!) {
+		enablePullRequestAutoMerge(input: {pullRequestId: $id, mergeMethod: $method}) { clientMutationId }
+	}`, map[string]string{"id": pr.NodeID, "method": strings.ToUpper(method)}, client)
+}
+
+// markReadyForReview marks the draft pull request pr as ready for review, which is only possible through the graphql api
+func markReadyForReview(ctx context.Context, pr pullRequest, client *http.Client) error {
+	err := graphqlMutation(ctx, `mutation($id: ID!) {
+		markPullRequestReadyForReview(input: {pullRequestId: $id}) { clientMutationId }
+	}`, map[string]string{"id": pr.NodeID}, client)
+	if err != nil {
+		return fmt.Errorf("Error marking %v as ready for review: %w", pr.HTMLURL, err)
+	}
+	return nil
+}
+
+// graphqlMutation runs the graphql mutation query with variables
+func graphqlMutation(ctx context.Context, query string, variables map[string]string, client *http.Client) error {
+	var resp struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	err := jsonRequest(ctx, client, "POST", "https://api.github.com/graphql", map[string]interface{}{
+		"query":     query,
+		"variables": variables,
+	}, &resp)
+	if err != nil {
+		return err
+	}
+	// the graphql api reports errors in a successful response
+	if len(resp.Errors) > 0 {
+		return fmt.Errorf("%v", resp.Errors[0].Message)
+	}
+	return nil
+}
+
+// staleBranchAge is how old a pull request mode branch must be before it is deleted without having been merged,
+// so that the branch of a run that is still in progress (eg. in another process) is never deleted from under it
+const staleBranchAge = 48 * time.Hour
+
+// pullRequestsPageSize is how many open pull requests are listed per request, the most that the api lists at once
+const pullRequestsPageSize = 100
+
+// cleanupPullRequestBranches deletes the pull request mode branches in the repository with the api url repoURL that are left over from previous runs:
+// the ones whose pull request was merged while waiting for auto-merge, and the ones from runs that failed before their pull request was merged,
+// leaving the ones that are the head of an open pull request, and the ones that are too new to tell, and returns how many were deleted
+func cleanupPullRequestBranches(ctx context.Context, repoURL string, now time.Time, client *http.Client) (int, error) {
+	var refs []struct {
+		Ref string `json:"ref"`
+	}
+	if err := jsonRequest(ctx, client, "GET", fmt.Sprintf("%v/git/matching-refs/heads/%v", repoURL, pullRequestBranchPrefix), nil, &refs); err != nil {
+		return 0, fmt.Errorf("Error listing %v branches: %w", pullRequestBranchPrefix, err)
+	}
+	if len(refs) == 0 {
+		return 0, nil
+	}
+
+	// every open pull request is listed, however many pages they take, since a branch that is the head of one that was left out would be deleted, closing it
+	waiting := map[string]bool{}
+	for page := 1; ; page++ {
+		var open []struct {
+			Head struct {
+				Ref string `json:"ref"`
+			} `json:"head"`
+		}
+		if err := jsonRequest(ctx, client, "GET", fmt.Sprintf("%v/pulls?state=open&per_page=%v&page=%v", repoURL, pullRequestsPageSize, page), nil, &open); err != nil {
+			return 0, fmt.Errorf("Error listing open pull requests: %w", err)
+		}
+		for _, pr := range open {
+			waiting[pr.Head.Ref] = true
+		}
+		if len(open) < pullRequestsPageSize {
+			break
+		}
+	}
+
+	deleted := 0
+	for _, ref := range refs {
+		branch := strings.TrimPrefix(ref.Ref, "refs/heads/")
+		if waiting[branch] {
+			continue
+		}
+		// the branch's name starts with the date it was made on, so a branch that is only a few hours old, but from yesterday, is still kept
+		name := strings.TrimPrefix(branch, pullRequestBranchPrefix)
+		if len(name) < len(dateLayout) {
+			continue
+		}
+		made, err := time.ParseInLocation(dateLayout, name[:len(dateLayout)], now.Location())
+		if err != nil || now.Sub(made) < staleBranchAge {
+			continue
+		}
+		if err := deleteBranch(ctx, repoURL, branch, client); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
@@ -0,0 +1,68 @@
+package commitcron
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anacanm/commitCron/repocontents"
+)
+
+// pruneGenerated deletes the files in sel.GeneratedDir that were modified least recently until there are no more than sel.MaxGenerated of them,
+// each with its own commit (so each is a contribution too), and returns how many were deleted
+// it does nothing unless sel.MaxGenerated is set, which requires sel.GeneratedDir to be, since only there can every file be trusted to have been created by this script
+func pruneGenerated(ctx context.Context, owner, repo string, sel Selection, opts commitOptions, client *http.Client) (int, error) {
+	if sel.MaxGenerated <= 0 || sel.GeneratedDir == "" {
+		return 0, nil
+	}
+	// the repository is listed again, rather than reusing the listing from before the run, so that the files that were just created are counted
+	generated, err := repoLister(ctx, sel, client).List(ctx, repocontents.Repo{Owner: owner, Name: repo, Ref: sel.Branch}, repocontents.Filter{
+		Allows: func(p string) bool {
+			return strings.HasPrefix(p, sel.GeneratedDir+"/") && !sel.protects(p)
+		},
+		Descends: func(dir string) bool {
+			return strings.HasPrefix(sel.GeneratedDir+"/", dir+"/") || strings.HasPrefix(dir, sel.GeneratedDir+"/")
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(generated) <= sel.MaxGenerated {
+		return 0, nil
+	}
+
+	modified := make(map[string]time.Time, len(generated))
+	for _, entry := range generated {
+		modified[entry.Path], err = lastModified(ctx, owner, repo, entry.Path, sel.Branch, client)
+		if err != nil {
+			return 0, err
+		}
+	}
+	sort.SliceStable(generated, func(i, j int) bool {
+		return modified[generated[i].Path].Before(modified[generated[j].Path])
+	})
+
+	contentsURL := fmt.Sprintf("https://api.github.com/repos/%v/%v/contents", owner, repo)
+	deleted := 0
+	for _, entry := range generated[:len(generated)-sel.MaxGenerated] {
+		body := map[string]interface{}{
+			"message": opts.Messages.finish(fmt.Sprintf("removing old generated file %v", entry.Path)),
+			"sha":     entry.SHA,
+		}
+		if sel.Branch != "" {
+			body["branch"] = sel.Branch
+		}
+		if opts.Author != nil {
+			body["author"] = opts.Author
+			body["committer"] = opts.Author
+		}
+		if err := jsonRequest(ctx, client, "DELETE", fmt.Sprintf("%v/%v", contentsURL, entry.Path), body, nil); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
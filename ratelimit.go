@@ -0,0 +1,36 @@
+package commitcron
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// rateLimitedTransport is an http.RoundTripper that spaces out requests so that no more than one is sent every interval
+// each account gets its own, so that one account's requests never slow down another's
+type rateLimitedTransport struct {
+	interval time.Duration
+	base     http.RoundTripper
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// RoundTrip waits for the request's turn, then sends it
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	now := time.Now()
+	if t.next.Before(now) {
+		t.next = now
+	}
+	wait := t.next.Sub(now)
+	t.next = t.next.Add(t.interval)
+	t.mu.Unlock()
+
+	select {
+	case <-time.After(wait):
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	return t.base.RoundTrip(req)
+}
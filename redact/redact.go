@@ -0,0 +1,92 @@
+// Package redact keeps secrets (tokens, client secrets, and the like) out of log output and error messages
+// every secret is registered with Secret as soon as it is obtained, from whichever source it came from, and anything written through a Writer
+// (which the standard logger is pointed at in main) or passed through String has every registered secret replaced
+package redact
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Placeholder is what secrets are replaced with
+const Placeholder = "[REDACTED]"
+
+// minSecretLength is the length below which values are not registered as secrets, since redacting very short values (eg. an empty string) would mangle unrelated output
+const minSecretLength = 6
+
+var (
+	mu      sync.RWMutex
+	secrets = make(map[string]struct{})
+	// ordered is every secret, longest first, which is the order they are replaced in, so that a secret that contains another (eg. a key and its trimmed form) is replaced whole, rather than leaving the part of it around the shorter one
+	ordered  []string
+	watchers []func(string)
+)
+
+// Secret registers s so that it is redacted from all output from now on
+func Secret(s string) {
+	if len(s) < minSecretLength {
+		return
+	}
+	mu.Lock()
+	_, known := secrets[s]
+	if !known {
+		secrets[s] = struct{}{}
+		i := sort.Search(len(ordered), func(i int) bool { return len(ordered[i]) < len(s) })
+		ordered = append(ordered, "")
+		copy(ordered[i+1:], ordered[i:])
+		ordered[i] = s
+	}
+	notify := watchers
+	mu.Unlock()
+	if !known {
+		for _, f := range notify {
+			f(s)
+		}
+	}
+}
+
+// OnSecret calls f with every secret that has been registered, and then with every new one as it is registered, eg. so that a ci system can be told to mask them too
+func OnSecret(f func(s string)) {
+	mu.Lock()
+	known := make([]string, 0, len(secrets))
+	for secret := range secrets {
+		known = append(known, secret)
+	}
+	watchers = append(watchers, f)
+	mu.Unlock()
+	for _, secret := range known {
+		f(secret)
+	}
+}
+
+// String returns s with every registered secret replaced by Placeholder
+func String(s string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, secret := range ordered {
+		s = strings.Replace(s, secret, Placeholder, -1)
+	}
+	return s
+}
+
+// Writer is an io.Writer that redacts every registered secret from what is written before passing it on to W
+// a secret split across two calls to Write is not redacted, which is fine for the log package, since it writes each message in a single call
+type Writer struct {
+	W io.Writer
+}
+
+// NewWriter returns a Writer that writes to w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{W: w}
+}
+
+// Write redacts p and writes it to the underlying writer
+// the length of p is returned on success, rather than the length of what was actually written, since callers only care that all of p was consumed
+func (w *Writer) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.W, String(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,31 @@
+package redact
+
+import "testing"
+
+func TestStringReplacesLongestFirst(t *testing.T) {
+	// a secret that contains another is registered both before and after it, since the order of registration must not matter
+	Secret("short-secret")
+	Secret("prefix-short-secret-suffix")
+	Secret("another-secret")
+	Secret("another-secret-that-is-longer")
+
+	for in, want := range map[string]string{
+		"token prefix-short-secret-suffix leaked":  "token " + Placeholder + " leaked",
+		"token short-secret leaked":                "token " + Placeholder + " leaked",
+		"key another-secret-that-is-longer leaked": "key " + Placeholder + " leaked",
+		"key another-secret leaked":                "key " + Placeholder + " leaked",
+		"nothing secret":                           "nothing secret",
+	} {
+		if got := String(in); got != want {
+			t.Errorf("String(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSecretIgnoresShortValues(t *testing.T) {
+	Secret("")
+	Secret("abc")
+	if got := String("abc"); got != "abc" {
+		t.Errorf("String(%q) = %q, want a value shorter than %v characters left as it is", "abc", got, minSecretLength)
+	}
+}
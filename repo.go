@@ -0,0 +1,132 @@
+package commitcron
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// RepoContent holds the necessary information about a content (directory or file) of a repository
+type RepoContent struct {
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	SHA     string `json:"sha"`
+	Type    string `json:"type"`
+	Size    int64  `json:"size"`
+	Error   error  `json:",omitempty"`
+	Message string `json:"message"`
+	// Mode is the file's git mode (eg. 100755 for executables)
+	Mode string `json:"-"`
+	// Content is the file's current content, which is only fetched once the file has been chosen (and is nil for files that will be created)
+	Content []byte `json:"-"`
+	// pkg is the package that a go file that will be created is declared in, that of the go files already in its directory, or "" if there are none (see addNewFiles)
+	pkg string
+}
+
+// maxContentsResponseBytes is the ceiling on how much of a single json response from the api will be read,
+// preventing a misbehaving proxy or an unexpectedly huge response from ballooning memory
+const maxContentsResponseBytes = 10 << 20
+
+// errorResponse holds the necessary response from the GitHub API when an error message is sent
+type errorResponse struct {
+	Message string `json:"message"`
+}
+
+// maxRawFileBytes is the largest file that can be read or written through the contents api at all, which is only possible using the raw media type:
+// for files larger than 1 MB, the contents api omits the inline content that it would otherwise return, and it refuses files larger than 100 MB entirely
+const maxRawFileBytes = 100 << 20
+
+// getRawFile returns the raw contents of the file at the slash separated path p in the repository whose root directory has the contents url contentsURL,
+// on the branch ref, or the default branch if ref is ""
+// returns false if there is no such file (including when the repository is empty)
+// at most limit+1 bytes are read, so a returned file that is longer than limit was larger than limit, and has been cut short
+func getRawFile(ctx context.Context, contentsURL string, p string, ref string, limit int64, client *http.Client) ([]byte, bool, error) {
+	url := withRef(fmt.Sprintf("%v/%v", contentsURL, p), ref)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("Error creating http GET request for %v: %w", url, err)
+	}
+	// the raw media type returns the file's contents as they are, instead of base64 encoded inside json
+	req.Header.Set("Accept", "application/vnd.github.raw")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, false, fmt.Errorf("Error sending http GET request for %v: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, &APIError{Method: "GET", URL: url, Status: resp.Status, StatusCode: resp.StatusCode}
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, false, fmt.Errorf("Error reading response from %v: %w", url, err)
+	}
+	return data, true, nil
+}
+
+// commitResponse holds the necessary data from a single commit in the response of the commits api
+type commitResponse struct {
+	Commit struct {
+		Committer struct {
+			Date time.Time `json:"date"`
+		} `json:"committer"`
+	} `json:"commit"`
+}
+
+// lastModified returns when the file at the slash separated path p in the repository was last committed to, on the branch ref, or the default branch if ref is "",
+// returns the zero time if no commit has touched p (eg. it is brand new, or the repository is empty)
+func lastModified(ctx context.Context, owner, repo string, p string, ref string, client *http.Client) (time.Time, error) {
+	u := fmt.Sprintf("https://api.github.com/repos/%v/%v/commits?path=%v&per_page=1", owner, repo, url.QueryEscape(p))
+	if ref != "" {
+		u += "&sha=" + url.QueryEscape(ref)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Error creating http GET request for %v: %w", u, err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Error sending http GET request for %v: %w", u, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusConflict:
+		// an empty repository has no commits
+		return time.Time{}, nil
+	default:
+		return time.Time{}, &APIError{Method: "GET", URL: u, Status: resp.Status, StatusCode: resp.StatusCode}
+	}
+
+	var commits []commitResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxContentsResponseBytes)).Decode(&commits); err != nil {
+		return time.Time{}, fmt.Errorf("Error decoding json response from %v: %w", u, err)
+	}
+	if len(commits) == 0 {
+		return time.Time{}, nil
+	}
+	return commits[0].Commit.Committer.Date, nil
+}
+
+// withRef returns the contents api url u, of a file or directory, referring to it on the branch ref instead of the default branch, if ref is not ""
+func withRef(u string, ref string) string {
+	if ref == "" {
+		return u
+	}
+	if strings.Contains(u, "?") {
+		return u + "&ref=" + url.QueryEscape(ref)
+	}
+	return u + "?ref=" + url.QueryEscape(ref)
+}
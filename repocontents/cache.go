@@ -0,0 +1,67 @@
+package repocontents
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// listingCache is the listing of a repository's files that is persisted between runs, so that the repository only needs to be listed again once its head changes
+// it is the full tree rather than only the files that a Filter allows, so that a different Filter takes effect immediately
+type listingCache struct {
+	// HeadSHA is the sha of the head commit that Tree was listed at
+	HeadSHA string `json:"head_sha"`
+	// ETag is the ETag of the response that HeadSHA was read from, which makes the next check for a new head a conditional request
+	ETag string      `json:"etag"`
+	Tree []treeEntry `json:"tree"`
+}
+
+// DefaultCacheDir returns the directory in the user's cache directory that commitcron caches its listings in (eg. ~/.cache/commitcron/listings)
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("Error finding user cache directory: %w", err)
+	}
+	return filepath.Join(dir, "commitcron", "listings"), nil
+}
+
+// cachePath returns the path of the file that the listing of repo is cached in
+func (l *Lister) cachePath(repo Repo) string {
+	return filepath.Join(l.CacheDir, repo.Owner, repo.Name+".json")
+}
+
+// loadCache returns the cached listing of repo, or an empty listingCache if there is none (or it can't be read)
+// the returned bool is false if the Lister has no CacheDir, in which case nothing should be saved either
+func (l *Lister) loadCache(repo Repo) (listingCache, bool) {
+	var cached listingCache
+	if l.CacheDir == "" {
+		return cached, false
+	}
+	data, err := ioutil.ReadFile(l.cachePath(repo))
+	if err != nil {
+		return cached, true
+	}
+	// a cache that can't be decoded is treated the same as no cache at all, it is overwritten once the repository has been listed
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return listingCache{}, true
+	}
+	return cached, true
+}
+
+// saveCache persists the listing of repo for the next List
+func (l *Lister) saveCache(repo Repo, cached listingCache) error {
+	path := l.cachePath(repo)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("Error creating %v: %w", filepath.Dir(path), err)
+	}
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return fmt.Errorf("Error encoding listing cache: %w", err)
+	}
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("Error writing listing cache to %v: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,319 @@
+// Package repocontents lists the files in a github repository, see List, with a single request to the git trees api when it can,
+// and one directory at a time when the repository is too large to be listed at once, returning only the files (and descending into only the directories) that a Filter allows
+// it is what commitcron selects the files it modifies from, but it knows nothing about commitcron, so any program can use it to list a repository
+package repocontents
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// apiURL is the url of the github api, which every request is made to, a client that needs them sent elsewhere (eg. to a github enterprise server) can rewrite them in its transport
+const apiURL = "https://api.github.com"
+
+// maxResponseBytes is the ceiling on how much of a single response from the git trees api will be read
+// a recursive tree lists at most 100,000 entries, each of which is well under a hundred bytes, so this leaves plenty of headroom while
+// still preventing a misbehaving proxy or an unexpectedly huge listing from ballooning memory
+const maxResponseBytes = 10 << 20
+
+// Repo is a repository, at a ref
+type Repo struct {
+	Owner string
+	Name  string
+	// Ref is the branch, tag or commit sha that the repository is listed at, or "" for its default branch
+	Ref string
+}
+
+// String returns the repository as owner/name
+func (r Repo) String() string {
+	return r.Owner + "/" + r.Name
+}
+
+// File is a single file in a repository
+type File struct {
+	// Path is the file's slash separated path from the root of the repository
+	Path string `json:"path"`
+	// Name is the last element of Path
+	Name string `json:"name"`
+	// SHA is the sha of the file's blob
+	SHA string `json:"sha"`
+	// Size is the file's size in bytes
+	Size int64 `json:"size"`
+	// Mode is the file's git mode (eg. 100644, or 100755 for executables)
+	Mode string `json:"mode"`
+}
+
+// Filter decides which files List returns, and which directories it descends into when it has to list the repository one directory at a time
+// its zero value allows every file, and descends into every directory
+type Filter struct {
+	// Allows, if it is not nil, reports whether the file at the slash separated path p is returned
+	Allows func(p string) bool
+	// Descends, if it is not nil, reports whether the directory at the slash separated path dir is listed, it is only consulted when the repository is listed one directory at a time,
+	// so it can only save requests, it does not exclude any files on its own (Allows has to do that)
+	Descends func(dir string) bool
+	// MaxSize, if it is positive, is the size in bytes of the largest file that is returned
+	MaxSize int64
+	// Limit, if it is positive, is how many files are enough when the repository has to be listed one directory at a time, once that many have been found, no more directories are listed
+	// directories are listed breadth first, so the files closest to the root are found first
+	Limit int
+}
+
+// allows reports whether f passes the filter
+func (f Filter) allows(file File) bool {
+	if f.MaxSize > 0 && file.Size > f.MaxSize {
+		return false
+	}
+	return f.Allows == nil || f.Allows(file.Path)
+}
+
+// descends reports whether the filter allows the directory dir to be listed
+func (f Filter) descends(dir string) bool {
+	return f.Descends == nil || f.Descends(dir)
+}
+
+// full reports whether files are enough for the filter's Limit
+func (f Filter) full(files []File) bool {
+	return f.Limit > 0 && len(files) >= f.Limit
+}
+
+// Lister lists repositories with the github api
+type Lister struct {
+	// Client sends every request, it must authorize them (eg. with auth.Transport) to list private repositories
+	Client *http.Client
+	// CacheDir, if it is not "", is the directory that the listings are cached in between runs (see DefaultCacheDir), keyed by each repository's head commit,
+	// so that a repository that has not changed since it was last listed is checked with a single conditional request, which github does not count against the rate limit
+	CacheDir string
+	// Logger is what the few problems that do not stop a listing are logged to, if it is nil, slog.Default is used
+	Logger *slog.Logger
+}
+
+// NewLister returns a Lister that sends its requests with client, and caches nothing
+func NewLister(client *http.Client) *Lister {
+	return &Lister{Client: client}
+}
+
+// List returns the files in repo that filter allows, with http.DefaultClient and no cache, so it only lists public repositories, see Lister.List
+func List(ctx context.Context, repo Repo, filter Filter) ([]File, error) {
+	return NewLister(http.DefaultClient).List(ctx, repo, filter)
+}
+
+// List returns the files in repo that filter allows, in the order that github lists them
+// the repository is listed with a single request to the git trees api, unless it is too large for github to list at once, in which case it is listed one directory at a time,
+// breadth first, until filter's Limit is reached, so the files returned are then only those closest to the root
+// an empty repository has no files, and is not an error
+// if ctx is cancelled, any request in flight is aborted and its error is returned
+func (l *Lister) List(ctx context.Context, repo Repo, filter Filter) ([]File, error) {
+	cached, useCache := l.loadCache(repo)
+	head, etag, notModified, err := l.getHead(ctx, repo, cached.ETag)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []treeEntry
+	switch {
+	case notModified || (useCache && cached.HeadSHA != "" && head == cached.HeadSHA):
+		entries = cached.Tree
+	case head == "":
+		return nil, nil
+	default:
+		tree, err := l.getTree(ctx, repo, head, true)
+		if err != nil {
+			return nil, err
+		}
+		if tree.Truncated {
+			return l.traverse(ctx, repo, head, filter)
+		}
+		entries = tree.Tree
+		if useCache {
+			if err := l.saveCache(repo, listingCache{HeadSHA: head, ETag: etag, Tree: entries}); err != nil {
+				l.logger().Warn("Error caching the listing", "repo", repo.String(), "err", err)
+			}
+		}
+	}
+
+	var files []File
+	for _, entry := range entries {
+		// the trees api calls files blobs, and directories trees
+		if entry.Type != "blob" {
+			continue
+		}
+		if file := entry.file(""); filter.allows(file) {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// traverse lists the files in repo that filter allows one directory at a time, starting from the tree of the commit head, until filter's Limit is reached
+// subdirectories are only listed once every directory above them has been, so files closer to the root are found first
+func (l *Lister) traverse(ctx context.Context, repo Repo, head string, filter Filter) ([]File, error) {
+	var files []File
+	worklist := []directory{{sha: head}}
+	for len(worklist) > 0 && !filter.full(files) {
+		dir := worklist[0]
+		worklist = worklist[1:]
+
+		tree, err := l.getTree(ctx, repo, dir.sha, false)
+		if err != nil {
+			return nil, err
+		}
+		if tree.Truncated {
+			// there is no way to list a directory this large through the api, so whatever was listed will have to do
+			l.logger().Warn("A directory has too many entries to be listed, only some of them are considered", "repo", repo.String(), "dir", dir.path)
+		}
+		for _, entry := range tree.Tree {
+			if filter.full(files) {
+				break
+			}
+			if file := entry.file(dir.path); entry.Type == "blob" && filter.allows(file) {
+				files = append(files, file)
+			}
+		}
+		for _, entry := range tree.Tree {
+			if p := path.Join(dir.path, entry.Path); entry.Type == "tree" && filter.descends(p) {
+				worklist = append(worklist, directory{path: p, sha: entry.SHA})
+			}
+		}
+	}
+	return files, nil
+}
+
+// directory is a directory in the worklist of traverse
+type directory struct {
+	// path is the directory's slash separated path, which is "" for the root directory
+	path string
+	// sha is the sha of the directory's tree
+	sha string
+}
+
+// treeEntry is a single file or directory in the response of the git trees api
+type treeEntry struct {
+	Path string `json:"path"`
+	Type string `json:"type"`
+	SHA  string `json:"sha"`
+	Size int64  `json:"size"`
+	Mode string `json:"mode"`
+}
+
+// file returns the entry as a File, entries in a non-recursive tree are named relative to it, so dir is the path of the directory that the tree is of
+func (e treeEntry) file(dir string) File {
+	p := path.Join(dir, e.Path)
+	return File{Path: p, Name: path.Base(p), SHA: e.SHA, Size: e.Size, Mode: e.Mode}
+}
+
+// treeResponse holds the necessary data from the response of the git trees api
+type treeResponse struct {
+	SHA       string      `json:"sha"`
+	Tree      []treeEntry `json:"tree"`
+	Truncated bool        `json:"truncated"`
+	Message   string      `json:"message"`
+}
+
+// getHead returns the sha of repo's head commit (or that of its Ref, if it is not ""), or "" if the repository is empty
+// if etag is the ETag of an earlier response, the request is conditional: if the head has not changed since, notModified is true and no sha is returned,
+// and since github does not count conditional requests that are answered with 304 Not Modified against the rate limit, checking an unchanged repository is free
+func (l *Lister) getHead(ctx context.Context, repo Repo, etag string) (sha string, newETag string, notModified bool, err error) {
+	ref := repo.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	u := fmt.Sprintf("%v/repos/%v/%v/commits/%v", apiURL, repo.Owner, repo.Name, ref)
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return "", "", false, fmt.Errorf("Error creating http GET request for %v: %w", u, err)
+	}
+	// the sha media type returns only the commit's sha, instead of the whole commit
+	req.Header.Set("Accept", "application/vnd.github.sha")
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := l.client().Do(req)
+	if err != nil {
+		return "", "", false, fmt.Errorf("Error sending http GET request for %v: %w", u, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return "", etag, true, nil
+	case http.StatusOK:
+	case http.StatusConflict:
+		// an empty repository has no commits
+		return "", "", false, nil
+	default:
+		return "", "", false, &APIError{Method: "GET", URL: u, Status: resp.Status, StatusCode: resp.StatusCode}
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<10))
+	if err != nil {
+		return "", "", false, fmt.Errorf("Error reading response from %v: %w", u, err)
+	}
+	return strings.TrimSpace(string(data)), resp.Header.Get("ETag"), false, nil
+}
+
+// getTree returns the tree with the sha (or of the commit with the sha) in repo, with every entry below it if recursive is set, or only those directly in it otherwise
+func (l *Lister) getTree(ctx context.Context, repo Repo, sha string, recursive bool) (treeResponse, error) {
+	var tree treeResponse
+	u := fmt.Sprintf("%v/repos/%v/%v/git/trees/%v", apiURL, repo.Owner, repo.Name, sha)
+	if recursive {
+		u += "?recursive=1"
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return tree, fmt.Errorf("Error creating http GET request for %v: %w", u, err)
+	}
+
+	resp, err := l.client().Do(req)
+	if err != nil {
+		return tree, fmt.Errorf("Error sending http GET request for %v: %w", u, err)
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(&tree); err != nil {
+		return tree, fmt.Errorf("Error decoding json response from %v: %w", u, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return tree, &APIError{Method: "GET", URL: u, Status: resp.Status, StatusCode: resp.StatusCode, Message: tree.Message}
+	}
+	return tree, nil
+}
+
+// client returns the Lister's Client, or http.DefaultClient if it has none
+func (l *Lister) client() *http.Client {
+	if l.Client != nil {
+		return l.Client
+	}
+	return http.DefaultClient
+}
+
+// logger returns the Lister's Logger, or the default slog logger if it has none
+func (l *Lister) logger() *slog.Logger {
+	if l.Logger != nil {
+		return l.Logger
+	}
+	return slog.Default()
+}
+
+// APIError is an unsuccessful response from the github api, with the message that came with it, if any
+// it is returned (wrapped or not) for every such response, so the status can be checked with errors.As
+type APIError struct {
+	Method     string
+	URL        string
+	Status     string
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("Error from %v %v: %v", e.Method, e.URL, e.Status)
+	}
+	return fmt.Sprintf("Error from %v %v: %v: %v", e.Method, e.URL, e.Status, e.Message)
+}
@@ -0,0 +1,232 @@
+package commitcron
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Report is the outcome of Run (or Planner.Execute), for each of the accounts it was run for
+// it is what the commitcron command prints once it has run (see Report.String), or with --json, the json encoding of
+type Report struct {
+	// Started is when the run started, and Duration how long it took
+	Started  time.Time       `json:"started"`
+	Duration time.Duration   `json:"duration"`
+	Accounts []AccountReport `json:"accounts"`
+}
+
+// AccountReport is the outcome of running the pipeline for a single account, Err is why it failed, if it did
+type AccountReport struct {
+	Username string `json:"username"`
+	// ContributionsBefore is how many contributions the account had made today when they were counted, before any were made, or -1 if they never were (eg. none were planned)
+	// ContributionsAfter is ContributionsBefore with the contributions that were made added, it is not counted again, since github's events take a while to show new contributions
+	ContributionsBefore int           `json:"contributions_before"`
+	ContributionsAfter  int           `json:"contributions_after"`
+	Repos               []RepoReport  `json:"repos"`
+	Duration            time.Duration `json:"duration"`
+	Err                 error         `json:"-"`
+}
+
+// RepoReport is the outcome of running the pipeline for a single one of an account's repositories
+type RepoReport struct {
+	Repo string `json:"repo"`
+	// Planned is the number of contributions that were to be made to Repo, and Made is how many were made
+	Planned int `json:"planned"`
+	Made    int `json:"made"`
+	// Created, Updated and Deleted are the paths of the files that were created, updated and deleted, and Commits the shas of the commits that were made, in the order they were made
+	Created []string `json:"created,omitempty"`
+	Updated []string `json:"updated,omitempty"`
+	Deleted []string `json:"deleted,omitempty"`
+	Commits []string `json:"commits,omitempty"`
+	// Steps are how long each step of the run took, in the order they were taken, eg. plan and execute
+	Steps []StepReport `json:"steps,omitempty"`
+	// Warnings are what the run warned about, without failing, that someone should act on, eg. that the token expires soon
+	Warnings []string `json:"warnings,omitempty"`
+	Err      error    `json:"-"`
+}
+
+// StepReport is how long a single step of a run took
+type StepReport struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration"`
+}
+
+// MarshalJSON encodes the account's report with its error, if it has one, as a string, since errors have no json encoding of their own
+// durations are encoded in nanoseconds, as time.Duration is
+func (r AccountReport) MarshalJSON() ([]byte, error) {
+	// accountReport has AccountReport's fields, but not this method, which encoding it would otherwise recurse into
+	type accountReport AccountReport
+	return json.Marshal(struct {
+		accountReport
+		Error string `json:"error,omitempty"`
+	}{accountReport(r), errorString(r.Err)})
+}
+
+// MarshalJSON encodes the repository's report with its error, if it has one, as a string, as AccountReport.MarshalJSON does
+func (r RepoReport) MarshalJSON() ([]byte, error) {
+	type repoReport RepoReport
+	return json.Marshal(struct {
+		repoReport
+		Error string `json:"error,omitempty"`
+	}{repoReport(r), errorString(r.Err)})
+}
+
+// errorString returns err's message, or "" if it is nil
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// String renders the report for people to read, an account per paragraph, with a line for each of its repositories, and what was made there
+func (r *Report) String() string {
+	var b strings.Builder
+	for i, account := range r.Accounts {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%v (%v): ", account.Username, account.Duration.Round(time.Millisecond))
+		if account.ContributionsBefore >= 0 {
+			fmt.Fprintf(&b, "%v contributions today, %v after this run\n", account.ContributionsBefore, account.ContributionsAfter)
+		} else {
+			b.WriteString("contributions were not counted\n")
+		}
+		for _, repo := range account.Repos {
+			fmt.Fprintf(&b, "  %v: made %v of %v contributions", repo.Repo, repo.Made, repo.Planned)
+			var steps []string
+			for _, step := range repo.Steps {
+				steps = append(steps, fmt.Sprintf("%v %v", step.Name, step.Duration.Round(time.Millisecond)))
+			}
+			if len(steps) > 0 {
+				fmt.Fprintf(&b, " (%v)", strings.Join(steps, ", "))
+			}
+			b.WriteString("\n")
+			for _, files := range []struct {
+				verb  string
+				paths []string
+			}{{"created", repo.Created}, {"updated", repo.Updated}, {"deleted", repo.Deleted}} {
+				if len(files.paths) > 0 {
+					fmt.Fprintf(&b, "    %v %v\n", files.verb, strings.Join(files.paths, ", "))
+				}
+			}
+			if len(repo.Commits) > 0 {
+				fmt.Fprintf(&b, "    commits %v\n", strings.Join(repo.Commits, ", "))
+			}
+			for _, warning := range repo.Warnings {
+				fmt.Fprintf(&b, "    warning: %v\n", warning)
+			}
+			if repo.Err != nil {
+				fmt.Fprintf(&b, "    failed: %v\n", repo.Err)
+			}
+		}
+		// an account that failed before any of its repositories were run has only its own error
+		if account.Err != nil && len(account.Repos) == 0 {
+			fmt.Fprintf(&b, "  failed: %v\n", account.Err)
+		}
+	}
+	fmt.Fprintf(&b, "finished in %v\n", r.Duration.Round(time.Millisecond))
+	return b.String()
+}
+
+// repoRecorder records what a run of the pipeline for a single repository does in its RepoReport, as it does it, see withRecorder
+// files may be uploaded concurrently, so the report is only changed while holding mu
+type repoRecorder struct {
+	mu sync.Mutex
+	// username is the account that the repository of report belongs to
+	username string
+	report   *RepoReport
+	// counted is whether the contributions made today were counted during the run, and today is how many there were
+	counted bool
+	today   int
+}
+
+// recorderKey is the key of the repoRecorder in a context
+type recorderKey struct{}
+
+// withRecorder returns a copy of ctx that carries a recorder of everything that is made with it into report, which is of username's repository
+// as with the Runner (see withRunner), the context reaches everywhere that anything is made already, so the report doesn't have to be passed alongside it
+func withRecorder(ctx context.Context, username string, report *RepoReport) (context.Context, *repoRecorder) {
+	rec := &repoRecorder{username: username, report: report}
+	return context.WithValue(ctx, recorderKey{}, rec), rec
+}
+
+// recorder returns the repoRecorder that ctx carries, or nil if it carries none, in which case nothing is recorded (eg. for UpdateFilesAndCreateRemaining)
+func recorder(ctx context.Context) *repoRecorder {
+	rec, _ := ctx.Value(recorderKey{}).(*repoRecorder)
+	return rec
+}
+
+// recordContributions records that the account had made today contributions today, before any were made
+func recordContributions(ctx context.Context, today int) {
+	if rec := recorder(ctx); rec != nil {
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		rec.counted, rec.today = true, today
+	}
+}
+
+// recordWarning records warning in the report, so that it reaches whatever the report is sent to (eg. HOOK_AFTER_RUN, or the annotations of a github action), not only the log
+// a warning that has already been recorded is not recorded again
+func recordWarning(ctx context.Context, warning string) {
+	if rec := recorder(ctx); rec != nil {
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		if !slices.Contains(rec.report.Warnings, warning) {
+			rec.report.Warnings = append(rec.report.Warnings, warning)
+		}
+	}
+}
+
+// recordFiles records that the changes in updates have been committed, a file that is changed more than once (eg. a journal) is only recorded the first time
+func recordFiles(ctx context.Context, updates ...fileUpdate) {
+	rec := recorder(ctx)
+	if rec == nil {
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	r := rec.report
+	for _, u := range updates {
+		if slices.Contains(r.Created, u.File.Path) || slices.Contains(r.Updated, u.File.Path) || slices.Contains(r.Deleted, u.File.Path) {
+			continue
+		}
+		switch {
+		case u.Delete:
+			r.Deleted = append(r.Deleted, u.File.Path)
+		case u.File.SHA == "":
+			r.Created = append(r.Created, u.File.Path)
+		default:
+			r.Updated = append(r.Updated, u.File.Path)
+		}
+	}
+}
+
+// recordCommits records the shas of commits that have been made, and are on the branch they were made for, and calls the OnCommitCreated hook with each of them
+func recordCommits(ctx context.Context, shas ...string) {
+	rec := recorder(ctx)
+	if rec == nil {
+		return
+	}
+	rec.mu.Lock()
+	rec.report.Commits = append(rec.report.Commits, shas...)
+	rec.mu.Unlock()
+	// the hook is called without holding mu, so that a slow hook doesn't hold up concurrent uploads any more than it has to
+	for _, sha := range shas {
+		commitCreated(ctx, Commit{Username: rec.username, Repo: rec.report.Repo, SHA: sha})
+	}
+}
+
+// recordStep records that the step name, which started at started, has finished
+// durations are measured with the system clock, rather than the Runner's (see WithClock), which decides what day it is, not how long anything takes
+func recordStep(ctx context.Context, name string, started time.Time) {
+	if rec := recorder(ctx); rec != nil {
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		rec.report.Steps = append(rec.report.Steps, StepReport{Name: name, Duration: time.Since(started)})
+	}
+}
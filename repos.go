@@ -0,0 +1,149 @@
+package commitcron
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// runAccount runs the full pipeline for each of the account's repositories, splitting numberOfContributionsToMake between them as REPO_SPLIT says,
+// the repositories are run concurrently, each with its own pipeline, and a failure for one does not stop the others
+// once all of them have finished, a combined report is logged, and returned with a report for each repository, along with an error if any of them failed, which wraps each of their errors
+func runAccount(ctx context.Context, env Settings, account Account, tokenClient *http.Client, numberOfContributionsToMake int, minContributions int) (AccountReport, error) {
+	started := time.Now()
+	report := AccountReport{Username: account.Username, ContributionsBefore: -1, ContributionsAfter: -1}
+	repos := account.repos()
+
+	// the client is shared between the pipelines, so that the account's rate limit applies to all of them together
+	// if it can't be created, the error is only reported by the pipelines that need it (PUSH_MODE=ssh can do without)
+	client, clientErr := account.newClient(runnerFrom(ctx), env, tokenClient)
+	if clientErr != nil {
+		clientErr = fmt.Errorf("Error configuring github credentials: %w", clientErr)
+	}
+
+	split, minContributions, err := accountSplit(ctx, env, account, client, clientErr, numberOfContributionsToMake, minContributions)
+	if err != nil {
+		report.Duration = time.Since(started)
+		return report, err
+	}
+
+	results := make([]RepoReport, len(repos))
+	recorders := make([]*repoRecorder, len(repos))
+	var wg sync.WaitGroup
+	for i, repo := range repos {
+		results[i] = RepoReport{Repo: repo, Planned: split[i]}
+		if split[i] == 0 {
+			continue
+		}
+		repoAccount := account
+		repoAccount.Repo = repo
+		var repoCtx context.Context
+		repoCtx, recorders[i] = withRecorder(ctx, account.Username, &results[i])
+		wg.Add(1)
+		go func(result *RepoReport) {
+			defer wg.Done()
+			defer recoverPanic(&result.Err)
+			result.Made, result.Err = run(repoCtx, env, repoAccount, client, clientErr, result.Planned, minContributions)
+		}(&results[i])
+	}
+	wg.Wait()
+	report.Repos = results
+
+	// every repository's pipeline counts the account's contributions for itself, at the same moment, so whichever was counted first stands for all of them
+	made := 0
+	for i, result := range results {
+		made += result.Made
+		if rec := recorders[i]; rec != nil && rec.counted && report.ContributionsBefore == -1 {
+			report.ContributionsBefore = rec.today
+		}
+	}
+	if report.ContributionsBefore != -1 {
+		report.ContributionsAfter = report.ContributionsBefore + made
+	}
+
+	// a run occasionally creates a micro repository too, but only if the account needed contributions today, and it is not a reason to fail the run if it can't
+	micro, err := loadMicroRepoOptions(env)
+	if err != nil {
+		report.Duration = time.Since(started)
+		return report, err
+	}
+	if made > 0 && clientErr == nil && rand.Float64() < micro.Chance {
+		if repo, err := createMicroRepo(ctx, account.Username, micro, currentTime(ctx), client); err != nil {
+			logger(ctx).Error("Error creating a micro repository", "account", account.Username, "err", err)
+		} else {
+			logger(ctx).Info("Created a micro repository", "account", account.Username, "repo", repo.Name)
+		}
+	}
+
+	var errs []error
+	for _, result := range results {
+		switch {
+		case result.Err != nil:
+			errs = append(errs, fmt.Errorf("%v: %w", result.Repo, result.Err))
+			logger(ctx).Error("Failed to make contributions", "account", account.Username, "repo", result.Repo, "planned", result.Planned, "err", result.Err)
+		case result.Planned == 0:
+			logger(ctx).Info("No contributions planned today", "account", account.Username, "repo", result.Repo)
+		case result.Made == 0:
+			logger(ctx).Info("No contributions needed, MIN_CONTRIBUTIONS has already been met today", "account", account.Username, "repo", result.Repo)
+		default:
+			logger(ctx).Info("Made contributions", "account", account.Username, "repo", result.Repo, "made", result.Made, "planned", result.Planned)
+		}
+	}
+	report.Duration = time.Since(started)
+	if len(errs) > 0 {
+		// the repositories' errors are joined, so that the caller can find any one of them with errors.Is or errors.As
+		return report, fmt.Errorf("%v of %v repositories failed: %w", len(errs), len(repos), errors.Join(errs...))
+	}
+	return report, nil
+}
+
+// accountSplit returns how many of numberOfContributionsToMake contributions are made to each of the account's repositories, as REPO_SPLIT says,
+// and the minContributions they are made with, which with a target level are however many today still needs to reach it, in place of NUMBER_CONTRIBUTIONS and MIN_CONTRIBUTIONS
+func accountSplit(ctx context.Context, env Settings, account Account, client *http.Client, clientErr error, numberOfContributionsToMake int, minContributions int) ([]int, int, error) {
+	level, err := loadTargetLevel(env)
+	if err != nil {
+		return nil, 0, err
+	}
+	if level > 0 {
+		if clientErr != nil {
+			return nil, 0, clientErr
+		}
+		numberOfContributionsToMake, err = contributionsToLevel(ctx, client, account.Username, level)
+		if err != nil {
+			return nil, 0, fmt.Errorf("Error estimating the contributions needed to reach level %v: %w", level, err)
+		}
+		minContributions = -1
+		logger(ctx).Info("More contributions are needed today to reach the target level", "account", account.Username, "needed", numberOfContributionsToMake, "level", level)
+	}
+	split, err := splitContributions(numberOfContributionsToMake, len(account.repos()), env.get("REPO_SPLIT"), currentTime(ctx))
+	return split, minContributions, err
+}
+
+// splitContributions splits n contributions between k repositories, mode is how:
+// "round-robin" (or "") splits them as evenly as possible, with the repositories that get one extra rotating from day to day,
+// "random" gives each contribution to a repository chosen at random, and "pick-one" gives all of them to a single repository chosen at random,
+// so that the history is not concentrated in one repository over time, while each day's contributions still look like a day's work on one project
+func splitContributions(n, k int, mode string, now time.Time) ([]int, error) {
+	split := make([]int, k)
+	switch mode {
+	case "", "round-robin":
+		// the day of the year decides which repository the rotation starts from, so that the extra contributions are not always made to the first repositories
+		start := now.YearDay()
+		for i := 0; i < n; i++ {
+			split[(start+i)%k]++
+		}
+	case "random":
+		for i := 0; i < n; i++ {
+			split[rand.Intn(k)]++
+		}
+	case "pick-one":
+		split[rand.Intn(k)] = n
+	default:
+		return nil, fmt.Errorf("Error parsing REPO_SPLIT: must be round-robin, random or pick-one, got %q", mode)
+	}
+	return split, nil
+}
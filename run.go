@@ -0,0 +1,192 @@
+// Package commitcron makes contributions to github repositories, so that they show on the accounts' contribution graphs: Run runs the whole pipeline for every account in a Config,
+// which ConfigFromEnv reads from the environment, as the commitcron command does
+// Run, Config, Report, the Runner and its options, the Planner and APIError are stable from v1 on, api_test.go lists what that covers, and checks it whenever the tests are built
+package commitcron
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Config is what Run makes contributions with
+type Config struct {
+	// Accounts are the accounts that contributions are made for, each in turn, to each of their repositories
+	Accounts []Account
+	// NumberOfContributions is how many contributions are made for each account, split between its repositories
+	NumberOfContributions int
+	// MinContributions is how many contributions an account must already have made today for none to be made, -1 makes them regardless
+	MinContributions int
+	// TokenClient is only used to obtain tokens (eg. refreshing an oauth token), it is kept separate from each account's client so that obtaining a token never tries to authorize itself
+	// if it is nil, a client with the default timeout is used
+	TokenClient *http.Client
+	// Settings are everything else that the pipeline is configured with, including the credentials of accounts that have no Token or TokenFile of their own
+	Settings Settings
+	// Logger is what everything is logged with, if it is nil, the default slog logger is used (see slog.Default), and a Runner's logger takes precedence over it (see WithLogger)
+	Logger *slog.Logger
+}
+
+// ConfigFromEnv reads the Config from the environment, see ConfigFromSettings and SettingsFromEnv
+func ConfigFromEnv() (Config, error) {
+	return ConfigFromSettings(SettingsFromEnv())
+}
+
+// ConfigFromSettings reads the Config from env: the accounts (see ACCOUNTS_FILE), NUMBER_CONTRIBUTIONS, which if it is not set is a number from 3 to 7 chosen at random,
+// and MIN_CONTRIBUTIONS, which if it is not set makes contributions regardless, and keeps env as the Config's Settings
+func ConfigFromSettings(env Settings) (Config, error) {
+	cfg := Config{MinContributions: -1, Settings: env}
+	if n, present := env.lookup("NUMBER_CONTRIBUTIONS"); present {
+		var err error
+		cfg.NumberOfContributions, err = strconv.Atoi(n)
+		if err != nil {
+			return cfg, fmt.Errorf("Error parsing NUMBER_CONTRIBUTIONS: %w", err)
+		}
+	} else {
+		cfg.NumberOfContributions = rand.Intn(5) + 3
+	}
+	if m, present := env.lookup("MIN_CONTRIBUTIONS"); present {
+		var err error
+		cfg.MinContributions, err = strconv.Atoi(m)
+		if err != nil {
+			return cfg, fmt.Errorf("Error parsing MIN_CONTRIBUTIONS: %w", err)
+		}
+	}
+	var err error
+	cfg.Accounts, err = loadAccounts(env)
+	if err != nil {
+		return cfg, fmt.Errorf("Error loading accounts: %w", err)
+	}
+	return cfg, nil
+}
+
+// Run runs the full pipeline for each of cfg's accounts in turn, and a failure for one account does not stop the others from being run
+// the report covers every account, and an error is returned as well if any of them failed, which wraps the error of each of them (eg. an APIError), for errors.Is and errors.As to find
+// to run it with other than the default http client, api, logger or clock, see New
+func Run(ctx context.Context, cfg Config) (*Report, error) {
+	return runAll(ctx, cfg)
+}
+
+// runAll is Run, with the options of the Runner that ctx carries, if it carries one
+func runAll(ctx context.Context, cfg Config) (*Report, error) {
+	ctx = withConfig(ctx, cfg)
+	tokenClient := cfg.TokenClient
+	if tokenClient == nil {
+		tokenClient = runnerFrom(ctx).tokenClient()
+	}
+	report := &Report{Started: currentTime(ctx)}
+	if err := runStarted(ctx); err != nil {
+		return report, err
+	}
+	started := time.Now()
+	var errs []error
+	for _, account := range cfg.Accounts {
+		accountReport, err := runAccount(ctx, cfg.Settings, account, tokenClient, cfg.NumberOfContributions, cfg.MinContributions)
+		if err != nil {
+			logger(ctx).Error("Error making contributions", "account", account.Username, "err", err)
+			errs = append(errs, fmt.Errorf("%v: %w", account.Username, err))
+		}
+		accountReport.Err = err
+		report.Accounts = append(report.Accounts, accountReport)
+	}
+	report.Duration = time.Since(started)
+	runFinished(ctx, report)
+	if len(errs) > 0 {
+		return report, fmt.Errorf("%v of %v accounts failed: %w", len(errs), len(cfg.Accounts), errors.Join(errs...))
+	}
+	return report, nil
+}
+
+// loadEngine reads ENGINE, which is how contributions are made: api (the default) through the github api, or git by cloning the repository and pushing commits to it
+func loadEngine(env Settings) (string, error) {
+	switch e := env.get("ENGINE"); e {
+	case "", "api":
+		return "api", nil
+	case "git":
+		return e, nil
+	default:
+		return "", fmt.Errorf("Error parsing ENGINE: must be api or git, got %q", e)
+	}
+}
+
+// run runs the full pipeline for a single account and repository: it counts the contributions that the account has made today, and if there are fewer than minContributions
+// (or minContributions is -1), makes numberOfContributionsToMake contributions to the account's repository, returning the number made
+// client is the account's client, and clientErr the error from creating it, if it could not be
+// through the api, the contributions are planned first (see planRepo), and then the plan is executed (see executePlan), exactly as a reviewed plan would be
+func run(ctx context.Context, env Settings, account Account, client *http.Client, clientErr error, numberOfContributionsToMake int, minContributions int) (int, error) {
+	if env.get("PUSH_MODE") == "ssh" {
+		return runDeployKey(ctx, env, account, client, numberOfContributionsToMake, minContributions)
+	}
+	engine, err := loadEngine(env)
+	if err != nil {
+		return 0, err
+	}
+	if engine == "git" {
+		return runGitEngine(ctx, env, account, client, clientErr, numberOfContributionsToMake, minContributions)
+	}
+
+	// every request sent with client is authorized with whatever token the account's credentials currently supply
+	if clientErr != nil {
+		return 0, clientErr
+	}
+	// each step's duration is recorded in the repository's report, whether or not it succeeds
+	started := time.Now()
+	plan, err := planRepo(ctx, env, account, client, numberOfContributionsToMake, minContributions)
+	recordStep(ctx, "plan", started)
+	if err != nil {
+		return 0, err
+	}
+	if len(plan.Changes) == 0 {
+		return 0, nil
+	}
+	if err := planReady(ctx, plan); err != nil {
+		return 0, err
+	}
+	started = time.Now()
+	made, err := executePlan(ctx, env, account, client, plan)
+	recordStep(ctx, "execute", started)
+	return made, err
+}
+
+// AskpassEnv is set when this binary is run by ssh as its SSH_ASKPASS program, in which case it only prints the deploy key's passphrase
+const AskpassEnv = "COMMITCRON_ASKPASS"
+
+// runDeployKey is run in place of run when PUSH_MODE is ssh, it counts contributions the same way, but makes them by pushing with a deploy key
+// a token is still used to count contributions if one is configured (ie. client is not nil), but since the point of this mode is to avoid granting a token write access,
+// none is required: without one, only contributions that are visible publicly are counted
+func runDeployKey(ctx context.Context, env Settings, account Account, client *http.Client, numberOfContributionsToMake int, minContributions int) (int, error) {
+	if client == nil {
+		client = &http.Client{Timeout: time.Second * 7}
+	}
+
+	started := time.Now()
+	counter, err := contributionsService(ctx, env, client)
+	if err != nil {
+		return 0, err
+	}
+	today, err := counter.Count(ctx, account.Username)
+	recordStep(ctx, "count", started)
+	if err != nil {
+		return 0, fmt.Errorf("Error getting contributions: %w", err)
+	}
+	recordContributions(ctx, today)
+
+	if today < minContributions || minContributions == -1 {
+		sel, err := loadSelection(env)
+		if err != nil {
+			return 0, err
+		}
+		started = time.Now()
+		err = deployKeyPush(ctx, env, account, numberOfContributionsToMake, sel)
+		recordStep(ctx, "push", started)
+		if err != nil {
+			return 0, err
+		}
+		return numberOfContributionsToMake, nil
+	}
+	return 0, nil
+}
@@ -0,0 +1,252 @@
+package commitcron
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/anacanm/commitCron/contributions"
+)
+
+// defaultCountCacheTTL is how long the contributions counted during a run are cached for, unless the Runner has a cache of its own (see WithContributionsCache)
+// a run counts each account's contributions as it starts on each of its repositories, at nearly the same moment, so this only needs to outlast the run's start
+const defaultCountCacheTTL = 5 * time.Minute
+
+// githubAPIHost is the host of the github api, which every request to the api is made to, unless a Runner sends them elsewhere (see WithBaseURL)
+const githubAPIHost = "api.github.com"
+
+// Runner runs the pipeline (see Runner.Run) and plans it (see Runner.Planner) with the http client, github api, logger, clock and rate limit that it is constructed with,
+// instead of the defaults, eg. so that a program embedding it can point it at a github enterprise server, or a test at a fake api with a fixed clock
+type Runner struct {
+	httpClient        *http.Client
+	baseURL           *url.URL
+	logger            *slog.Logger
+	clock             func() time.Time
+	requestsPerSecond float64
+	counts            *contributions.Cache
+	hooks             Hooks
+}
+
+// Option configures a Runner, see New
+type Option func(*Runner) error
+
+// New returns a Runner configured by opts, anything that no option configures is the same as for Run
+func New(opts ...Option) (*Runner, error) {
+	r := &Runner{}
+	for _, opt := range opts {
+		if err := opt(r); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// WithHTTPClient sends every request with client's transport and timeout, including those made to obtain tokens (unless Config.TokenClient is set),
+// each account's client still authorizes its requests with the account's credentials on top of it
+func WithHTTPClient(client *http.Client) Option {
+	return func(r *Runner) error {
+		if client == nil {
+			return fmt.Errorf("the http client can't be nil")
+		}
+		r.httpClient = client
+		return nil
+	}
+}
+
+// WithBaseURL sends the requests that would be made to the github api (https://api.github.com) to baseURL instead, eg. https://github.example.com/api/v3,
+// or the url of a test server, with the path of each request appended to baseURL's
+// only requests to the api are sent there, the git engine still clones from and pushes to github.com
+func WithBaseURL(baseURL string) Option {
+	return func(r *Runner) error {
+		u, err := url.Parse(baseURL)
+		if err != nil {
+			return fmt.Errorf("Error parsing the base url: %w", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("the base url %q must be an absolute http or https url", baseURL)
+		}
+		r.baseURL = u
+		return nil
+	}
+}
+
+// WithLogger logs everything that would be logged with the default slog logger (see slog.Default) to logger instead,
+// it takes precedence over Config.Logger
+func WithLogger(logger *slog.Logger) Option {
+	return func(r *Runner) error {
+		if logger == nil {
+			return fmt.Errorf("the logger can't be nil")
+		}
+		r.logger = logger
+		return nil
+	}
+}
+
+// WithClock takes the current time from now instead of the system clock, it decides which day contributions are made for, and the times that commits are dated
+func WithClock(now func() time.Time) Option {
+	return func(r *Runner) error {
+		if now == nil {
+			return fmt.Errorf("the clock can't be nil")
+		}
+		r.clock = now
+		return nil
+	}
+}
+
+// WithRateLimit limits every account to requestsPerSecond requests to github, unless its own RequestsPerSecond is set, 0 means no limit
+func WithRateLimit(requestsPerSecond float64) Option {
+	return func(r *Runner) error {
+		if requestsPerSecond < 0 {
+			return fmt.Errorf("the rate limit can't be negative, got %v", requestsPerSecond)
+		}
+		r.requestsPerSecond = requestsPerSecond
+		return nil
+	}
+}
+
+// WithContributionsCache caches the accounts' contribution counts in cache, instead of in a cache of each run's own,
+// so that a program that runs the pipeline repeatedly (eg. every few minutes) counts each account at most once per the cache's ttl
+func WithContributionsCache(cache *contributions.Cache) Option {
+	return func(r *Runner) error {
+		if cache == nil {
+			return fmt.Errorf("the contributions cache can't be nil")
+		}
+		r.counts = cache
+		return nil
+	}
+}
+
+// WithHooks calls hooks at their points in each run (see Hooks)
+func WithHooks(hooks Hooks) Option {
+	return func(r *Runner) error {
+		r.hooks = hooks
+		return nil
+	}
+}
+
+// Run runs the full pipeline for each of cfg's accounts in turn, as the package's Run does, with the runner's options
+func (r *Runner) Run(ctx context.Context, cfg Config) (*Report, error) {
+	return runAll(withRunner(ctx, r), cfg)
+}
+
+// Planner returns a Planner for the accounts in cfg, which plans and executes with the runner's options
+func (r *Runner) Planner(cfg Config) *Planner {
+	if cfg.TokenClient == nil {
+		cfg.TokenClient = r.tokenClient()
+	}
+	return &Planner{cfg: cfg, runner: r}
+}
+
+// tokenClient returns the client that tokens are obtained with when the Config has none
+func (r *Runner) tokenClient() *http.Client {
+	if r.httpClient != nil {
+		return r.httpClient
+	}
+	return &http.Client{Timeout: time.Second * 7}
+}
+
+// transport returns the RoundTripper that each account's requests are sent with, once they are authorized
+func (r *Runner) transport() http.RoundTripper {
+	transport := r.httpTransport()
+	if r.baseURL != nil {
+		transport = &baseURLTransport{base: r.baseURL, transport: transport}
+	}
+	return transport
+}
+
+// httpTransport returns the RoundTripper of the Runner's http client, or if it has none, the default one
+func (r *Runner) httpTransport() http.RoundTripper {
+	if r.httpClient != nil && r.httpClient.Transport != nil {
+		return r.httpClient.Transport
+	}
+	return http.DefaultTransport
+}
+
+// timeout returns the timeout of each account's client
+func (r *Runner) timeout() time.Duration {
+	if r.httpClient != nil {
+		return r.httpClient.Timeout
+	}
+	return time.Second * 7
+}
+
+// runnerKey is the key of the Runner in a context, see withRunner
+type runnerKey struct{}
+
+// withRunner returns a copy of ctx that carries r, for everything run with it to take its logger, clock, contributions cache and hooks from
+// nearly everything that the pipeline does is passed a context already, so this is much less intrusive than passing the runner alongside it everywhere,
+// but the clients that requests are sent with are made with the runner passed explicitly (see Account.newClient), so that none of them picks up its transport by accident
+func withRunner(ctx context.Context, r *Runner) context.Context {
+	return context.WithValue(ctx, runnerKey{}, r)
+}
+
+// runnerFrom returns the Runner that ctx carries, or one with the default options if it carries none
+func runnerFrom(ctx context.Context) *Runner {
+	if r, ok := ctx.Value(runnerKey{}).(*Runner); ok {
+		return r
+	}
+	return &Runner{}
+}
+
+// withConfig returns a copy of ctx whose Runner logs with cfg's Logger, unless cfg has none, or the Runner has a logger of its own,
+// and caches contribution counts for the run, unless the Runner has a cache of its own
+func withConfig(ctx context.Context, cfg Config) context.Context {
+	configured := *runnerFrom(ctx)
+	if configured.logger == nil {
+		configured.logger = cfg.Logger
+	}
+	if configured.counts == nil {
+		configured.counts = contributions.NewCache(defaultCountCacheTTL)
+	}
+	return withRunner(ctx, &configured)
+}
+
+// logger returns the logger of the Runner that ctx carries, or if it has none, the default slog logger
+// everything is logged through it, with its attributes (eg. the account and repo) as key value pairs, so that the embedding program decides where logs go, and in what format
+func logger(ctx context.Context) *slog.Logger {
+	if logger := runnerFrom(ctx).logger; logger != nil {
+		return logger
+	}
+	return slog.Default()
+}
+
+// currentTime returns the current time by the clock of the Runner that ctx carries, or if it has none, the system clock
+func currentTime(ctx context.Context) time.Time {
+	if clock := runnerFrom(ctx).clock; clock != nil {
+		return clock()
+	}
+	return time.Now()
+}
+
+// recoverPanic is deferred at the start of every goroutine that a run starts, and turns a panic in it into *err, with its stack trace,
+// since a panic that isn't recovered in the goroutine it happens in crashes the process with its value and trace printed straight to stderr, which bypasses redaction (see the redact package)
+func recoverPanic(err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+	}
+}
+
+// baseURLTransport is an http.RoundTripper that sends the requests made to the github api to base instead, see WithBaseURL
+type baseURLTransport struct {
+	base      *url.URL
+	transport http.RoundTripper
+}
+
+// RoundTrip sends req to base if it was made to the github api, or as it is otherwise
+func (t *baseURLTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != githubAPIHost {
+		return t.transport.RoundTrip(req)
+	}
+	// a RoundTripper must not modify the request it is given, so the url is changed on a copy
+	rewritten := req.Clone(req.Context())
+	u := *req.URL
+	u.Scheme, u.Host = t.base.Scheme, t.base.Host
+	u.Path, u.RawPath = strings.TrimSuffix(t.base.Path, "/")+req.URL.Path, ""
+	rewritten.URL, rewritten.Host = &u, ""
+	return t.transport.RoundTrip(rewritten)
+}
@@ -0,0 +1,528 @@
+package commitcron
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/anacanm/commitCron/pathmatch"
+	"github.com/anacanm/commitCron/repocontents"
+)
+
+// Selection configures which files in the repository may be selected to be modified
+type Selection struct {
+	// TargetPath is the slash separated path of the directory that files are selected from, and created in, which is "" for the root directory
+	// it keeps the changes away from whatever else lives in the same repository
+	TargetPath string
+	// Branch, if it is not "", is the branch that files are selected from and committed to, in place of the default branch
+	Branch string
+	// GeneratedDir, if it is not "", is the slash separated path of the directory that new files are created in, in place of TargetPath,
+	// so that everything this script creates lives in a single, well known directory that is easy to review, ignore, or purge
+	GeneratedDir string
+	// FileName generates the names of new files, see newFileName
+	FileName *template.Template
+	// MaxDepth is how many directory levels below TargetPath are descended into, a negative MaxDepth means there is no limit
+	// files directly in TargetPath are at depth 0, files in its subdirectories at depth 1, and so on
+	MaxDepth int
+	// Ignore matches the paths excluded by the repository's .commitcronignore file
+	Ignore *pathmatch.Matcher
+	// Generated matches (with MatchLast) the paths that the repository's .gitattributes file marks as linguist-generated or linguist-vendored
+	Generated *pathmatch.Matcher
+	// LFS matches (with MatchLast) the paths that the repository's .gitattributes file tracks with git lfs, whose files in the repository are only pointers to their content,
+	// so they are never modified, or created, since writing content to them directly would leave them neither a valid pointer nor tracked
+	LFS *pathmatch.Matcher
+	// SkipCodeOwned is whether files that the repository's CODEOWNERS file assigns to anyone other than the account are skipped
+	SkipCodeOwned bool
+	// CodeOwned matches (with MatchLast) the paths that the repository's CODEOWNERS file assigns to someone other than the account, it is only loaded if SkipCodeOwned is set
+	CodeOwned *pathmatch.Matcher
+	// Protected matches the paths configured in PROTECTED_PATHS, which must never be modified, no matter what
+	Protected *pathmatch.Matcher
+	// Extensions are the rules for the extensions of the files that may be modified, and how they are modified
+	// this is to help ensure that important files such as go.mod are not modified, (even though you should not have this code running in a repository with important code)
+	Extensions ExtensionRules
+	// PreferStale is whether files that have gone longer without being modified are more likely to be chosen
+	PreferStale bool
+	// ReuseGenerated is whether only files that were created by this script are modified (see generated), so that the repository doesn't grow every day,
+	// new files are then only created if there are none
+	ReuseGenerated bool
+	// MaxGenerated, if it is positive, is how many files may be in GeneratedDir, any more are deleted at the end of each run (see pruneGenerated)
+	MaxGenerated int
+	// MaxFileSize is the size in bytes of the largest file that may be modified, so that huge files are never downloaded and re-uploaded just to change a line
+	MaxFileSize int64
+	// NoListingCache is whether the repository is listed in full on every run, instead of its listing being cached between runs (see repocontents.Lister)
+	NoListingCache bool
+}
+
+// defaultMaxFileSize is the default MaxFileSize, 1 MB is also the largest file whose content the contents api returns inline
+const defaultMaxFileSize = 1 << 20
+
+// maxRepoFileBytes is the ceiling on how much is read of each file in the repository that affects selection (.commitcronignore and .gitattributes)
+const maxRepoFileBytes = 1 << 20
+
+// candidateOversample is how many candidates are collected for each file that is needed when the repository has to be traversed one directory at a time,
+// so that there are still enough left over once the candidates that turn out to be unsuitable (eg. binary files) have been skipped
+const candidateOversample = 4
+
+// ignoreFileName is the file in the root of the target repository that lists paths (in gitignore syntax) that must never be modified,
+// letting repository owners protect areas of the repository without changing the configuration of whoever runs this script
+const ignoreFileName = ".commitcronignore"
+
+// attributesFileName is the file in the root of the target repository that marks paths as generated or vendored (among other things),
+// touching generated or vendored files is noisy, and can break whatever generates or vendors them, so they are never modified
+const attributesFileName = ".gitattributes"
+
+// lfsFilter is the value of the filter attribute in .gitattributes that tracks a path with git lfs
+const lfsFilter = "lfs"
+
+// linguistAttributes are the attributes in .gitattributes that mark a path as generated or vendored
+var linguistAttributes = []string{"linguist-generated", "linguist-vendored"}
+
+// codeOwnersFileNames are the places github looks for a CODEOWNERS file, in the order it looks, only the first one found is used
+var codeOwnersFileNames = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// repoFileReader returns the contents of the file at the slash separated path p in the target repository, or false if there is no such file
+type repoFileReader func(p string) ([]byte, bool, error)
+
+// repoDirLister returns the slash separated paths of the files with the extension ext (eg. ".go") directly in the directory at the slash separated path dir
+// of the target repository ("" is its root), or none if there is no such directory
+type repoDirLister func(dir, ext string) ([]string, error)
+
+// contentsDirLister returns a repoDirLister that lists directories through the contents api of the repository whose root directory has the contents url contentsURL,
+// on the branch ref, or the default branch if ref is ""
+func contentsDirLister(ctx context.Context, contentsURL string, ref string, client *http.Client) repoDirLister {
+	return func(dir, ext string) ([]string, error) {
+		var entries []struct {
+			Path string `json:"path"`
+			Type string `json:"type"`
+		}
+		err := jsonRequest(ctx, client, "GET", withRef(strings.TrimSuffix(contentsURL+"/"+dir, "/"), ref), nil, &entries)
+		if isStatus(err, http.StatusNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error listing %v: %w", dir, err)
+		}
+		var paths []string
+		for _, e := range entries {
+			if e.Type == "file" && path.Ext(e.Path) == ext {
+				paths = append(paths, e.Path)
+			}
+		}
+		return paths, nil
+	}
+}
+
+// contentsFileReader returns a repoFileReader that reads files through the contents api of the repository whose root directory has the contents url contentsURL,
+// on the branch ref, or the default branch if ref is ""
+func contentsFileReader(ctx context.Context, contentsURL string, ref string, client *http.Client) repoFileReader {
+	return func(p string) ([]byte, bool, error) {
+		return getRawFile(ctx, contentsURL, p, ref, maxRepoFileBytes, client)
+	}
+}
+
+// loadSelection reads the Selection from the environment
+func loadSelection(env Settings) (Selection, error) {
+	sel := Selection{MaxDepth: -1, MaxFileSize: defaultMaxFileSize}
+	var err error
+	sel.Extensions, err = loadExtensionRules(env)
+	if err != nil {
+		return sel, err
+	}
+	if t, present := env.lookup("TARGET_PATH"); present {
+		sel.TargetPath = strings.Trim(path.Clean("/"+t), "/")
+	}
+	sel.Branch = env.get("BRANCH")
+	if g, present := env.lookup("GENERATED_DIR"); present {
+		sel.GeneratedDir = strings.Trim(path.Clean("/"+g), "/")
+	}
+	fileName, present := env.lookup("FILE_NAME_TEMPLATE")
+	if !present {
+		fileName = defaultFileNameTemplate
+	}
+	sel.FileName, err = parseFileNameTemplate(fileName)
+	if err != nil {
+		return sel, err
+	}
+	if d, present := env.lookup("MAX_DEPTH"); present {
+		sel.MaxDepth, err = strconv.Atoi(d)
+		if err != nil {
+			return sel, fmt.Errorf("Error parsing MAX_DEPTH: %w", err)
+		}
+	}
+	if m, present := env.lookup("MAX_FILE_SIZE"); present {
+		sel.MaxFileSize, err = strconv.ParseInt(m, 10, 64)
+		if err != nil || sel.MaxFileSize < 1 || sel.MaxFileSize > maxRawFileBytes {
+			return sel, fmt.Errorf("Error parsing MAX_FILE_SIZE: must be a number of bytes between 1 and %v, got %q", maxRawFileBytes, m)
+		}
+	}
+	if p, present := env.lookup("PREFER_STALE_FILES"); present {
+		sel.PreferStale, err = strconv.ParseBool(p)
+		if err != nil {
+			return sel, fmt.Errorf("Error parsing PREFER_STALE_FILES: %w", err)
+		}
+	}
+	if r, present := env.lookup("REUSE_GENERATED_FILES"); present {
+		sel.ReuseGenerated, err = strconv.ParseBool(r)
+		if err != nil {
+			return sel, fmt.Errorf("Error parsing REUSE_GENERATED_FILES: %w", err)
+		}
+	}
+	if m, present := env.lookup("MAX_GENERATED_FILES"); present {
+		sel.MaxGenerated, err = strconv.Atoi(m)
+		if err != nil || sel.MaxGenerated < 1 {
+			return sel, fmt.Errorf("Error parsing MAX_GENERATED_FILES: must be a positive integer, got %q", m)
+		}
+		// outside of a dedicated directory, the files that this script created can't be told apart from anything else, and deleting anything else would be a disaster
+		if sel.GeneratedDir == "" {
+			return sel, fmt.Errorf("MAX_GENERATED_FILES needs GENERATED_DIR to be set")
+		}
+	}
+	if c, present := env.lookup("SKIP_CODEOWNED"); present {
+		sel.SkipCodeOwned, err = strconv.ParseBool(c)
+		if err != nil {
+			return sel, fmt.Errorf("Error parsing SKIP_CODEOWNED: %w", err)
+		}
+	}
+	if p, present := env.lookup("PROTECTED_PATHS"); present {
+		sel.Protected = pathmatch.New(strings.Split(p, ","))
+	}
+	// anything but a valid false leaves the cache enabled, since the cache only ever saves requests
+	if c, present := env.lookup("LISTING_CACHE"); present {
+		if enabled, err := strconv.ParseBool(c); err == nil && !enabled {
+			sel.NoListingCache = true
+		}
+	}
+	return sel, nil
+}
+
+// createdDir returns the slash separated path of the directory that new files are created in, GeneratedDir if it is set, otherwise TargetPath
+func (sel Selection) createdDir() string {
+	if sel.GeneratedDir != "" {
+		return sel.GeneratedDir
+	}
+	return sel.TargetPath
+}
+
+// inCreatedDir reports whether the file at the slash separated path p could have been created by this script, by where it is:
+// anywhere in GeneratedDir if it is set, since nothing else should live there, otherwise directly in TargetPath
+func (sel Selection) inCreatedDir(p string) bool {
+	if sel.GeneratedDir != "" {
+		return strings.HasPrefix(p, sel.GeneratedDir+"/")
+	}
+	dir := path.Dir(p)
+	return dir == sel.TargetPath || (dir == "." && sel.TargetPath == "")
+}
+
+// generated reports whether file, with its content, was created by this script: it is in GeneratedDir, if that is set,
+// otherwise it is directly in TargetPath, and its content has the comment of its own name that new files are created with
+func (sel Selection) generated(file RepoContent) bool {
+	if !sel.inCreatedDir(file.Path) {
+		return false
+	}
+	if sel.GeneratedDir != "" {
+		return true
+	}
+	rule, _ := sel.Extensions.lookup(file.Name)
+	return bytes.Contains(file.Content, []byte(rule.Comment(file.Name)))
+}
+
+// reuseGenerated returns the generated files among chosen (see generated), each changed as many times as it takes to make n changes,
+// the returned slice has a capacity of n, so that if none of chosen were generated, addNewFiles creates all n
+func (sel Selection) reuseGenerated(chosen []RepoContent, n int) []RepoContent {
+	var generated []RepoContent
+	for _, v := range chosen {
+		if sel.generated(v) {
+			generated = append(generated, v)
+		}
+	}
+	contents := make([]RepoContent, 0, n)
+	for i := 0; len(generated) > 0 && i < n; i++ {
+		contents = append(contents, generated[i%len(generated)])
+	}
+	return contents
+}
+
+// depth returns how many directory levels below the directory it is relative to the file at the slash separated path p is
+func depth(p string) int {
+	return strings.Count(p, "/")
+}
+
+// loadRepoFiles reads the files in the repository that affect selection (if it has them), using read:
+// its .commitcronignore file into sel.Ignore, the paths its .gitattributes file marks as generated or vendored into sel.Generated, and those it tracks with git lfs into sel.LFS,
+// and if sel.SkipCodeOwned is set, the paths its CODEOWNERS file assigns to anyone other than username into sel.CodeOwned
+func (sel *Selection) loadRepoFiles(read repoFileReader, username string) error {
+	data, found, err := read(ignoreFileName)
+	if err != nil {
+		return fmt.Errorf("Error reading %v: %w", ignoreFileName, err)
+	}
+	if found {
+		sel.Ignore = pathmatch.Parse(string(data))
+	}
+
+	data, found, err = read(attributesFileName)
+	if err != nil {
+		return fmt.Errorf("Error reading %v: %w", attributesFileName, err)
+	}
+	if found {
+		sel.Generated = parseAttributes(string(data), linguistAttribute)
+		sel.LFS = parseAttributes(string(data), lfsAttribute)
+	}
+
+	if !sel.SkipCodeOwned {
+		return nil
+	}
+	for _, name := range codeOwnersFileNames {
+		data, found, err = read(name)
+		if err != nil {
+			return fmt.Errorf("Error reading %v: %w", name, err)
+		}
+		if found {
+			sel.CodeOwned = parseCodeOwners(string(data), username)
+			break
+		}
+	}
+	return nil
+}
+
+// parseCodeOwners returns a Matcher that matches the paths that the CODEOWNERS file text assigns to any owner other than username,
+// since changing such a file would request a review from (and so notify) someone else
+// as with .gitattributes, the last line that matches a path decides its owners, so lines whose owners are only username (or that have no owners) become negated patterns
+func parseCodeOwners(text string, username string) *pathmatch.Matcher {
+	var patterns []string
+	for _, line := range strings.Split(text, "\n") {
+		// anything after a "#" is a comment
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		othersOwn := false
+		for _, owner := range fields[1:] {
+			if !strings.EqualFold(strings.TrimPrefix(owner, "@"), username) {
+				othersOwn = true
+			}
+		}
+		if othersOwn {
+			patterns = append(patterns, fields[0])
+		} else {
+			patterns = append(patterns, "!"+fields[0])
+		}
+	}
+	return pathmatch.New(patterns)
+}
+
+// parseAttributes returns a Matcher that matches the paths that the .gitattributes file text sets an attribute on, as attribute reports for each single attribute of a line
+// (see linguistAttribute and lfsAttribute)
+// like gitignore patterns, the last line of a .gitattributes file that matches a path decides its attributes, so a line that unsets the attribute
+// (eg. "-linguist-generated" or "linguist-generated=false") becomes a negated pattern, which un-matches whatever earlier lines matched
+func parseAttributes(text string, attribute func(attr string) (set bool, ok bool)) *pathmatch.Matcher {
+	var patterns []string
+	for _, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		// negated patterns are forbidden in .gitattributes, and git ignores them
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "!") {
+			continue
+		}
+		for _, attr := range fields[1:] {
+			set, ok := attribute(attr)
+			if !ok {
+				continue
+			}
+			if set {
+				patterns = append(patterns, fields[0])
+			} else {
+				patterns = append(patterns, "!"+fields[0])
+			}
+		}
+	}
+	return pathmatch.New(patterns)
+}
+
+// linguistAttribute returns whether the single attribute attr from a .gitattributes line sets or unsets one of the linguistAttributes,
+// ok is false if attr is not one of them
+func linguistAttribute(attr string) (set bool, ok bool) {
+	unset := strings.HasPrefix(attr, "-") || strings.HasPrefix(attr, "!")
+	attr = strings.TrimLeft(attr, "-!")
+	name, value := attr, "true"
+	if i := strings.Index(attr, "="); i >= 0 {
+		name, value = attr[:i], attr[i+1:]
+	}
+	for _, a := range linguistAttributes {
+		if name == a {
+			return !unset && value != "false", true
+		}
+	}
+	return false, false
+}
+
+// lfsAttribute returns whether the single attribute attr from a .gitattributes line tracks paths with git lfs (filter=lfs), or stops them from being tracked
+// (eg. "-filter", or a filter other than lfs), ok is false if attr is not the filter attribute
+func lfsAttribute(attr string) (set bool, ok bool) {
+	unset := strings.HasPrefix(attr, "-") || strings.HasPrefix(attr, "!")
+	attr = strings.TrimLeft(attr, "-!")
+	name, value := attr, ""
+	if i := strings.Index(attr, "="); i >= 0 {
+		name, value = attr[:i], attr[i+1:]
+	}
+	if name != "filter" {
+		return false, false
+	}
+	return !unset && value == lfsFilter, true
+}
+
+// descends reports whether the traversal should list the directory at the slash separated path dir
+// a directory at depth d contains files at depth d+1
+func (sel Selection) descends(dir string) bool {
+	rel, inside := sel.relative(dir)
+	if !inside {
+		// the directories that TargetPath is in have to be descended into to reach it
+		return strings.HasPrefix(sel.TargetPath, dir+"/")
+	}
+	if sel.MaxDepth >= 0 && depth(rel)+1 > sel.MaxDepth {
+		return false
+	}
+	// Generated, LFS and CodeOwned are not checked here, since a later line in their files can always un-match a path inside a directory that they match
+	return !sel.Ignore.Match(dir, true) && !sel.Protected.Match(dir, true)
+}
+
+// protects reports whether the file at the slash separated path p must never be modified
+// unlike allows, it only considers what the user has explicitly protected, so that it can serve as a final guard immediately before each file is written
+func (sel Selection) protects(p string) bool {
+	return sel.Protected.Match(p, false)
+}
+
+// lfsTracked reports whether the file at the slash separated path p is tracked with git lfs, and so must never be written to
+func (sel Selection) lfsTracked(p string) bool {
+	return sel.LFS.MatchLast(p, false)
+}
+
+// allows reports whether the file at the slash separated path p may be modified
+func (sel Selection) allows(p string) bool {
+	rel, inside := sel.relative(p)
+	if !inside {
+		return false
+	}
+	if sel.MaxDepth >= 0 && depth(rel) > sel.MaxDepth {
+		return false
+	}
+	if sel.Ignore.Match(p, false) || sel.Generated.MatchLast(p, false) || sel.lfsTracked(p) || sel.CodeOwned.MatchLast(p, false) || sel.protects(p) {
+		return false
+	}
+	if sel.ReuseGenerated && !sel.inCreatedDir(p) {
+		return false
+	}
+	_, ok := sel.Extensions.lookup(path.Base(p))
+	return ok
+}
+
+// relative returns the slash separated path p relative to sel.TargetPath, inside is false if p is not inside sel.TargetPath at all
+func (sel Selection) relative(p string) (rel string, inside bool) {
+	if sel.TargetPath == "" {
+		return p, true
+	}
+	if strings.HasPrefix(p, sel.TargetPath+"/") {
+		return strings.TrimPrefix(p, sel.TargetPath+"/"), true
+	}
+	return "", false
+}
+
+// fits reports whether a file of size bytes is small enough to be modified
+func (sel Selection) fits(size int64) bool {
+	return size <= sel.MaxFileSize
+}
+
+// filter returns the repocontents.Filter that lists the files that sel allows (and that fit within its size ceiling), descending only into the directories that sel descends into,
+// and, if the repository has to be listed one directory at a time, stopping once limit files have been found
+func (sel Selection) filter(limit int) repocontents.Filter {
+	return repocontents.Filter{
+		Allows:   sel.allows,
+		Descends: sel.descends,
+		MaxSize:  sel.MaxFileSize,
+		Limit:    limit,
+	}
+}
+
+// shuffleCandidates puts candidates into a random order, so that the files chosen from them vary from run to run,
+// rather than the same first files in listing order being modified forever, which makes for a more varied, realistic looking history
+func shuffleCandidates(candidates []RepoContent) {
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+}
+
+// preferStale reorders the first sample of the (already shuffled) candidates so that the files which have gone the longest without being modified tend to come first,
+// so that changes rotate through the repository instead of stacking up on a handful of files
+// finding when a file was last modified takes a request per file, which is why only a sample of the candidates is weighed, the rest are left as they are after it
+// the order is still random, but a file's chance of coming before another is weighted by how long it has been since it was last modified:
+// each file is given the key u^(1/w), where u is uniformly random in (0, 1) and w is its weight, and the files are sorted by their keys, largest first
+// ref is the branch that the files were last modified on, or "" for the default branch
+func preferStale(ctx context.Context, candidates []RepoContent, sample int, owner, repo string, ref string, lister RepoLister) error {
+	if sample > len(candidates) {
+		sample = len(candidates)
+	}
+	weighed := candidates[:sample]
+	keys := make(map[string]float64, sample)
+	now := currentTime(ctx)
+	for _, candidate := range weighed {
+		modified, err := lister.LastModified(ctx, owner, repo, ref, candidate.Path)
+		if err != nil {
+			return err
+		}
+		// a file's weight is the number of hours since it was last modified (plus one, so that a file modified this hour can still be chosen)
+		// a file that no commit has touched has never been modified by us, so it is weighted as though it were modified a year ago
+		weight := now.Sub(modified).Hours()
+		if modified.IsZero() || weight > 365*24 {
+			weight = 365 * 24
+		}
+		if weight < 0 {
+			weight = 0
+		}
+		keys[candidate.Path] = math.Pow(1-rand.Float64(), 1/(weight+1))
+	}
+	sort.SliceStable(weighed, func(i, j int) bool {
+		return keys[weighed[i].Path] > keys[weighed[j].Path]
+	})
+	return nil
+}
+
+// chooseFiles returns up to n of the candidates, in order, skipping any whose content turns out to be unsuitable for modification
+// each chosen file's Content is fetched (and kept, so that it need not be fetched again), and files with binary content are skipped,
+// since even with extension checks, a file such as a .txt can contain binary data that appending comment bytes to would corrupt
+// files that have grown past sel's size ceiling since they were listed are skipped as well
+// the returned slice has a capacity of n, since that is the number of changes that will be made (files are created to make up the difference)
+func chooseFiles(ctx context.Context, candidates []RepoContent, n int, sel Selection, owner, repo string, lister RepoLister) ([]RepoContent, error) {
+	chosen := make([]RepoContent, 0, n)
+	for _, candidate := range candidates {
+		if len(chosen) == n {
+			break
+		}
+		data, found, err := lister.ReadFile(ctx, owner, repo, sel.Branch, candidate.Path, sel.MaxFileSize)
+		if err != nil {
+			return nil, err
+		}
+		if !found || !sel.fits(int64(len(data))) || isBinary(data) {
+			continue
+		}
+		// the sha is that of the content that was read, which the file may have changed from since it was listed, so that the change made to it is rejected as a conflict
+		// if the file changes again before the change is uploaded, rather than reverting whatever changed it
+		candidate.Content, candidate.SHA = data, blobSHA(data)
+		chosen = append(chosen, candidate)
+	}
+	return chosen, nil
+}
+
+// isBinary reports whether data looks like the content of a binary file rather than text: it contains a null byte, or isn't valid utf-8
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data)
+}
@@ -0,0 +1,34 @@
+package commitcron
+
+import (
+	"os"
+	"strings"
+)
+
+// Settings are everything that the pipeline is configured with besides its accounts, by the names of the environment variables that the README documents (eg. BRANCH)
+// the commitcron command reads them from the environment (see SettingsFromEnv), but nothing else does, so a program embedding the pipeline can set them from anywhere,
+// and runs with different settings, and different credentials, can share a process
+// a setting that is not set takes its default, as a variable that is not set in the environment does, so nil Settings are all defaults
+type Settings map[string]string
+
+// SettingsFromEnv returns every variable in the environment as Settings
+func SettingsFromEnv() Settings {
+	env := Settings{}
+	for _, variable := range os.Environ() {
+		if i := strings.Index(variable, "="); i > 0 {
+			env[variable[:i]] = variable[i+1:]
+		}
+	}
+	return env
+}
+
+// lookup returns the value of the setting name, and whether it is set at all, as os.LookupEnv does
+func (s Settings) lookup(name string) (string, bool) {
+	value, present := s[name]
+	return value, present
+}
+
+// get returns the value of the setting name, or "" if it is not set, as os.Getenv does
+func (s Settings) get(name string) string {
+	return s[name]
+}
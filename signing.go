@@ -0,0 +1,77 @@
+package commitcron
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// commitSigner signs the commits that are made, so that they show as verified, and satisfy repositories that require signed commits
+type commitSigner struct {
+	// Format is gpg or ssh
+	Format string
+	// Key is the gpg key id to sign with, or the path of the ssh private key to sign with
+	Key string
+}
+
+// loadCommitSigner reads the commitSigner from the environment, it returns nil if COMMIT_SIGNING is not set, in which case commits are not signed
+// if SIGNING_KEY is not set, the key is the user.signingkey in the user's gitconfig, as it would be for git itself
+func loadCommitSigner(env Settings) (*commitSigner, error) {
+	format := env.get("COMMIT_SIGNING")
+	switch format {
+	case "":
+		return nil, nil
+	case "gpg", "ssh":
+	default:
+		return nil, fmt.Errorf("Error parsing COMMIT_SIGNING: must be gpg or ssh, got %q", format)
+	}
+	key := env.get("SIGNING_KEY")
+	if key == "" {
+		var err error
+		if key, err = globalSigningKey(format); err != nil {
+			return nil, err
+		}
+		if key == "" {
+			return nil, fmt.Errorf("COMMIT_SIGNING is %v, but neither SIGNING_KEY nor user.signingkey in gitconfig is set", format)
+		}
+	}
+	return &commitSigner{Format: format, Key: key}, nil
+}
+
+// sign returns the armored detached signature of payload, made with gpg or ssh-keygen (which must be installed)
+func (s commitSigner) sign(ctx context.Context, payload []byte) (string, error) {
+	var cmd *exec.Cmd
+	if s.Format == "ssh" {
+		// with no files to sign, ssh-keygen signs stdin and writes the signature to stdout, git's namespace for commit signatures is "git"
+		cmd = exec.CommandContext(ctx, "ssh-keygen", "-Y", "sign", "-n", "git", "-f", s.Key)
+	} else {
+		cmd = exec.CommandContext(ctx, "gpg", "--batch", "--armor", "--detach-sign", "--local-user", s.Key)
+	}
+	cmd.Stdin = bytes.NewReader(payload)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("Error signing commit with %v: %w: %v", cmd.Path, err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+// gitConfig returns the arguments that make git sign the commits it makes the same way, for when commits are made with git itself (ie. PUSH_MODE is ssh)
+func (s commitSigner) gitConfig() []string {
+	format := "openpgp"
+	if s.Format == "ssh" {
+		format = "ssh"
+	}
+	return []string{"-c", "commit.gpgsign=true", "-c", "gpg.format=" + format, "-c", "user.signingkey=" + s.Key}
+}
+
+// commitPayload returns the git commit object (without its header) that a commit with the given tree, parent, author and committer, and message is stored as,
+// which is exactly what its signature must be made over, github checks the signature against the commit object that it creates from the same fields
+func commitPayload(tree, parent string, identity gitIdentity, date time.Time, message string) []byte {
+	signature := fmt.Sprintf("%v <%v> %v %v", identity.Name, identity.Email, date.Unix(), date.Format("-0700"))
+	return []byte(fmt.Sprintf("tree %v\nparent %v\nauthor %v\ncommitter %v\n\n%v", tree, parent, signature, signature, message))
+}
@@ -0,0 +1,67 @@
+//go:build !wasm
+
+package commitcron
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/config"
+)
+
+// globalSigningKey returns user.signingkey from the user's global gitconfig (see gitConfigSigningKey), or "" if it is not set
+func globalSigningKey(format string) (string, error) {
+	cfg, err := config.LoadConfig(config.GlobalScope)
+	if err != nil {
+		return "", fmt.Errorf("Error reading gitconfig for user.signingkey: %w", err)
+	}
+	return gitConfigSigningKey(cfg, format)
+}
+
+// gitConfigSigner returns the commitSigner that git itself would sign commits with, as configured by commit.gpgsign, gpg.format and user.signingkey in cfg,
+// or nil if git isn't configured to sign commits
+func gitConfigSigner(cfg *config.Config) (*commitSigner, error) {
+	if cfg.Raw.Section("commit").Option("gpgsign") != "true" {
+		return nil, nil
+	}
+	var format string
+	switch f := cfg.Raw.Section("gpg").Option("format"); f {
+	case "", "openpgp":
+		format = "gpg"
+	case "ssh":
+		format = "ssh"
+	default:
+		return nil, fmt.Errorf("gitconfig has commit.gpgsign set with gpg.format %v, which can't be used, only openpgp and ssh can", f)
+	}
+	key, err := gitConfigSigningKey(cfg, format)
+	if err != nil {
+		return nil, err
+	}
+	if key == "" {
+		// git itself signs with the key for the committer's email when there is no user.signingkey, but which email that is isn't known until the commit is made
+		return nil, fmt.Errorf("gitconfig has commit.gpgsign set, but not user.signingkey, set it, or COMMIT_SIGNING and SIGNING_KEY")
+	}
+	return &commitSigner{Format: format, Key: key}, nil
+}
+
+// gitConfigSigningKey returns user.signingkey from cfg, or "" if it is not set, with a leading ~/ expanded for ssh keys, which are paths, as git does
+// an ssh key given literally ("key::...") can't be signed with, since ssh-keygen needs a file
+func gitConfigSigningKey(cfg *config.Config, format string) (string, error) {
+	key := cfg.Raw.Section("user").Option("signingkey")
+	if format != "ssh" || key == "" {
+		return key, nil
+	}
+	if strings.HasPrefix(key, "key::") {
+		return "", fmt.Errorf("user.signingkey in gitconfig is a literal ssh key, which can't be signed with, set it to the path of the key instead")
+	}
+	if strings.HasPrefix(key, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("Error expanding user.signingkey: %w", err)
+		}
+		key = filepath.Join(home, key[2:])
+	}
+	return key, nil
+}
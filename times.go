@@ -0,0 +1,121 @@
+package commitcron
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultWorkingHours are the hours of the day, in local time, that commits are spread across when COMMIT_TIMES is working-hours
+var defaultWorkingHours = [2]int{9, 17}
+
+// defaultRecentWindow is how long before the run commits are dated when COMMIT_TIMES is recent
+const defaultRecentWindow = time.Hour
+
+// commitTimes configures the author and committer dates of the commits that are made
+type commitTimes struct {
+	// Spread is whether the dates are randomized within WorkingHours, rather than being left for github to set to the moment each commit is made
+	Spread bool
+	// WorkingHours are the first and last hour of the day (in local time, set TZ to change it) that commits may be dated
+	WorkingHours [2]int
+	// Window, if it is not 0, randomizes the dates within the Window before the run instead of the working hours (though never before the start of the day)
+	Window time.Duration
+}
+
+// loadCommitTimes reads the commitTimes from the environment
+func loadCommitTimes(env Settings) (commitTimes, error) {
+	times := commitTimes{WorkingHours: defaultWorkingHours}
+	switch t := env.get("COMMIT_TIMES"); t {
+	case "", "now":
+	case "working-hours":
+		times.Spread = true
+	case "recent":
+		times.Spread, times.Window = true, defaultRecentWindow
+	default:
+		return times, fmt.Errorf("Error parsing COMMIT_TIMES: must be now, working-hours or recent, got %q", t)
+	}
+	if w, present := env.lookup("COMMIT_TIME_WINDOW"); present && times.Window != 0 {
+		window, err := time.ParseDuration(w)
+		if err != nil || window <= 0 {
+			return times, fmt.Errorf("Error parsing COMMIT_TIME_WINDOW: must be a positive duration, eg. 90m, got %q", w)
+		}
+		times.Window = window
+	}
+	if h, present := env.lookup("WORKING_HOURS"); present {
+		hours, err := parseHourRange(h)
+		if err != nil {
+			return times, fmt.Errorf("Error parsing WORKING_HOURS: %w", err)
+		}
+		times.WorkingHours = hours
+	}
+	return times, nil
+}
+
+// parseHourRange parses a range of hours of the day of the form "9-17"
+func parseHourRange(s string) ([2]int, error) {
+	var hours [2]int
+	parts := strings.SplitN(s, "-", 2)
+	if len(parts) != 2 {
+		return hours, fmt.Errorf("must be of the form start-end, got %q", s)
+	}
+	for i, part := range parts {
+		h, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || h < 0 || h > 24 {
+			return hours, fmt.Errorf("hours must be between 0 and 24, got %q", part)
+		}
+		hours[i] = h
+	}
+	if hours[0] >= hours[1] {
+		return hours, fmt.Errorf("the start must be before the end, got %q", s)
+	}
+	return hours, nil
+}
+
+// dates returns the dates of n commits made on the day of now, in ascending order, so that each commit is dated after its parent
+// if times.Spread is false, nil is returned, and github dates each commit itself
+// no date is ever after now, since github refuses to show contributions from the future, so if now is before the working hours have started, every commit is dated now,
+// and if it is during them, the commits are spread between their start and now
+// if times.Window is set, the commits are spread across the window before now instead, or the part of it that is today
+// git dates commits to the second, so no two dates are ever in the same second, unless there are more commits than seconds to date them in
+func (times commitTimes) dates(n int, now time.Time) []time.Time {
+	if !times.Spread {
+		return nil
+	}
+	now = now.Truncate(time.Second)
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	start := day.Add(time.Duration(times.WorkingHours[0]) * time.Hour)
+	end := day.Add(time.Duration(times.WorkingHours[1]) * time.Hour)
+	if times.Window != 0 {
+		start, end = now.Add(-times.Window), now
+		if start.Before(day) {
+			start = day
+		}
+	}
+	if end.After(now) {
+		end = now
+	}
+	if start.After(end) {
+		start = end
+	}
+
+	dates := make([]time.Time, n)
+	for i := range dates {
+		dates[i] = start.Add(time.Duration(rand.Int63n(int64(end.Sub(start)) + 1))).Truncate(time.Second)
+	}
+	sort.Slice(dates, func(i, j int) bool {
+		return dates[i].Before(dates[j])
+	})
+	// dates that share a second are pushed earlier, since none may be after now, but none is pushed into yesterday either, which would make it yesterday's contribution
+	for i := n - 2; i >= 0; i-- {
+		if !dates[i].Before(dates[i+1]) {
+			dates[i] = dates[i+1].Add(-time.Second)
+			if dates[i].Before(day) {
+				dates[i] = day
+			}
+		}
+	}
+	return dates
+}
@@ -0,0 +1,423 @@
+package commitcron
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// UpdateFilesAndCreateRemaining takes the contents url of the repository's root directory, a slice of RepoContents and the number of changes it is supposed to make (the capacity),
+// and if len(contents) < nRequiredChanges, creates the remaining files, then uploads every change (see planUpdates and uploadUpdates)
+func UpdateFilesAndCreateRemaining(ctx context.Context, env Settings, contentsURL string, contents []RepoContent, sel Selection, client *http.Client) error {
+	opts, err := loadCommitOptions(env)
+	if err != nil {
+		return err
+	}
+	updates, err := planUpdates(ctx, contentsFileReader(ctx, contentsURL, sel.Branch, client), contentsDirLister(ctx, contentsURL, sel.Branch, client), contents, sel, opts)
+	if err != nil {
+		return err
+	}
+	return uploadUpdates(ctx, contentsURL, updates, sel, opts, client)
+}
+
+// planUpdates fills contents up to its capacity with new files (see addNewFiles), and returns the change to be made to each of them (see prepareUpdates),
+// without changing anything in the repository, which read reads, and list lists
+// as a final guard, nothing that sel protects is ever planned, even if it somehow made it past selection
+func planUpdates(ctx context.Context, read repoFileReader, list repoDirLister, contents []RepoContent, sel Selection, opts commitOptions) ([]fileUpdate, error) {
+	contents, err := addNewFiles(contents, sel, read, list, currentTime(ctx))
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range contents {
+		if sel.protects(v.Path) {
+			return nil, fmt.Errorf("refusing to modify %v, it is protected by PROTECTED_PATHS", v.Path)
+		}
+	}
+	return prepareUpdates(ctx, contents, sel, opts)
+}
+
+// uploadUpdates commits updates to the repository whose root directory has the contents url contentsURL
+// uploads are made by up to UPLOAD_CONCURRENCY workers at once (1 if not specified), the first upload to fail cancels the rest, and its error is returned
+// unless UPLOAD_BACKEND is git-data, in which case the changes are committed with the git data api instead (see uploadGitData)
+// as a final guard, nothing that sel protects is ever uploaded, even if it somehow made it past planning
+func uploadUpdates(ctx context.Context, contentsURL string, updates []fileUpdate, sel Selection, opts commitOptions, client *http.Client) error {
+	for _, u := range updates {
+		if sel.protects(u.File.Path) {
+			return fmt.Errorf("refusing to modify %v, it is protected by PROTECTED_PATHS", u.File.Path)
+		}
+	}
+	// commits authored by an email that is not on the account do not count as contributions, so there is no point in making them
+	if opts.Author != nil {
+		checked, err := checkAuthorEmail(ctx, client, opts.Author.Email)
+		if err != nil {
+			return err
+		}
+		if !checked {
+			logger(ctx).Warn("Can't check whether the author email is an email on the account (the token can't list its email addresses), if it isn't, these commits won't count as contributions", "email", opts.Author.Email)
+		}
+	}
+
+	workers := opts.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	// each change to a file that is changed more than once (eg. a journal) must be committed after the one before it, which it builds on
+	paths := map[string]bool{}
+	anyExist := false
+	for _, u := range updates {
+		if paths[u.File.Path] {
+			workers = 1
+		}
+		paths[u.File.Path] = true
+		anyExist = anyExist || u.File.SHA != ""
+	}
+
+	// if none of the files exist yet, the repository may well be empty, in which case it is seeded with the first new file on its own before any others are uploaded,
+	// since until the repository has its first commit, there is no branch for the rest to be committed to (or for concurrent uploads to race on),
+	// and the git data api does not work on an empty repository at all, so the contents api is always used for this
+	if len(updates) > 0 && !anyExist {
+		logger(ctx).Info("None of the files to be changed exist yet, creating one before the rest", "url", contentsURL, "path", updates[0].File.Path)
+		if err := uploadFile(ctx, contentsURL, updates[0], sel, opts, client); err != nil {
+			return err
+		}
+		updates = updates[1:]
+		// the rest are dated with the last of the dates, since the first was made without one
+		if commits := (len(updates) + opts.FilesPerCommit - 1) / opts.FilesPerCommit; len(opts.Dates) > commits {
+			opts.Dates = opts.Dates[len(opts.Dates)-commits:]
+		}
+	}
+
+	if opts.Backend == "git-data" {
+		return uploadGitData(ctx, strings.TrimSuffix(contentsURL, "/contents"), sel.Branch, updates, opts, client)
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(workers)
+	for _, u := range updates {
+		u := u
+		g.Go(func() (err error) {
+			defer recoverPanic(&err)
+			return uploadFile(ctx, contentsURL, u, sel, opts, client)
+		})
+	}
+	return g.Wait()
+}
+
+// fileUpdate is a single change to be committed: the file, its new content, and the message it is committed with
+type fileUpdate struct {
+	File    RepoContent
+	Content []byte
+	// Message is not yet finished (see commitMessages.finish), since several changes may share a commit
+	Message string
+	// Delete is set if the change deletes the file, in which case there is no content
+	Delete bool
+}
+
+// prepareUpdates returns the change to be made to each of contents, in order
+// if opts.LLM is set, it generates the messages (and optionally the content), and whatever it fails to generate is generated as it would be without it
+// a file may appear in contents more than once (eg. a journal), in which case each change builds on the one before it
+func prepareUpdates(ctx context.Context, contents []RepoContent, sel Selection, opts commitOptions) ([]fileUpdate, error) {
+	updates := make([]fileUpdate, 0, len(contents))
+	now := currentTime(ctx)
+	// a file that a previous change deleted is nil here
+	changed := map[string][]byte{}
+	for i, v := range contents {
+		// files are only ever chosen, or created, where git lfs doesn't track them, but the journal's path is fixed, so it is checked here, for every engine
+		if sel.lfsTracked(v.Path) {
+			return nil, fmt.Errorf("refusing to write %v, the repository's .gitattributes tracks it with git lfs, and writing it directly would corrupt its pointer", v.Path)
+		}
+		if previous, ok := changed[v.Path]; ok && previous == nil {
+			v.Content, v.SHA = nil, ""
+		} else if ok {
+			v.Content, v.SHA = previous, blobSHA(previous)
+		}
+		rule, _ := sel.Extensions.lookup(v.Name)
+		change, message := fileChange(v.Name, v.SHA, rule)
+
+		// in recreate mode, the file is deleted if it exists, and created again (as new files are) if it does not
+		if opts.Content.Mode == "recreate" && v.SHA != "" {
+			message, err := opts.Messages.subject(fmt.Sprintf("deleting file with sha: %v", v.SHA), v, rule, i+1, now)
+			if err != nil {
+				return nil, err
+			}
+			changed[v.Path] = nil
+			updates = append(updates, fileUpdate{File: v, Message: message, Delete: true})
+			continue
+		}
+
+		var content []byte
+		var err error
+		if opts.Content.Mode == "journal" || opts.Content.Mode == "changelog" {
+			content, err = opts.Content.journalChange(v, rule, opts, i, now)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			if opts.LLM != nil && opts.LLM.Content {
+				if snippet, ok := opts.LLM.snippet(ctx, v.Name); ok {
+					// the snippet is commented out line by line, so that it can't break the file (Comment removes whatever in a line would end its comment early)
+					lines := strings.Split(snippet, "\n")
+					for j, line := range lines {
+						lines[j] = rule.Comment(line)
+					}
+					change = strings.Join(lines, "\n")
+				}
+			}
+			// the existing content of the file is kept, and the change inserted into it, unless INSERT_STRATEGY is replace, and new files are created as valid files for their language
+			if v.SHA == "" {
+				content, err = opts.Content.created(v, rule, change, i+1, contents, now)
+				if err != nil {
+					return nil, err
+				}
+			} else {
+				content = insert(v.Content, change, opts.Content.Insert, rule)
+			}
+			content = opts.Content.format(ctx, v, rule, v.Content, content)
+		}
+		// uploading a file's exact content again makes no commit, and so no contribution, which can happen if eg. a formatter removes the change,
+		// so the change is varied with a unique comment, and if even that doesn't change the file, there is no way of changing it
+		if v.SHA != "" && bytes.Equal(content, v.Content) {
+			content = opts.Content.format(ctx, v, rule, v.Content, insert(content, rule.Comment(newCommitID()), "append", rule))
+			if bytes.Equal(content, v.Content) {
+				return nil, fmt.Errorf("Error changing %v: its content is the same after the change", v.Path)
+			}
+		}
+
+		generated, ok := "", false
+		if opts.LLM != nil {
+			generated, ok = opts.LLM.commitMessage(ctx, v, opts.Messages.Style)
+		}
+		if ok {
+			message = generated
+		} else {
+			message, err = opts.Messages.subject(message, v, rule, i+1, now)
+			if err != nil {
+				return nil, err
+			}
+		}
+		changed[v.Path] = content
+		updates = append(updates, fileUpdate{File: v, Content: content, Message: message})
+	}
+	return updates, nil
+}
+
+// addNewFiles fills contents up to its capacity with new files to be created in sel.createdDir(), and returns the filled slice
+// the new files are named with sel.FileName, and given the extension of the rule that sel.Extensions.creatable returns, unless the name already has one
+// a name is only used if no other file in contents has it, and read finds no file with it in the repository, so a new file never overwrites an existing one
+// a new go file is given the package of the go files already in its directory, which list finds, and read reads (see existingGoPackage)
+func addNewFiles(contents []RepoContent, sel Selection, read repoFileReader, list repoDirLister, now time.Time) ([]RepoContent, error) {
+	if len(contents) == cap(contents) {
+		return contents, nil
+	}
+	rule, ok := sel.Extensions.creatable()
+	if !ok {
+		return nil, fmt.Errorf("%v more files need to be created, but every extension in FILE_EXTENSIONS is update-only", cap(contents)-len(contents))
+	}
+
+	// we will check the specific path of each file, since we can have duplicate names so long as the two files are in different subdirectories
+	taken := map[string]bool{}
+	for _, v := range contents {
+		taken[v.Path] = true
+	}
+	// while there are less contents than than need to be made, we need to create new contents
+	// if the len(contents) == cap(contents) (remember: contents was initialized with the numberOfContributions as its capacity), then this will never execute
+	seq := 0
+	packages := map[string]string{}
+	for len(contents) < cap(contents) {
+		// the template makes names unique with ulids, the sequence number of the name, or random digits, but if it happens to generate a name that is taken, another is generated
+		seq++
+		if seq > maxFileNameAttempts*cap(contents) {
+			return nil, fmt.Errorf("FILE_NAME_TEMPLATE keeps generating the names of files that already exist, it should reference .ULID, .Seq or .Rand")
+		}
+		name, err := newFileName(sel.FileName, sel.Extensions, rule, seq, now)
+		if err != nil {
+			return nil, err
+		}
+		newFilePath := path.Join(sel.createdDir(), name)
+		if taken[newFilePath] {
+			continue
+		}
+		if sel.lfsTracked(newFilePath) {
+			return nil, fmt.Errorf("%v would be created, but the repository's .gitattributes tracks it with git lfs, so FILE_EXTENSIONS or FILE_NAME_TEMPLATE must be changed", newFilePath)
+		}
+		_, exists, err := read(newFilePath)
+		if err != nil {
+			return nil, fmt.Errorf("Error checking whether %v exists: %w", newFilePath, err)
+		}
+		if exists {
+			continue
+		}
+		// if this is reached, then the filename is accepted, so we can create a new file to be changed. An empty string for a SHA indicates to create it
+		taken[newFilePath] = true
+		file := RepoContent{Name: path.Base(name), Path: newFilePath, SHA: "", Type: "file"}
+		if path.Ext(name) == ".go" {
+			dir := strings.TrimPrefix(path.Dir(newFilePath), ".")
+			pkg, found := packages[dir]
+			if !found {
+				if pkg, err = existingGoPackage(read, list, dir); err != nil {
+					return nil, err
+				}
+				packages[dir] = pkg
+			}
+			file.pkg = pkg
+		}
+		contents = append(contents, file)
+	}
+	return contents, nil
+}
+
+// fileChange returns the change to be made to the file (see insert) and the commit message for changing it
+// creates a file if it does not exist (sha==""), updates it otherwise
+// the change is a comment in the syntax of rule, so that script files can still be run
+func fileChange(fileName string, sha string, rule ExtensionRule) (string, string) {
+	if sha == "" {
+		// the value for the content if the file does not exist is the comment "<fileName>"
+		return rule.Comment(fileName), "creating file to be uploaded"
+	}
+	// the change will be unique using the previous sha
+	return rule.Comment(sha), fmt.Sprintf("updating file with sha: %v", sha)
+}
+
+// uploadFile uploads the update to the file to the github repo whose root directory has the contents url contentsURL, committing it to sel.Branch, or the default branch if it is ""
+// creates a file if it does not exist (sha==""), updates it otherwise
+// of opts, only the messages and author apply, since the contents api commits each file on its own, at the moment of the request
+// if the file has changed since it was read (eg. two runs raced each other), github refuses the upload as a conflict, and since the update was made from the content as it was read,
+// uploading it anyway would revert whatever was committed in between, so the change is prepared again from the file's current content, and that is uploaded instead, once
+func uploadFile(ctx context.Context, contentsURL string, update fileUpdate, sel Selection, opts commitOptions, client *http.Client) error {
+	url := fmt.Sprintf("%v/%v", contentsURL, update.File.Path)
+	if update.Delete {
+		return deleteFile(ctx, url, sel.Branch, client, update, opts)
+	}
+	status, commit, err := putFile(ctx, url, client, uploadBody(update, sel.Branch, opts))
+	// a 409 means that the sha is not the file's current one, and a 422 for a file that is being created, that it has been created since it was read
+	if status == http.StatusConflict || (status == http.StatusUnprocessableEntity && update.File.SHA == "") {
+		logger(ctx).Info("A file changed since it was read, preparing its change again from its current content", "path", update.File.Path)
+		update, err = prepareAgain(ctx, contentsURL, update, sel, opts, client)
+		if err != nil {
+			return err
+		}
+		if update.Delete {
+			return deleteFile(ctx, url, sel.Branch, client, update, opts)
+		}
+		_, commit, err = putFile(ctx, url, client, uploadBody(update, sel.Branch, opts))
+	}
+	if err != nil {
+		return err
+	}
+	recordFiles(ctx, update)
+	recordCommits(ctx, commit)
+	return nil
+}
+
+// uploadBody returns the body of the PUT request that uploads update to branch through the contents api
+func uploadBody(update fileUpdate, branch string, opts commitOptions) map[string]interface{} {
+	// finish the commit message, and encode the content to base64 in compliance with github api's requirement
+	body := map[string]interface{}{
+		"message": opts.Messages.finish(update.Message),
+		"content": base64.StdEncoding.EncodeToString(update.Content),
+		"sha":     update.File.SHA,
+	}
+	if opts.Author != nil {
+		body["author"] = opts.Author
+		body["committer"] = opts.Author
+	}
+	if branch != "" {
+		body["branch"] = branch
+	}
+	return body
+}
+
+// prepareAgain reads the current content of the file of update, and returns the change to be made to it instead (see prepareUpdates),
+// the sha is that of the content that is read, so if the file changes yet again before the change is uploaded, that is a conflict too, rather than a revert
+// a file that has become unsuitable for modification since it was chosen (too large, or binary) is an error
+func prepareAgain(ctx context.Context, contentsURL string, update fileUpdate, sel Selection, opts commitOptions, client *http.Client) (fileUpdate, error) {
+	limit := sel.MaxFileSize
+	if limit < 1 {
+		limit = maxRawFileBytes
+	}
+	data, found, err := getRawFile(ctx, contentsURL, update.File.Path, sel.Branch, limit, client)
+	if err != nil {
+		return update, err
+	}
+	v := update.File
+	v.Content, v.SHA = nil, ""
+	if found {
+		if int64(len(data)) > limit || isBinary(data) {
+			return update, fmt.Errorf("Error changing %v: it changed since it was read, and is no longer a file that can be modified", v.Path)
+		}
+		v.Content, v.SHA = data, blobSHA(data)
+	}
+	updates, err := prepareUpdates(ctx, []RepoContent{v}, sel, opts)
+	if err != nil {
+		return update, err
+	}
+	return updates[0], nil
+}
+
+// contentsCommit is the part of the response to a change made through the contents api that describes the commit it was made in
+type contentsCommit struct {
+	Commit struct {
+		SHA string `json:"sha"`
+	} `json:"commit"`
+}
+
+// putFile sends the PUT request that creates or updates a file through the contents api with body, and returns the status of the response, and the sha of the commit it made,
+// the status is also returned as an error (with the message that came with it) if it is unsuccessful
+func putFile(ctx context.Context, url string, client *http.Client, body map[string]interface{}) (int, string, error) {
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		return 0, "", fmt.Errorf("Error marshalling data into request body: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return 0, "", fmt.Errorf("Error creating PUT request to create file: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", fmt.Errorf("Error sending PUT request to %v: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		var githubError errorResponse
+		json.NewDecoder(io.LimitReader(resp.Body, maxGitDataResponseBytes)).Decode(&githubError)
+		return resp.StatusCode, "", &APIError{Method: "PUT", URL: url, Status: resp.Status, StatusCode: resp.StatusCode, Message: githubError.Message}
+	}
+	// the commit is only reported, so a response that can't be decoded doesn't undo the upload, which has already been made
+	var made contentsCommit
+	json.NewDecoder(io.LimitReader(resp.Body, maxGitDataResponseBytes)).Decode(&made)
+	return resp.StatusCode, made.Commit.SHA, nil
+}
+
+// deleteFile deletes the file of update from the github repo specified by the url, committing it to branch, or the default branch if branch is ""
+func deleteFile(ctx context.Context, url string, branch string, client *http.Client, update fileUpdate, opts commitOptions) error {
+	body := map[string]interface{}{
+		"message": opts.Messages.finish(update.Message),
+		"sha":     update.File.SHA,
+	}
+	if opts.Author != nil {
+		body["author"] = opts.Author
+		body["committer"] = opts.Author
+	}
+	if branch != "" {
+		body["branch"] = branch
+	}
+	var made contentsCommit
+	if err := jsonRequest(ctx, client, "DELETE", url, body, &made); err != nil {
+		return err
+	}
+	recordFiles(ctx, update)
+	recordCommits(ctx, made.Commit.SHA)
+	return nil
+}
@@ -0,0 +1,94 @@
+package commitcron
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// messageWordlist is a list of commit messages (or fragments of them) that are sampled without repetition until every one of them has been used,
+// after which sampling starts over. Which have been used is persisted in the user's cache directory, so that it carries over from run to run
+type messageWordlist struct {
+	lines []string
+	// statePath is the file that the used lines are persisted in
+	statePath string
+	used      map[string]bool
+}
+
+// loadMessageWordlist reads the newline delimited file at path (blank lines are skipped), and which of its lines have already been used
+func loadMessageWordlist(path string) (*messageWordlist, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading COMMIT_MESSAGES_FILE: %w", err)
+	}
+	w := &messageWordlist{used: map[string]bool{}}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			w.lines = append(w.lines, line)
+		}
+	}
+	if len(w.lines) == 0 {
+		return nil, fmt.Errorf("COMMIT_MESSAGES_FILE %v has no messages in it", path)
+	}
+
+	// the state of each file is kept separately, named by the hash of its absolute path
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error resolving COMMIT_MESSAGES_FILE: %w", err)
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, fmt.Errorf("Error finding user cache directory: %w", err)
+	}
+	sum := sha256.Sum256([]byte(abs))
+	w.statePath = filepath.Join(dir, "commitcron", "wordlists", hex.EncodeToString(sum[:8])+".json")
+	// a state that can't be read is the same as none, every line is unused
+	if data, err := ioutil.ReadFile(w.statePath); err == nil {
+		var used []string
+		if json.Unmarshal(data, &used) == nil {
+			for _, line := range used {
+				w.used[line] = true
+			}
+		}
+	}
+	return w, nil
+}
+
+// next returns a line that has not been used yet, chosen at random, and persists that it has been used
+// once every line has been used, they are all unused again
+func (w *messageWordlist) next() (string, error) {
+	var unused []string
+	for _, line := range w.lines {
+		if !w.used[line] {
+			unused = append(unused, line)
+		}
+	}
+	if len(unused) == 0 {
+		w.used = map[string]bool{}
+		unused = w.lines
+	}
+	line := unused[rand.Intn(len(unused))]
+	w.used[line] = true
+
+	used := make([]string, 0, len(w.used))
+	for l := range w.used {
+		used = append(used, l)
+	}
+	data, err := json.Marshal(used)
+	if err != nil {
+		return "", fmt.Errorf("Error encoding used messages: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(w.statePath), 0700); err != nil {
+		return "", fmt.Errorf("Error creating %v: %w", filepath.Dir(w.statePath), err)
+	}
+	if err := ioutil.WriteFile(w.statePath, data, 0600); err != nil {
+		return "", fmt.Errorf("Error writing used messages to %v: %w", w.statePath, err)
+	}
+	return line, nil
+}